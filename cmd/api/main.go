@@ -1,17 +1,28 @@
 package main
 
 import (
+	"4shure/cmd/internal/authz"
 	"4shure/cmd/internal/domain/sqlite"
 	"4shure/cmd/internal/domain/sqlite/repository"
 	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	localidp "4shure/cmd/internal/integration/local"
+	mailer "4shure/cmd/internal/integration/mail"
+	"4shure/cmd/internal/integration/webhook"
+	"4shure/cmd/internal/notification"
 	"4shure/cmd/internal/routes"
 	"4shure/cmd/internal/service"
+	"4shure/cmd/internal/utils"
 	"4shure/cmd/internal/utils/validators"
+	"context"
+	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+	"os"
+	"time"
 )
 
 func main() {
@@ -29,41 +40,148 @@ func main() {
 		log.Fatal("failed to initialize database", err)
 	}
 
-	// Cognito cliente
-	cogClient, err := cognitoclient.InitCognitoClient()
+	// Identity provider, either Cognito or the local one
+	idp, verifierConfig, err := initIdentityProvider(db)
 	if err != nil {
-		log.Fatal("failed to initialize cognito client", err)
+		log.Fatal("failed to initialize identity provider", err)
 	}
 
+	// "api reconcile" compares the users of the identity provider with ours, then exits
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(reconcile(db, idp, os.Args[2:]))
+	}
+
+	// Tokens are verified against the identity provider keys, even when running behind API Gateway
+	utils.SetTokenVerifier(utils.NewTokenVerifier(verifierConfig))
+
 	// Getting repositories
 	userRepo := repository.NewUserRepository(db)
 	apptRepo := repository.NewAppointmentRepository(db)
+	resourceRepo := repository.NewResourceRepository(db)
+	availabilityRepo := repository.NewAvailabilityRepository(db)
+	reminderRepo := repository.NewReminderRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+
+	// Changes are saved along with their side effects (see service.Transactor), which the
+	// outbox dispatcher then carries out in the background, retrying failures
+	tx := newTransactor(db)
+
+	mail, err := mailer.New(mailer.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("failed to initialize mailer", err)
+	}
 
 	// Getting services
-	userService := service.NewUserService(userRepo, validate, cogClient)
-	apptService := service.NewAppointmentService(apptRepo, userRepo, validate)
+	apptConfig, err := service.AppointmentConfigFromEnv()
+	if err != nil {
+		log.Fatal("invalid appointment configuration", err)
+	}
+
+	webhookConfig := service.WebhookConfigFromEnv()
+	webhookService := service.NewWebhookService(webhookRepo, validate, webhook.NewSender(webhookConfig.Timeout), webhookConfig)
+	calendar := service.NewCalendarBroker()
+	userService := service.NewUserService(userRepo, apptRepo, validate, idp, tx, calendar)
+	resourceService := service.NewResourceService(resourceRepo, validate)
+	availabilityService := service.NewAvailabilityService(availabilityRepo, validate, apptConfig)
+	apptService := service.NewAppointmentService(apptRepo, userRepo, resourceRepo, availabilityRepo, validate, apptConfig, tx, calendar)
+	reminders := service.NewReminderScheduler(reminderRepo, tx, service.ReminderConfigFromEnv())
+
+	notifier := notification.NewMailNotifier(mail, apptConfig.Location)
+	outbox := service.NewOutboxDispatcher(outboxRepo, service.OutboxConfigFromEnv())
+	outbox.Handle(service.OutboxNotification, service.NotificationHandler(apptRepo, userRepo, resourceRepo, notifier))
+	outbox.Handle(service.OutboxWebhookEvent, service.WebhookHandler(webhookService))
+	outbox.Handle(service.OutboxDeleteIdentity, service.DeleteIdentityHandler(idp))
+	outbox.Handle(service.OutboxSignupCleanup, service.SignupCleanupHandler(idp, userRepo))
+	outbox.Handle(service.OutboxCalendarEvent, service.CalendarHandler(calendar))
+
+	ctx := context.Background()
+	go outbox.Run(ctx)
+	go reminders.Run(ctx)
+	go webhookService.Run(ctx)
 
 	// Getting routes
 	userRoutes := routes.NewUserDefault(userService)
 	apptRoutes := routes.NewAppointmentDefault(apptService)
+	resourceRoutes := routes.NewResourceDefault(resourceService)
+	availabilityRoutes := routes.NewAvailabilityDefault(availabilityService)
+	webhookRoutes := routes.NewWebhookDefault(webhookService)
+	calendarStreamRoutes := routes.NewCalendarStreamDefault(calendar, service.CalendarStreamConfigFromEnv())
 
 	e := echo.New()
 	e.Use(middleware.CORS())
 
-	// Appointments
-	e.GET("/api/appointments", apptRoutes.GetAppointments)
-	e.POST("/api/appointments", apptRoutes.CreateAppointment)
-	e.DELETE("/api/appointments/:id", apptRoutes.DeleteAppointment)
+	// Routes are split in three groups: public ones, ones that need a signed-in user, and
+	// admin ones, which need a permission on top of that. New routes should go in the
+	// authenticated group by default, or in an admin sub-group if they are not meant for
+	// every user. Neither adds a catch-all route, so unknown paths still get a 404.
+	public := routes.NewGroup(e, "/api")
+	authed := public.Group("", routes.Authenticate(userRepo))
+
+	// Sign up and sign in
+	public.POST("/users", userRoutes.CreateUser)
+	public.POST("/users/login", userRoutes.CreateLogin)
+	public.POST("/users/token/refresh", userRoutes.RefreshTokens)
+	public.POST("/users/verify", userRoutes.VerifySignup)
+	public.POST("/users/verify/resend", userRoutes.ResendVerification)
+	public.POST("/users/password/forgot", userRoutes.ForgotPassword)
+	public.POST("/users/password/reset", userRoutes.ResetPassword)
 
 	// Pseudo-entity "Calendar" to check the availability of a new appointment
-	e.GET("/api/calendar", apptRoutes.GetCalendar)
+	public.GET("/calendar", apptRoutes.GetCalendar)
+	public.GET("/calendar/slots", apptRoutes.GetFreeSlots)
+	public.GET("/calendar/slots/next", apptRoutes.GetNextSlot)
+	public.GET("/calendar/stream", calendarStreamRoutes.StreamCalendar)
+
+	// Bookable resources (rooms, staff members...) and opening hours, readable by anyone
+	public.GET("/resources", resourceRoutes.GetResources)
+	public.GET("/resources/:id", resourceRoutes.GetResource)
+	public.GET("/availability/hours", availabilityRoutes.GetOpeningHours)
+	public.GET("/availability/overrides", availabilityRoutes.GetOverrides)
+
+	// Appointments
+	authed.GET("/appointments", apptRoutes.GetAppointments)
+	authed.POST("/appointments", apptRoutes.CreateAppointment)
+	authed.PATCH("/appointments/:id", apptRoutes.UpdateAppointment)
+	authed.DELETE("/appointments/:id", apptRoutes.DeleteAppointment)
+	authed.POST("/appointments/:id/restore", apptRoutes.RestoreAppointment)
 
 	// Users
-	e.GET("/api/users", userRoutes.GetUsers)
-	e.GET("/api/users/:id", userRoutes.GetUser)
-	e.POST("/api/users", userRoutes.CreateUser)
-	e.POST("/api/users/login", userRoutes.CreateLogin)
-	e.POST("/api/users/verify", userRoutes.VerifySignup)
+	authed.POST("/users/logout", userRoutes.Logout)
+	authed.POST("/users/password/change", userRoutes.ChangePassword)
+	authed.PATCH("/users/@me", userRoutes.UpdateProfile)
+	authed.DELETE("/users/@me", userRoutes.DeleteAccount)
+	authed.POST("/users/@me/email/verify", userRoutes.VerifyEmail)
+	authed.GET("/users/:id", userRoutes.GetUser)
+	authed.GET("/users/:id/export", userRoutes.ExportUser)
+
+	readUsers := authed.Group("/users", routes.Require(authz.UsersRead))
+	readUsers.GET("", userRoutes.GetUsers)
+
+	manageUsers := authed.Group("/users", routes.Require(authz.UsersManage))
+	manageUsers.PUT("/:id/role", userRoutes.SetRole)
+	manageUsers.POST("/:id/permissions", userRoutes.GrantPermission)
+	manageUsers.DELETE("/:id/permissions/:permission", userRoutes.RevokePermission)
+
+	// Resources, opening hours and date overrides (holidays...), managed by admins by default
+	manageResources := authed.Group("/resources", routes.Require(authz.ResourcesManage))
+	manageResources.POST("", resourceRoutes.CreateResource)
+	manageResources.PATCH("/:id", resourceRoutes.UpdateResource)
+	manageResources.DELETE("/:id", resourceRoutes.DeleteResource)
+
+	manageAvailability := authed.Group("/availability", routes.Require(authz.AvailabilityManage))
+	manageAvailability.PUT("/hours", availabilityRoutes.SetOpeningHours)
+	manageAvailability.POST("/overrides", availabilityRoutes.CreateOverride)
+	manageAvailability.DELETE("/overrides/:id", availabilityRoutes.DeleteOverride)
+
+	// Webhooks receiving signed events about appointments and users, and their delivery log
+	manageWebhooks := authed.Group("/webhooks", routes.Require(authz.WebhooksManage))
+	manageWebhooks.GET("", webhookRoutes.GetWebhooks)
+	manageWebhooks.POST("", webhookRoutes.CreateWebhook)
+	manageWebhooks.PATCH("/:id", webhookRoutes.UpdateWebhook)
+	manageWebhooks.DELETE("/:id", webhookRoutes.DeleteWebhook)
+	manageWebhooks.GET("/:id/deliveries", webhookRoutes.GetDeliveries)
+	manageWebhooks.POST("/:id/deliveries/:delivery/replay", webhookRoutes.ReplayDelivery)
 
 	err = e.Start(":6060")
 	if err != nil {
@@ -71,6 +189,60 @@ func main() {
 	}
 }
 
+// newTransactor runs transactions over the repositories of the database.
+func newTransactor(db *gorm.DB) service.Transactor {
+	return repository.NewTransactor(db, func(tx *gorm.DB) *service.TxRepositories {
+		return &service.TxRepositories{
+			Users:        repository.NewUserRepository(tx),
+			Appointments: repository.NewAppointmentRepository(tx),
+			Reminders:    repository.NewReminderRepository(tx),
+			Outbox:       repository.NewOutboxRepository(tx),
+		}
+	})
+}
+
+// initIdentityProvider picks the identity provider from IDENTITY_PROVIDER: "cognito" (the default)
+// or "local", which keeps credentials in our own database and needs no AWS account.
+func initIdentityProvider(db *gorm.DB) (cognitoclient.CognitoInterface, *utils.VerifierConfig, error) {
+	switch provider := os.Getenv("IDENTITY_PROVIDER"); provider {
+	case "", "cognito":
+		cogClient, err := cognitoclient.InitCognitoClient()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		verifierConfig, err := utils.VerifierConfigFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		return cogClient, verifierConfig, nil
+
+	case "local":
+		config, err := localidp.ConfigFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		repo := repository.NewLocalIdentityRepository(db)
+		local, err := localidp.NewProvider(repo, config, localidp.NewCodeSender(config.MailFile))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Warn("using the local identity provider, which is not meant for production")
+		return local, &utils.VerifierConfig{
+			StaticJWKS: local.JWKS(),
+			Issuer:     local.Issuer(),
+			ClientID:   local.ClientID(),
+			TokenUses:  []string{"id", "access"},
+			CacheTTL:   24 * time.Hour,
+		}, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown identity provider %q", provider)
+	}
+}
+
 func registerValidators(validate *validator.Validate) {
 	_ = validate.RegisterValidation("hasupper", validators.HasUpper)
 	_ = validate.RegisterValidation("haslower", validators.HasLower)
@@ -79,4 +251,5 @@ func registerValidators(validate *validator.Validate) {
 	_ = validate.RegisterValidation("nodupes", validators.NoDupes)
 	_ = validate.RegisterValidation("nospaces", validators.NoWhiteSpaces)
 	_ = validate.RegisterValidation("iso8601", validators.IsIso8601)
+	_ = validate.RegisterValidation("clock", validators.IsClock)
 }
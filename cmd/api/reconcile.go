@@ -0,0 +1,65 @@
+package main
+
+import (
+	"4shure/cmd/internal/domain/sqlite/repository"
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"4shure/cmd/internal/service"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// reconcile compares the users of the identity provider with the ones of the database, and fixes
+// the drifts found (see service.Reconciler). It prints what it found, and returns the exit code.
+//
+// Usage: api reconcile [-dry-run] [-json]
+func reconcile(db *gorm.DB, idp cognitoclient.CognitoInterface, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report the drifts, without fixing them")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// The slots freed by the accounts closed here are published by the API, through the outbox
+	reconciler := service.NewReconciler(repository.NewUserRepository(db), repository.NewAppointmentRepository(db), repository.NewOutboxRepository(db), idp, newTransactor(db))
+	report, err := reconciler.Reconcile(*dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	failed := 0
+	for _, drift := range report.Drifts {
+		if drift.Error != "" {
+			failed++
+		}
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, drift := range report.Drifts {
+			status := "fixed"
+			switch {
+			case drift.Error != "":
+				status = "failed: " + drift.Error
+			case !drift.Fixed && drift.Kind == service.DriftConflict:
+				status = "needs a look"
+			case !drift.Fixed:
+				status = "not fixed (dry run)"
+			}
+			fmt.Printf("%-15s sub=%s email=%s user=%d: %s\n", drift.Kind, drift.Sub, drift.Email, drift.UserID, status)
+		}
+		fmt.Printf("%d pool users, %d users, %d drifts (%d failed)\n", report.PoolUsers, report.LocalUsers, len(report.Drifts), failed)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
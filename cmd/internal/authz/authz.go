@@ -0,0 +1,91 @@
+package authz
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"slices"
+)
+
+type Role = string
+
+const (
+	RoleMember Role = "member"
+	RoleStaff  Role = "staff"
+	RoleAdmin  Role = "admin"
+)
+
+type Permission = string
+
+const (
+	// AppointmentsManageAll allows reading, booking, changing and cancelling anyone's appointments.
+	AppointmentsManageAll Permission = "appointments:manage_all"
+
+	ResourcesManage    Permission = "resources:manage"
+	AvailabilityManage Permission = "availability:manage"
+
+	UsersRead Permission = "users:read"
+
+	// UsersManage allows changing roles, and granting or revoking permissions.
+	UsersManage Permission = "users:manage"
+
+	// WebhooksManage allows registering webhooks, reading their deliveries and replaying them.
+	WebhooksManage Permission = "webhooks:manage"
+)
+
+// Roles lists every role, from the least to the most privileged.
+var Roles = []Role{RoleMember, RoleStaff, RoleAdmin}
+
+// Permissions lists every permission that can be granted.
+var Permissions = []Permission{
+	AppointmentsManageAll,
+	ResourcesManage,
+	AvailabilityManage,
+	UsersRead,
+	UsersManage,
+	WebhooksManage,
+}
+
+// rolePermissions tells which permissions come with each role. Other permissions
+// can be granted to specific users on top of their role.
+var rolePermissions = map[Role][]Permission{
+	RoleMember: {},
+	RoleStaff:  {AppointmentsManageAll, UsersRead},
+	RoleAdmin:  Permissions,
+}
+
+func IsRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+func IsPermission(permission string) bool {
+	return slices.Contains(Permissions, permission)
+}
+
+// Can tells whether the user has the permission, either through their role or because
+// it was granted to them. The user's permissions must be loaded.
+func Can(user *entity.User, permission Permission) bool {
+	if user == nil {
+		return false
+	}
+
+	if slices.Contains(rolePermissions[user.Role], permission) {
+		return true
+	}
+
+	for _, granted := range user.Permissions {
+		if granted.Permission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Effective lists every permission the user has, in the same order as Permissions.
+func Effective(user *entity.User) []Permission {
+	effective := make([]Permission, 0, len(Permissions))
+	for _, permission := range Permissions {
+		if Can(user, permission) {
+			effective = append(effective, permission)
+		}
+	}
+	return effective
+}
@@ -0,0 +1,59 @@
+package authz
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"slices"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       *entity.User
+		permission Permission
+		want       bool
+	}{
+		{"nobody", nil, UsersRead, false},
+		{"member", &entity.User{Role: RoleMember}, AppointmentsManageAll, false},
+		{"staff through role", &entity.User{Role: RoleStaff}, AppointmentsManageAll, true},
+		{"staff beyond role", &entity.User{Role: RoleStaff}, UsersManage, false},
+		{"admin", &entity.User{Role: RoleAdmin}, UsersManage, true},
+		{"unknown role", &entity.User{Role: "owner"}, UsersRead, false},
+		{
+			"member with granted permission",
+			&entity.User{Role: RoleMember, Permissions: []entity.UserPermission{{Permission: ResourcesManage}}},
+			ResourcesManage,
+			true,
+		},
+		{
+			"member with another granted permission",
+			&entity.User{Role: RoleMember, Permissions: []entity.UserPermission{{Permission: ResourcesManage}}},
+			AvailabilityManage,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Can(tt.user, tt.permission); got != tt.want {
+				t.Errorf("Can() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffective(t *testing.T) {
+	user := &entity.User{
+		Role:        RoleStaff,
+		Permissions: []entity.UserPermission{{Permission: ResourcesManage}, {Permission: UsersRead}},
+	}
+
+	want := []Permission{AppointmentsManageAll, ResourcesManage, UsersRead}
+	if got := Effective(user); !slices.Equal(got, want) {
+		t.Errorf("Effective() = %v, want %v", got, want)
+	}
+
+	if got := Effective(&entity.User{Role: RoleAdmin}); !slices.Equal(got, Permissions) {
+		t.Errorf("Effective() = %v, want every permission", got)
+	}
+}
@@ -1,14 +1,25 @@
 package entity
 
 type Appointment struct {
-	ID        int    `gorm:"primaryKey"`
-	BeginsAt  int64  `gorm:"not null"`
-	EndsAt    int64  `gorm:"not null"`
-	UserID    int    `gorm:"not null"` // References: users(id)
-	IsDeleted bool   `gorm:"not null"`
-	CreatedAt int64  `gorm:"not null"`
-	UpdatedAt int64  `gorm:"not null"`
-	Title     string `gorm:"not null"`
+	ID         int    `gorm:"primaryKey"`
+	BeginsAt   int64  `gorm:"not null"`
+	EndsAt     int64  `gorm:"not null"`
+	UserID     int    `gorm:"not null"`                 // References: users(id)
+	ResourceID int    `gorm:"not null;default:0;index"` // References: resources(id)
+	SeriesID   int    `gorm:"not null;default:0;index"` // References: appointment_series(id), zero if not recurring
+	IsDeleted  bool   `gorm:"not null"`
+	CreatedAt  int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt  int64  `gorm:"not null;autoUpdateTime:milli"`
+	Title      string `gorm:"not null"`
+
+	// Who booked and last changed the appointment, which can be staff acting on behalf of UserID
+	BookedBy  int `gorm:"not null;default:0"` // References: users(id)
+	UpdatedBy int `gorm:"not null;default:0"` // References: users(id)
+
+	// Cancellation details, only set when IsDeleted is true
+	CancelledBy  int    `gorm:"not null;default:0"` // References: users(id)
+	CancelledAt  int64  `gorm:"not null;default:0"`
+	CancelReason string `gorm:"not null;default:''"`
 
 	// Relations
 	CreatedBy User `gorm:"foreignKey:UserID;references:ID"`
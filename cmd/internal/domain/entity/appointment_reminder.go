@@ -0,0 +1,11 @@
+package entity
+
+// AppointmentReminder records a reminder sent for an appointment, so that it is sent only once
+// per lead time. BeginsAt is kept too, so that moved appointments are reminded again.
+type AppointmentReminder struct {
+	ID            int   `gorm:"primaryKey"`
+	AppointmentID int   `gorm:"not null;uniqueIndex:idx_appointment_reminder"` // References: appointments(id)
+	LeadMinutes   int   `gorm:"not null;uniqueIndex:idx_appointment_reminder"`
+	BeginsAt      int64 `gorm:"not null;uniqueIndex:idx_appointment_reminder"`
+	SentAt        int64 `gorm:"not null;autoCreateTime:milli"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+// AppointmentSeries keeps the rule a group of recurring appointments was created with.
+// Each occurrence is a regular Appointment pointing back to its series.
+type AppointmentSeries struct {
+	ID         int    `gorm:"primaryKey"`
+	UserID     int    `gorm:"not null"` // References: users(id)
+	ResourceID int    `gorm:"not null"` // References: resources(id)
+	Frequency  string `gorm:"not null"` // One of: daily, weekly, monthly
+	Interval   int    `gorm:"not null"`
+	Count      int    `gorm:"not null"` // Zero when the series ends at Until
+	Until      int64  `gorm:"not null"` // Zero when the series ends after Count occurrences
+	Weekdays   string `gorm:"not null"` // Comma separated, e.g., "MO,WE,FR"
+	IsDeleted  bool   `gorm:"not null"`
+	CreatedAt  int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt  int64  `gorm:"not null;autoUpdateTime:milli"`
+}
@@ -0,0 +1,44 @@
+package entity
+
+// LocalIdentity holds the credentials of a user of the local identity provider,
+// which stands in for Cognito when running offline or in CI.
+type LocalIdentity struct {
+	ID           int    `gorm:"primaryKey"`
+	Sub          string `gorm:"not null;uniqueIndex"`
+	Email        string `gorm:"not null;uniqueIndex"`
+	PasswordHash string `gorm:"not null"`
+	Confirmed    bool   `gorm:"not null"`
+
+	// EmailUnverified is set when the e-mail changes, until the new one is verified
+	EmailUnverified bool `gorm:"not null;default:false"`
+
+	// Pending codes, one per purpose: confirming the account, resetting the password
+	// and verifying a new e-mail
+	SignupCode LocalCode `gorm:"embedded;embeddedPrefix:signup_code_"`
+	ResetCode  LocalCode `gorm:"embedded;embeddedPrefix:reset_code_"`
+	EmailCode  LocalCode `gorm:"embedded;embeddedPrefix:email_code_"`
+
+	// Tokens issued before this time are no longer valid, see GlobalSignOut
+	SignedOutAt int64 `gorm:"not null;default:0"`
+
+	CreatedAt int64 `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt int64 `gorm:"not null;autoUpdateTime:milli"`
+}
+
+// LocalCode is a code sent by the local identity provider, empty once used. Like Cognito's,
+// it expires, and is invalidated after too many wrong attempts.
+type LocalCode struct {
+	Value          string `gorm:"not null;default:''"`
+	ExpiresAt      int64  `gorm:"not null;default:0"`
+	FailedAttempts int    `gorm:"not null;default:0"`
+}
+
+// LocalRefreshToken is a refresh token issued by the local identity provider.
+// Only a hash of the token is stored.
+type LocalRefreshToken struct {
+	ID         int    `gorm:"primaryKey"`
+	IdentityID int    `gorm:"not null;index"` // References: local_identities(id)
+	TokenHash  string `gorm:"not null;uniqueIndex"`
+	ExpiresAt  int64  `gorm:"not null"`
+	CreatedAt  int64  `gorm:"not null;autoCreateTime:milli"`
+}
@@ -0,0 +1,25 @@
+package entity
+
+// OpeningHours is a weekly window in which appointments can be booked.
+// Times are minutes since midnight, in the business time zone.
+type OpeningHours struct {
+	ID        int   `gorm:"primaryKey"`
+	Weekday   int   `gorm:"not null"` // 0 (Sunday) to 6 (Saturday)
+	OpensAt   int   `gorm:"not null"`
+	ClosesAt  int   `gorm:"not null"`
+	CreatedAt int64 `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt int64 `gorm:"not null;autoUpdateTime:milli"`
+}
+
+// DateOverride replaces the weekly opening hours of a single date.
+// Holidays and other closed days are overrides with IsClosed set.
+type DateOverride struct {
+	ID        int    `gorm:"primaryKey"`
+	Date      string `gorm:"not null;index"` // YYYY-MM-DD
+	OpensAt   int    `gorm:"not null"`
+	ClosesAt  int    `gorm:"not null"`
+	IsClosed  bool   `gorm:"not null"`
+	Reason    string `gorm:"not null"`
+	CreatedAt int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt int64  `gorm:"not null;autoUpdateTime:milli"`
+}
@@ -0,0 +1,22 @@
+package entity
+
+// Statuses of an OutboxMessage. Messages are deleted once handled, so only
+// pending and failed ones are kept.
+const (
+	OutboxPending = "pending"
+	OutboxFailed  = "failed"
+)
+
+// OutboxMessage is a side effect (e-mail, webhook event, identity provider call...) recorded in the
+// same transaction as the change causing it, and carried out later on by the outbox dispatcher.
+type OutboxMessage struct {
+	ID            int    `gorm:"primaryKey"`
+	Kind          string `gorm:"not null"`
+	Payload       string `gorm:"not null"` // JSON, depends on Kind
+	Status        string `gorm:"not null;index:idx_outbox_due"`
+	Attempts      int    `gorm:"not null;default:0"`
+	NextAttemptAt int64  `gorm:"not null;index:idx_outbox_due"`
+	LastError     string `gorm:"not null;default:''"`
+	CreatedAt     int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt     int64  `gorm:"not null;autoUpdateTime:milli"`
+}
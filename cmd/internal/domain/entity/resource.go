@@ -0,0 +1,12 @@
+package entity
+
+// Resource is anything that can be booked: a room, a staff member, a piece of equipment...
+// Appointments only conflict with other appointments of the same resource.
+type Resource struct {
+	ID          int    `gorm:"primaryKey"`
+	Name        string `gorm:"not null"`
+	Description string `gorm:"not null"`
+	IsDeleted   bool   `gorm:"not null"`
+	CreatedAt   int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt   int64  `gorm:"not null;autoUpdateTime:milli"`
+}
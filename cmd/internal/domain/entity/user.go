@@ -6,7 +6,17 @@ type User struct {
 	Username      string `gorm:"not null"`
 	Email         string `gorm:"not null"`
 	EmailVerified bool   `gorm:"not null"`
-	IsAdmin       bool   `gorm:"not null"`
-	CreatedAt     int64  `gorm:"not null"`
-	UpdatedAt     int64  `gorm:"not null"`
+	Role          string `gorm:"not null;default:'member'"` // See authz.Roles
+	CreatedAt     int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt     int64  `gorm:"not null;autoUpdateTime:milli"`
+
+	// SignedOutAt is when the user last signed out of every session.
+	// Tokens issued before this time are rejected, see routes.Authenticate.
+	SignedOutAt int64 `gorm:"not null;default:0"`
+
+	// IsDeleted is set once the user deleted their account, which is anonymised then.
+	IsDeleted bool `gorm:"not null;default:false"`
+
+	// Relations
+	Permissions []UserPermission `gorm:"foreignKey:UserID;references:ID"`
 }
@@ -0,0 +1,10 @@
+package entity
+
+// UserPermission is a permission granted to a user on top of the ones that come with their role.
+type UserPermission struct {
+	ID         int    `gorm:"primaryKey"`
+	UserID     int    `gorm:"not null;uniqueIndex:idx_user_permission"` // References: users(id)
+	Permission string `gorm:"not null;uniqueIndex:idx_user_permission"`
+	GrantedBy  int    `gorm:"not null"` // References: users(id)
+	CreatedAt  int64  `gorm:"not null;autoCreateTime:milli"`
+}
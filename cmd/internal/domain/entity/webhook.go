@@ -0,0 +1,46 @@
+package entity
+
+// Webhook is an endpoint receiving signed events about appointments and users.
+type Webhook struct {
+	ID          int    `gorm:"primaryKey"`
+	URL         string `gorm:"not null"`
+	Description string `gorm:"not null;default:''"`
+	Secret      string `gorm:"not null"`
+	Events      string `gorm:"not null"` // Comma-separated event types, e.g. "appointment.created,user.verified"
+	IsActive    bool   `gorm:"not null"`
+	IsDeleted   bool   `gorm:"not null"`
+	CreatedBy   int    `gorm:"not null"` // References: users(id)
+	CreatedAt   int64  `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt   int64  `gorm:"not null;autoUpdateTime:milli"`
+}
+
+// Statuses of a WebhookDelivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event sent (or to be sent) to a webhook. Failed deliveries are
+// tried again until they succeed or run out of attempts.
+type WebhookDelivery struct {
+	ID            int    `gorm:"primaryKey"`
+	WebhookID     int    `gorm:"not null;index;uniqueIndex:idx_webhook_deliveries_event,where:replay_of = 0"` // References: webhooks(id)
+	EventID       string `gorm:"not null;index;uniqueIndex:idx_webhook_deliveries_event,where:replay_of = 0"` // Shared by every delivery of the same event, including replays
+	EventType     string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	Status        string `gorm:"not null;index"` // See DeliveryPending
+	Attempts      int    `gorm:"not null;default:0"`
+	NextAttemptAt int64  `gorm:"not null;default:0"`
+	LastAttemptAt int64  `gorm:"not null;default:0"`
+
+	// Outcome of the last attempt
+	ResponseStatus int    `gorm:"not null;default:0"`
+	LastError      string `gorm:"not null;default:''"`
+
+	// ReplayOf is the delivery this one replays, zero for the original delivery
+	ReplayOf int `gorm:"not null;default:0"` // References: webhook_deliveries(id)
+
+	CreatedAt int64 `gorm:"not null;autoCreateTime:milli"`
+	UpdatedAt int64 `gorm:"not null;autoUpdateTime:milli"`
+}
@@ -2,6 +2,7 @@ package sqlite
 
 import (
 	"4shure/cmd/internal/domain/entity"
+	"errors"
 	"gorm.io/driver/sqlite"
 	"time"
 
@@ -9,20 +10,102 @@ import (
 )
 
 func Init() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open("./database.db"), &gorm.Config{})
+	return Open("./database.db")
+}
+
+// Open opens (and migrates) the SQLite database at the given path.
+func Open(path string) (*gorm.DB, error) {
+	// Transactions begin immediately, so concurrent writers wait for each other (up to the busy
+	// timeout) instead of failing when upgrading their lock halfway through a transaction.
+	// WAL lets readers go on while someone is writing.
+	dsn := path + "?_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(
+		&entity.User{},
+		&entity.Appointment{},
+		&entity.Resource{},
+		&entity.AppointmentSeries{},
+		&entity.OpeningHours{},
+		&entity.DateOverride{},
+		&entity.UserPermission{},
+		&entity.LocalIdentity{},
+		&entity.LocalRefreshToken{},
+		&entity.AppointmentReminder{},
+		&entity.Webhook{},
+		&entity.WebhookDelivery{},
+		&entity.OutboxMessage{},
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&entity.User{}, &entity.Appointment{})
+	err = migrateAdminFlag(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = seedDefaultResource(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = backfillBookedBy(db)
 	if err != nil {
 		return nil, err
 	}
 
 	sqlDB, _ := db.DB()
-	sqlDB.SetMaxOpenConns(1)
-	sqlDB.SetMaxIdleConns(1)
+	sqlDB.SetMaxOpenConns(4)
+	sqlDB.SetMaxIdleConns(4)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	return db, nil
 }
+
+// seedDefaultResource makes sure there is at least one bookable resource, and moves
+// appointments created before resources existed (resource_id = 0) into it.
+func seedDefaultResource(db *gorm.DB) error {
+	var def entity.Resource
+	err := db.Order("id asc").First(&def).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		now := time.Now().UTC().UnixMilli()
+		def = entity.Resource{Name: "Default", CreatedAt: now, UpdatedAt: now}
+		err = db.Create(&def).Error
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&entity.Appointment{}).
+		Where("resource_id = ?", 0).
+		UpdateColumn("resource_id", def.ID).Error
+}
+
+// backfillBookedBy marks appointments booked before admins could book on behalf of
+// others as booked by their own user.
+func backfillBookedBy(db *gorm.DB) error {
+	return db.Model(&entity.Appointment{}).
+		Where("booked_by = ?", 0).
+		UpdateColumn("booked_by", gorm.Expr("user_id")).Error
+}
+
+// migrateAdminFlag turns users flagged with the former is_admin column into admins,
+// then drops the column, as roles replaced it.
+func migrateAdminFlag(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&entity.User{}, "is_admin") {
+		return nil
+	}
+
+	err := db.Model(&entity.User{}).
+		Where("is_admin = ?", true).
+		UpdateColumn("role", "admin").Error
+	if err != nil {
+		return err
+	}
+	return db.Migrator().DropColumn(&entity.User{}, "is_admin")
+}
@@ -4,6 +4,7 @@ import (
 	"4shure/cmd/internal/domain/entity"
 	"errors"
 	"gorm.io/gorm"
+	"slices"
 )
 
 type DefaultAppointmentRepository struct {
@@ -23,38 +24,144 @@ func (a *DefaultAppointmentRepository) FindByID(id int) (*entity.Appointment, er
 	return &appt, err
 }
 
-func (a *DefaultAppointmentRepository) IsAvailable(begin, end int64) (bool, error) {
+func (a *DefaultAppointmentRepository) IsAvailable(resourceID int, begin, end int64) (bool, error) {
 	if begin >= end {
 		return false, errors.New("start time must be before end time")
 	}
 
-	var count int64
-	err := a.db.Model(&entity.Appointment{}).
+	return isAvailable(a.db, resourceID, begin, end, nil)
+}
+
+// Book saves the given appointments, but only if none of them overlaps an existing appointment
+// of the same resource (ignoring the ones in excludeIDs, e.g., the appointments being moved).
+//
+// The check and the writes happen in a single transaction, serialized per resource, so two
+// concurrent bookings can never take the same period. If anything conflicts, nothing is saved
+// and the conflicting appointments are returned. The given appointments must not overlap each other.
+func (a *DefaultAppointmentRepository) Book(appts []*entity.Appointment, excludeIDs ...int) ([]*entity.Appointment, error) {
+	return a.book(appts, excludeIDs, nil)
+}
+
+// BookSeries works just like Book, also saving the series (and linking every occurrence to it)
+// in the same transaction.
+func (a *DefaultAppointmentRepository) BookSeries(series *entity.AppointmentSeries, appts []*entity.Appointment) ([]*entity.Appointment, error) {
+	return a.book(appts, nil, func(tx *gorm.DB) error {
+		err := tx.Save(series).Error
+		if err != nil {
+			return err
+		}
+
+		for _, appt := range appts {
+			appt.SeriesID = series.ID
+		}
+		return nil
+	})
+}
+
+func (a *DefaultAppointmentRepository) book(appts []*entity.Appointment, excludeIDs []int, beforeSave func(tx *gorm.DB) error) ([]*entity.Appointment, error) {
+	var conflicts []*entity.Appointment
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		err := lockResources(tx, appts)
+		if err != nil {
+			return err
+		}
+
+		for _, appt := range appts {
+			available, err := isAvailable(tx, appt.ResourceID, appt.BeginsAt, appt.EndsAt, excludeIDs)
+			if err != nil {
+				return err
+			}
+
+			if !available {
+				conflicts = append(conflicts, appt)
+			}
+		}
+
+		if len(conflicts) > 0 {
+			return nil
+		}
+
+		if beforeSave != nil {
+			err = beforeSave(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, appt := range appts {
+			err = tx.Save(appt).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// lockResources makes concurrent bookings of the same resources wait for each other.
+// The (no-op) update keeps the resource rows locked until the transaction ends, which
+// works the same on every database. SQLite locks the whole database instead.
+func lockResources(tx *gorm.DB, appts []*entity.Appointment) error {
+	ids := make([]int, 0, len(appts))
+	for _, appt := range appts {
+		if !slices.Contains(ids, appt.ResourceID) {
+			ids = append(ids, appt.ResourceID)
+		}
+	}
+
+	// Always locking in the same order avoids deadlocks between bookings of several resources
+	slices.Sort(ids)
+	for _, id := range ids {
+		err := tx.Model(&entity.Resource{}).
+			Where("id = ?", id).
+			UpdateColumn("updated_at", gorm.Expr("updated_at")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAvailable(db *gorm.DB, resourceID int, begin, end int64, excludeIDs []int) (bool, error) {
+	query := db.Model(&entity.Appointment{}).
 		Where("is_deleted = ?", false).
+		Where("resource_id = ?", resourceID).
 		Where("begins_at < ?", end).
-		Where("ends_at > ?", begin).
-		Count(&count).Error
+		Where("ends_at > ?", begin)
 
+	if len(excludeIDs) > 0 {
+		query = query.Where("id NOT IN ?", excludeIDs)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
 	if err != nil {
 		return false, err
 	}
 	return count == 0, nil
 }
 
-func (a *DefaultAppointmentRepository) FindAll() ([]*entity.Appointment, error) {
+// FindAll finds every appointment, including the cancelled ones if asked to.
+func (a *DefaultAppointmentRepository) FindAll(includeDeleted bool) ([]*entity.Appointment, error) {
 	var appts []*entity.Appointment
-	err := a.db.Find(&appts).Error
+	err := withDeleted(a.db, includeDeleted).Find(&appts).Error
 	return appts, err
 }
 
-// FindMonthAppointments finds all appointments that overlap with a given month.
+// FindMonthAppointments finds all appointments of a resource that overlap with a given month.
 // This method returns PARTIAL appointment entities, having only `BeginsAt` and `EndsAt` fields.
-func (a *DefaultAppointmentRepository) FindMonthAppointments(monthStart, monthEnd int64) ([]*entity.Appointment, error) {
+func (a *DefaultAppointmentRepository) FindMonthAppointments(resourceID int, monthStart, monthEnd int64) ([]*entity.Appointment, error) {
 	var results []*entity.Appointment
 
 	err := a.db.Model(&entity.Appointment{}).
 		Select("begins_at, ends_at").
 		Where("is_deleted = ?", false).
+		Where("resource_id = ?", resourceID).
 		Where("begins_at < ?", monthEnd).
 		Where("ends_at > ?", monthStart).
 		Order("begins_at asc").
@@ -66,16 +173,58 @@ func (a *DefaultAppointmentRepository) FindMonthAppointments(monthStart, monthEn
 	return results, nil
 }
 
-func (a *DefaultAppointmentRepository) FindByUserID(id int) ([]*entity.Appointment, error) {
+// FindByUserID finds every appointment of a user, including the cancelled ones if asked to.
+func (a *DefaultAppointmentRepository) FindByUserID(id int, includeDeleted bool) ([]*entity.Appointment, error) {
 	var appts []*entity.Appointment
-	err := a.db.Where("user_id = ?", id).Find(&appts).Error
+	err := withDeleted(a.db, includeDeleted).Where("user_id = ?", id).Find(&appts).Error
+	return appts, err
+}
+
+// FindBySeriesID finds all non-deleted occurrences of a recurring series, in chronological order.
+func (a *DefaultAppointmentRepository) FindBySeriesID(seriesID int) ([]*entity.Appointment, error) {
+	var appts []*entity.Appointment
+	err := a.db.
+		Where("series_id = ?", seriesID).
+		Where("is_deleted = ?", false).
+		Order("begins_at asc").
+		Find(&appts).Error
 	return appts, err
 }
 
+func (a *DefaultAppointmentRepository) FindSeriesByID(id int) (*entity.AppointmentSeries, error) {
+	var series entity.AppointmentSeries
+	err := a.db.First(&series, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &series, err
+}
+
+func (a *DefaultAppointmentRepository) SaveSeries(series *entity.AppointmentSeries) error {
+	return a.db.Save(series).Error
+}
+
 func (a *DefaultAppointmentRepository) Save(appointment *entity.Appointment) error {
 	return a.db.Save(appointment).Error
 }
 
-func (a *DefaultAppointmentRepository) Delete(appointment *entity.Appointment) error {
-	return a.db.Delete(appointment).Error
+// Cancel saves the given (already marked as deleted) appointments in a single transaction.
+// Cancelled appointments are kept for history, and can be restored with Book.
+func (a *DefaultAppointmentRepository) Cancel(appts []*entity.Appointment) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		for _, appt := range appts {
+			err := tx.Save(appt).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func withDeleted(db *gorm.DB, includeDeleted bool) *gorm.DB {
+	if includeDeleted {
+		return db
+	}
+	return db.Where("is_deleted = ?", false)
 }
@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/domain/sqlite"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Logger = logger.Discard
+
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return db
+}
+
+func newTestAppointment(userID, resourceID int, begin int64) *entity.Appointment {
+	return &entity.Appointment{
+		BeginsAt:   begin,
+		EndsAt:     begin + time.Hour.Milliseconds() - 1,
+		UserID:     userID,
+		ResourceID: resourceID,
+		CreatedAt:  1,
+		UpdatedAt:  1,
+		Title:      "test",
+	}
+}
+
+// The concurrent booking tests only cover the SQLite path: with "_txlock=immediate", every
+// transaction locks the whole database, so they pass with or without the per-resource locks
+// of lockResources, which TestBookLocksResources checks instead.
+func TestBookConcurrentSameSlot(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAppointmentRepository(db)
+	begin := time.Date(2030, 1, 7, 14, 0, 0, 0, time.UTC).UnixMilli()
+
+	// Widen the gap between the availability check and the insert, so a booking
+	// path without proper locking would (almost) always let several requests in.
+	err := db.Callback().Query().After("gorm:query").Register("test:slow_query", func(*gorm.DB) {
+		time.Sleep(5 * time.Millisecond)
+	})
+	if err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+
+	const attempts = 20
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		booked int
+		errs   []error
+	)
+
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+			<-start
+
+			conflicts, err := repo.Book([]*entity.Appointment{newTestAppointment(userID, 1, begin)})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			} else if len(conflicts) == 0 {
+				booked++
+			}
+		}(i + 1)
+	}
+
+	close(start)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %d, first: %v", len(errs), errs[0])
+	}
+
+	if booked != 1 {
+		t.Fatalf("expected exactly 1 successful booking, got %d", booked)
+	}
+
+	var count int64
+	db.Model(&entity.Appointment{}).Where("begins_at = ?", begin).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected exactly 1 appointment in the database, got %d", count)
+	}
+}
+
+func TestBookConcurrentDifferentResources(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAppointmentRepository(db)
+	begin := time.Date(2030, 1, 7, 14, 0, 0, 0, time.UTC).UnixMilli()
+
+	const resources = 5
+	for i := 2; i <= resources; i++ {
+		db.Create(&entity.Resource{Name: "room", CreatedAt: 1, UpdatedAt: 1})
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan int, resources)
+	for i := 1; i <= resources; i++ {
+		wg.Add(1)
+		go func(resourceID int) {
+			defer wg.Done()
+			conflicts, err := repo.Book([]*entity.Appointment{newTestAppointment(1, resourceID, begin)})
+			if err != nil {
+				t.Errorf("failed to book resource %d: %v", resourceID, err)
+				return
+			}
+			results <- len(conflicts)
+		}(i)
+	}
+
+	wg.Wait()
+	close(results)
+	for conflicts := range results {
+		if conflicts != 0 {
+			t.Fatalf("expected every resource to be booked, got %d conflicts", conflicts)
+		}
+	}
+}
+
+func TestBookExcludesMovedAppointments(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAppointmentRepository(db)
+	begin := time.Date(2030, 1, 7, 14, 0, 0, 0, time.UTC).UnixMilli()
+
+	appt := newTestAppointment(1, 1, begin)
+	if conflicts, err := repo.Book([]*entity.Appointment{appt}); err != nil || len(conflicts) > 0 {
+		t.Fatalf("failed to book appointment: %v (conflicts: %d)", err, len(conflicts))
+	}
+
+	// Moving it 30 minutes later overlaps its own old period only
+	appt.BeginsAt += 30 * time.Minute.Milliseconds()
+	appt.EndsAt += 30 * time.Minute.Milliseconds()
+	conflicts, err := repo.Book([]*entity.Appointment{appt}, appt.ID)
+	if err != nil || len(conflicts) > 0 {
+		t.Fatalf("expected the move to succeed: %v (conflicts: %d)", err, len(conflicts))
+	}
+
+	other := newTestAppointment(2, 1, begin)
+	conflicts, err = repo.Book([]*entity.Appointment{other})
+	if err != nil {
+		t.Fatalf("failed to book appointment: %v", err)
+	}
+
+	if len(conflicts) != 1 || other.ID != 0 {
+		t.Fatalf("expected the overlapping booking to be rejected and not saved")
+	}
+}
+
+func TestBookLocksResources(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAppointmentRepository(db)
+	begin := time.Date(2030, 1, 7, 14, 0, 0, 0, time.UTC).UnixMilli()
+	for i := 2; i <= 4; i++ {
+		db.Create(&entity.Resource{Name: "room", CreatedAt: 1, UpdatedAt: 1})
+	}
+
+	var locked []any
+	err := db.Callback().Update().After("gorm:update").Register("test:record_locks", func(tx *gorm.DB) {
+		if tx.Statement.Table == "resources" && tx.Error == nil {
+			locked = append(locked, tx.Statement.Vars[len(tx.Statement.Vars)-1])
+			if tx.RowsAffected != 1 {
+				t.Errorf("lock of resource %v touched %d rows, want 1", locked[len(locked)-1], tx.RowsAffected)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+
+	appts := []*entity.Appointment{
+		newTestAppointment(1, 3, begin),
+		newTestAppointment(1, 1, begin),
+		newTestAppointment(1, 3, begin+2*time.Hour.Milliseconds()),
+		newTestAppointment(1, 2, begin),
+	}
+	if conflicts, err := repo.Book(appts); err != nil || len(conflicts) > 0 {
+		t.Fatalf("failed to book appointments: %v (conflicts: %d)", err, len(conflicts))
+	}
+
+	// Each resource once, in the same order for every booking, so that they cannot deadlock
+	if !slices.Equal(locked, []any{1, 2, 3}) {
+		t.Errorf("locked resources %v, want [1 2 3]", locked)
+	}
+
+	// The lock leaves the resources as they were
+	var resources []*entity.Resource
+	db.Find(&resources)
+	for _, resource := range resources {
+		if resource.ID > 1 && resource.UpdatedAt != 1 {
+			t.Errorf("resource %d was changed by its lock: %+v", resource.ID, resource)
+		}
+	}
+}
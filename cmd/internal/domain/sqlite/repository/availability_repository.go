@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"errors"
+	"gorm.io/gorm"
+)
+
+type DefaultAvailabilityRepository struct {
+	db *gorm.DB
+}
+
+func NewAvailabilityRepository(db *gorm.DB) *DefaultAvailabilityRepository {
+	return &DefaultAvailabilityRepository{db: db}
+}
+
+func (a *DefaultAvailabilityRepository) FindOpeningHours() ([]*entity.OpeningHours, error) {
+	var hours []*entity.OpeningHours
+	err := a.db.Order("weekday asc, opens_at asc").Find(&hours).Error
+	return hours, err
+}
+
+// ReplaceOpeningHours removes every weekly window and saves the given ones in their place.
+func (a *DefaultAvailabilityRepository) ReplaceOpeningHours(hours []*entity.OpeningHours) error {
+	return a.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&entity.OpeningHours{}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(hours) == 0 {
+			return nil
+		}
+		return tx.Create(&hours).Error
+	})
+}
+
+// FindOverrides finds all overrides between two dates (YYYY-MM-DD), both inclusive.
+func (a *DefaultAvailabilityRepository) FindOverrides(fromDate, toDate string) ([]*entity.DateOverride, error) {
+	var overrides []*entity.DateOverride
+	err := a.db.
+		Where("date >= ?", fromDate).
+		Where("date <= ?", toDate).
+		Order("date asc, opens_at asc").
+		Find(&overrides).Error
+	return overrides, err
+}
+
+func (a *DefaultAvailabilityRepository) FindOverrideByID(id int) (*entity.DateOverride, error) {
+	var override entity.DateOverride
+	err := a.db.First(&override, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &override, err
+}
+
+func (a *DefaultAvailabilityRepository) SaveOverride(override *entity.DateOverride) error {
+	return a.db.Save(override).Error
+}
+
+func (a *DefaultAvailabilityRepository) DeleteOverride(override *entity.DateOverride) error {
+	return a.db.Delete(override).Error
+}
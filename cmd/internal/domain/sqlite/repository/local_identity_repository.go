@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"errors"
+	"gorm.io/gorm"
+)
+
+type DefaultLocalIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewLocalIdentityRepository(db *gorm.DB) *DefaultLocalIdentityRepository {
+	return &DefaultLocalIdentityRepository{db: db}
+}
+
+func (l *DefaultLocalIdentityRepository) FindByID(id int) (*entity.LocalIdentity, error) {
+	var identity entity.LocalIdentity
+	err := l.db.First(&identity, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &identity, err
+}
+
+func (l *DefaultLocalIdentityRepository) FindByEmail(email string) (*entity.LocalIdentity, error) {
+	var identity entity.LocalIdentity
+	err := l.db.Where("email = ?", email).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &identity, err
+}
+
+func (l *DefaultLocalIdentityRepository) FindBySub(sub string) (*entity.LocalIdentity, error) {
+	var identity entity.LocalIdentity
+	err := l.db.Where("sub = ?", sub).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &identity, err
+}
+
+// FindAfter returns up to limit identities whose ID is greater than the given one, by ID.
+func (l *DefaultLocalIdentityRepository) FindAfter(id, limit int) ([]*entity.LocalIdentity, error) {
+	var identities []*entity.LocalIdentity
+	err := l.db.Where("id > ?", id).Order("id asc").Limit(limit).Find(&identities).Error
+	return identities, err
+}
+
+func (l *DefaultLocalIdentityRepository) Save(identity *entity.LocalIdentity) error {
+	return l.db.Save(identity).Error
+}
+
+// Delete deletes the identity along with its refresh tokens.
+func (l *DefaultLocalIdentityRepository) Delete(identity *entity.LocalIdentity) error {
+	return l.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("identity_id = ?", identity.ID).Delete(&entity.LocalRefreshToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(identity).Error
+	})
+}
+
+func (l *DefaultLocalIdentityRepository) SaveRefreshToken(token *entity.LocalRefreshToken) error {
+	return l.db.Create(token).Error
+}
+
+func (l *DefaultLocalIdentityRepository) FindRefreshToken(hash string) (*entity.LocalRefreshToken, error) {
+	var token entity.LocalRefreshToken
+	err := l.db.Where("token_hash = ?", hash).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &token, err
+}
+
+// DeleteRefreshToken revokes a single refresh token.
+func (l *DefaultLocalIdentityRepository) DeleteRefreshToken(hash string) error {
+	return l.db.Where("token_hash = ?", hash).Delete(&entity.LocalRefreshToken{}).Error
+}
+
+// DeleteRefreshTokens revokes every refresh token of the identity.
+func (l *DefaultLocalIdentityRepository) DeleteRefreshTokens(identityID int) error {
+	return l.db.Where("identity_id = ?", identityID).Delete(&entity.LocalRefreshToken{}).Error
+}
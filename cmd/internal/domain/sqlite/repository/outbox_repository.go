@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"gorm.io/gorm"
+)
+
+type DefaultOutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *DefaultOutboxRepository {
+	return &DefaultOutboxRepository{db: db}
+}
+
+// Enqueue saves the new messages all at once.
+func (o *DefaultOutboxRepository) Enqueue(msgs ...*entity.OutboxMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return o.db.Create(msgs).Error
+}
+
+// FindDue returns up to limit pending messages whose next attempt is due, oldest first.
+func (o *DefaultOutboxRepository) FindDue(now int64, limit int) ([]*entity.OutboxMessage, error) {
+	var msgs []*entity.OutboxMessage
+	err := o.db.
+		Where("status = ? AND next_attempt_at <= ?", entity.OutboxPending, now).
+		Order("next_attempt_at asc, id asc").
+		Limit(limit).
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// FindByKind returns the messages of the given kind not handled yet, whether pending or failed.
+func (o *DefaultOutboxRepository) FindByKind(kind string) ([]*entity.OutboxMessage, error) {
+	var msgs []*entity.OutboxMessage
+	err := o.db.Where("kind = ?", kind).Order("id asc").Find(&msgs).Error
+	return msgs, err
+}
+
+func (o *DefaultOutboxRepository) Save(msg *entity.OutboxMessage) error {
+	return o.db.Save(msg).Error
+}
+
+func (o *DefaultOutboxRepository) Delete(id int) error {
+	return o.db.Delete(&entity.OutboxMessage{}, id).Error
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DefaultReminderRepository struct {
+	db *gorm.DB
+}
+
+func NewReminderRepository(db *gorm.DB) *DefaultReminderRepository {
+	return &DefaultReminderRepository{db: db}
+}
+
+// FindDue returns the active appointments beginning within lead from now that were not reminded
+// for this lead time yet, ordered by user and begin date. Appointments booked less than lead before
+// they begin are left out, as their user just booked them.
+func (r *DefaultReminderRepository) FindDue(lead time.Duration, now int64) ([]*entity.Appointment, error) {
+	leadMillis := lead.Milliseconds()
+	sent := r.db.Model(&entity.AppointmentReminder{}).
+		Select("1").
+		Where("appointment_reminders.appointment_id = appointments.id").
+		Where("appointment_reminders.begins_at = appointments.begins_at").
+		Where("appointment_reminders.lead_minutes = ?", int(lead/time.Minute))
+
+	var appts []*entity.Appointment
+	err := r.db.
+		Where("is_deleted = ?", false).
+		Where("begins_at > ? AND begins_at <= ?", now, now+leadMillis).
+		Where("created_at <= begins_at - ?", leadMillis).
+		Where("NOT EXISTS (?)", sent).
+		Order("user_id asc, begins_at asc").
+		Find(&appts).Error
+	return appts, err
+}
+
+// MarkReminded records that the appointment was reminded for the given lead time.
+// Marking it twice is not an error.
+func (r *DefaultReminderRepository) MarkReminded(appt *entity.Appointment, lead time.Duration) error {
+	reminder := &entity.AppointmentReminder{
+		AppointmentID: appt.ID,
+		LeadMinutes:   int(lead / time.Minute),
+		BeginsAt:      appt.BeginsAt,
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(reminder).Error
+}
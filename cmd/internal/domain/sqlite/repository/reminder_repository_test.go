@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"testing"
+	"time"
+)
+
+func TestFindDueReminders(t *testing.T) {
+	db := openTestDB(t)
+	apptRepo := NewAppointmentRepository(db)
+	repo := NewReminderRepository(db)
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+
+	due := newTestAppointment(1, 1, now.Add(20*time.Hour).UnixMilli())
+	later := newTestAppointment(1, 1, now.Add(30*time.Hour).UnixMilli())
+	cancelled := newTestAppointment(1, 1, now.Add(2*time.Hour).UnixMilli())
+	cancelled.IsDeleted = true
+	justBooked := newTestAppointment(1, 1, now.Add(5*time.Hour).UnixMilli())
+	justBooked.CreatedAt = now.Add(-time.Hour).UnixMilli()
+
+	for _, appt := range []any{due, later, cancelled, justBooked} {
+		if err := db.Create(appt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	appts, err := repo.FindDue(24*time.Hour, now.UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(appts) != 1 || appts[0].ID != due.ID {
+		t.Fatalf("FindDue() = %v, want only appointment %d", appts, due.ID)
+	}
+
+	// Marking twice is fine, and other lead times are still due
+	for range 2 {
+		if err := repo.MarkReminded(due, 24*time.Hour); err != nil {
+			t.Fatalf("MarkReminded() error = %v", err)
+		}
+	}
+
+	if appts, _ := repo.FindDue(24*time.Hour, now.UnixMilli()); len(appts) != 0 {
+		t.Errorf("FindDue() = %v after MarkReminded, want none", appts)
+	}
+
+	if appts, _ := repo.FindDue(21*time.Hour, now.UnixMilli()); len(appts) != 1 {
+		t.Errorf("FindDue() = %v for another lead time, want appointment %d", appts, due.ID)
+	}
+
+	// Moving the appointment makes it due again
+	due.BeginsAt = now.Add(22 * time.Hour).UnixMilli()
+	due.EndsAt = due.BeginsAt + time.Hour.Milliseconds() - 1
+	if _, err := apptRepo.Book([]*entity.Appointment{due}, due.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if appts, _ := repo.FindDue(24*time.Hour, now.UnixMilli()); len(appts) != 1 {
+		t.Errorf("FindDue() = %v after moving the appointment, want it again", appts)
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"errors"
+	"gorm.io/gorm"
+)
+
+type DefaultResourceRepository struct {
+	db *gorm.DB
+}
+
+func NewResourceRepository(db *gorm.DB) *DefaultResourceRepository {
+	return &DefaultResourceRepository{db: db}
+}
+
+func (r *DefaultResourceRepository) FindByID(id int) (*entity.Resource, error) {
+	var resource entity.Resource
+	err := r.db.First(&resource, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &resource, err
+}
+
+// FindAll returns every resource that was not deleted.
+func (r *DefaultResourceRepository) FindAll() ([]*entity.Resource, error) {
+	var resources []*entity.Resource
+	err := r.db.Where("is_deleted = ?", false).Find(&resources).Error
+	return resources, err
+}
+
+func (r *DefaultResourceRepository) Save(resource *entity.Resource) error {
+	return r.db.Save(resource).Error
+}
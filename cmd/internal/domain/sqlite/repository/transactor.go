@@ -0,0 +1,22 @@
+package repository
+
+import "gorm.io/gorm"
+
+// Transactor runs functions within a single transaction, giving them repositories bound to it.
+// T is whatever set of repositories the caller needs, built by bind from the transaction.
+type Transactor[T any] struct {
+	db   *gorm.DB
+	bind func(tx *gorm.DB) T
+}
+
+func NewTransactor[T any](db *gorm.DB, bind func(tx *gorm.DB) T) *Transactor[T] {
+	return &Transactor[T]{db: db, bind: bind}
+}
+
+// Transaction commits everything fn did if it returns nil, and rolls it back otherwise.
+// Repositories opening their own transactions (e.g. to book appointments) use savepoints.
+func (t *Transactor[T]) Transaction(fn func(repos T) error) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		return fn(t.bind(tx))
+	})
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type testRepos struct {
+	appts  *DefaultAppointmentRepository
+	outbox *DefaultOutboxRepository
+}
+
+func TestTransactorRollsBackOutbox(t *testing.T) {
+	db := openTestDB(t)
+	tx := NewTransactor(db, func(tx *gorm.DB) *testRepos {
+		return &testRepos{appts: NewAppointmentRepository(tx), outbox: NewOutboxRepository(tx)}
+	})
+	outbox := NewOutboxRepository(db)
+	begin := time.Date(2030, 1, 7, 14, 0, 0, 0, time.UTC).UnixMilli()
+
+	book := func(fail error) error {
+		return tx.Transaction(func(repos *testRepos) error {
+			// Booking opens its own (nested) transaction
+			_, err := repos.appts.Book([]*entity.Appointment{newTestAppointment(1, 1, begin)})
+			if err != nil {
+				return err
+			}
+
+			err = repos.outbox.Enqueue(&entity.OutboxMessage{Kind: "test", Status: entity.OutboxPending, NextAttemptAt: begin})
+			if err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	errRollback := errors.New("rollback")
+	if err := book(errRollback); !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction() = %v, want %v", err, errRollback)
+	}
+
+	var count int64
+	db.Model(&entity.Appointment{}).Count(&count)
+	msgs, _ := outbox.FindDue(begin, 10)
+	if count != 0 || len(msgs) != 0 {
+		t.Fatalf("found %d appointments and %d messages, want everything rolled back", count, len(msgs))
+	}
+
+	if err := book(nil); err != nil {
+		t.Fatalf("Transaction() = %v", err)
+	}
+
+	db.Model(&entity.Appointment{}).Count(&count)
+	msgs, _ = outbox.FindDue(begin, 10)
+	if count != 1 || len(msgs) != 1 {
+		t.Fatalf("found %d appointments and %d messages, want both committed", count, len(msgs))
+	}
+
+	// Messages are only due from their next attempt on, and gone once deleted
+	if due, _ := outbox.FindDue(begin-1, 10); len(due) != 0 {
+		t.Errorf("FindDue() = %v before the message is due", due)
+	}
+
+	if err := outbox.Delete(msgs[0].ID); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+
+	if due, _ := outbox.FindDue(begin, 10); len(due) != 0 {
+		t.Errorf("FindDue() = %v after the message was deleted", due)
+	}
+}
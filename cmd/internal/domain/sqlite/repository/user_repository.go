@@ -4,6 +4,7 @@ import (
 	"4shure/cmd/internal/domain/entity"
 	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DefaultUserRepository struct {
@@ -16,22 +17,23 @@ func NewUserRepository(db *gorm.DB) *DefaultUserRepository {
 
 func (u *DefaultUserRepository) FindByID(id int) (*entity.User, error) {
 	var user entity.User
-	err := u.db.First(&user, id).Error
+	err := u.withPermissions().First(&user, id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &user, err
 }
 
+// FindAll finds every user, except the deleted ones.
 func (u *DefaultUserRepository) FindAll() ([]*entity.User, error) {
 	var users []*entity.User
-	err := u.db.Find(&users).Error
+	err := u.withPermissions().Where("is_deleted = ?", false).Find(&users).Error
 	return users, err
 }
 
 func (u *DefaultUserRepository) FindBySub(sub string) (*entity.User, error) {
 	var user entity.User
-	err := u.db.Where("sub_uuid = ?", sub).First(&user).Error
+	err := u.withPermissions().Where("sub_uuid = ?", sub).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -40,7 +42,7 @@ func (u *DefaultUserRepository) FindBySub(sub string) (*entity.User, error) {
 
 func (u *DefaultUserRepository) FindByEmail(email string) (*entity.User, error) {
 	var user entity.User
-	err := u.db.Where("email = ?", email).First(&user).Error
+	err := u.withPermissions().Where("email = ?", email).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -58,6 +60,36 @@ func (u *DefaultUserRepository) ExistsByEmail(email string) (bool, error) {
 	return exists == 1, nil
 }
 
+// Save saves the user, but not their permissions, see GrantPermission and RevokePermission.
 func (u *DefaultUserRepository) Save(user *entity.User) error {
-	return u.db.Save(user).Error
+	return u.db.Omit(clause.Associations).Save(user).Error
+}
+
+func (u *DefaultUserRepository) GrantPermission(permission *entity.UserPermission) error {
+	return u.db.Create(permission).Error
+}
+
+// RevokePermission removes a granted permission, and tells whether the user had it.
+func (u *DefaultUserRepository) RevokePermission(userID int, permission string) (bool, error) {
+	result := u.db.
+		Where("user_id = ? AND permission = ?", userID, permission).
+		Delete(&entity.UserPermission{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Anonymise saves the (already anonymised) user and removes every permission granted to them.
+func (u *DefaultUserRepository) Anonymise(user *entity.User) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", user.ID).Delete(&entity.UserPermission{}).Error
+		if err != nil {
+			return err
+		}
+
+		user.Permissions = nil
+		return tx.Omit(clause.Associations).Save(user).Error
+	})
+}
+
+func (u *DefaultUserRepository) withPermissions() *gorm.DB {
+	return u.db.Preload("Permissions")
 }
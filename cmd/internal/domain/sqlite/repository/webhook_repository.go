@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DefaultWebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *DefaultWebhookRepository {
+	return &DefaultWebhookRepository{db: db}
+}
+
+func (w *DefaultWebhookRepository) FindByID(id int) (*entity.Webhook, error) {
+	var webhook entity.Webhook
+	err := w.db.First(&webhook, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &webhook, err
+}
+
+// FindAll returns every webhook that was not deleted.
+func (w *DefaultWebhookRepository) FindAll() ([]*entity.Webhook, error) {
+	var webhooks []*entity.Webhook
+	err := w.db.Where("is_deleted = ?", false).Order("id asc").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// FindActive returns every webhook that is active and was not deleted.
+func (w *DefaultWebhookRepository) FindActive() ([]*entity.Webhook, error) {
+	var webhooks []*entity.Webhook
+	err := w.db.Where("is_active = ? AND is_deleted = ?", true, false).Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (w *DefaultWebhookRepository) Save(webhook *entity.Webhook) error {
+	return w.db.Save(webhook).Error
+}
+
+func (w *DefaultWebhookRepository) FindDelivery(id int) (*entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := w.db.First(&delivery, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &delivery, err
+}
+
+// FindDeliveries returns the latest deliveries of the webhook, up to limit.
+func (w *DefaultWebhookRepository) FindDeliveries(webhookID, limit int) ([]*entity.WebhookDelivery, error) {
+	var deliveries []*entity.WebhookDelivery
+	err := w.db.Where("webhook_id = ?", webhookID).Order("id desc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// FindDueDeliveries returns up to limit pending deliveries whose next attempt is due, oldest first.
+func (w *DefaultWebhookRepository) FindDueDeliveries(now int64, limit int) ([]*entity.WebhookDelivery, error) {
+	var deliveries []*entity.WebhookDelivery
+	err := w.db.
+		Where("status = ? AND next_attempt_at <= ?", entity.DeliveryPending, now).
+		Order("next_attempt_at asc, id asc").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// CreateDeliveries saves the new deliveries all at once, skipping the events a webhook already got.
+func (w *DefaultWebhookRepository) CreateDeliveries(deliveries []*entity.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return w.db.Clauses(clause.OnConflict{DoNothing: true}).Create(deliveries).Error
+}
+
+func (w *DefaultWebhookRepository) SaveDelivery(delivery *entity.WebhookDelivery) error {
+	return w.db.Save(delivery).Error
+}
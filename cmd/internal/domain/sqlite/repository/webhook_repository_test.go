@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"testing"
+)
+
+func TestCreateDeliveriesSkipsPublishedEvents(t *testing.T) {
+	repo := NewWebhookRepository(openTestDB(t))
+
+	delivery := func(webhookID int, eventID string, replayOf int) *entity.WebhookDelivery {
+		return &entity.WebhookDelivery{WebhookID: webhookID, EventID: eventID, EventType: "user.verified", Payload: "{}", Status: entity.DeliveryPending, ReplayOf: replayOf}
+	}
+
+	if err := repo.CreateDeliveries([]*entity.WebhookDelivery{delivery(1, "evt_1", 0), delivery(2, "evt_1", 0)}); err != nil {
+		t.Fatalf("CreateDeliveries() error = %v", err)
+	}
+
+	// The same event published again only reaches the webhooks it did not reach yet
+	if err := repo.CreateDeliveries([]*entity.WebhookDelivery{delivery(1, "evt_1", 0), delivery(3, "evt_1", 0)}); err != nil {
+		t.Fatalf("CreateDeliveries() error = %v for a published event", err)
+	}
+
+	// Replays share the event ID of the delivery they replay
+	if err := repo.CreateDeliveries([]*entity.WebhookDelivery{delivery(1, "evt_1", 1)}); err != nil {
+		t.Fatalf("CreateDeliveries() error = %v for a replay", err)
+	}
+
+	deliveries, err := repo.FindDeliveries(1, 10)
+	if err != nil || len(deliveries) != 2 {
+		t.Errorf("FindDeliveries() = %d deliveries, %v, want the original and its replay", len(deliveries), err)
+	}
+
+	if deliveries, _ := repo.FindDeliveries(3, 10); len(deliveries) != 1 {
+		t.Errorf("FindDeliveries() = %d deliveries, want one for the webhook added later", len(deliveries))
+	}
+}
@@ -3,6 +3,7 @@ package cognitoclient
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -28,10 +29,45 @@ type UserLogin struct {
 	Password string
 }
 
+// PasswordReset is used to set a new password with the code sent by ForgotPassword.
+type PasswordReset struct {
+	Email    string
+	Code     string
+	Password string
+}
+
+// PasswordChange is used by signed-in users to change their password.
+type PasswordChange struct {
+	AccessToken      string
+	PreviousPassword string
+	ProposedPassword string
+}
+
+// PoolUser is a user of the pool, as listed by AdminListUsers and AdminGetUser.
+type PoolUser struct {
+	Sub     string
+	Email   string
+	Status  string // e.g. "CONFIRMED", see types.UserStatusType
+	Enabled bool
+
+	// EmailVerified tells whether the user confirmed their account, and verified their
+	// current e-mail if they changed it since.
+	EmailVerified bool
+
+	CreatedAt time.Time
+}
+
+// Confirmed tells whether the user confirmed their account, including the ones asked
+// to reset their password since.
+func (u *PoolUser) Confirmed() bool {
+	return u.Status == string(types.UserStatusTypeConfirmed) || u.Status == string(types.UserStatusTypeResetRequired)
+}
+
 // AuthCreate represents the response of Cognito sign in approval.
 type AuthCreate struct {
-	IDToken     string
-	AccessToken string
+	IDToken      string
+	AccessToken  string
+	RefreshToken string
 }
 
 type CognitoInterface interface {
@@ -44,9 +80,16 @@ type CognitoInterface interface {
 	// SignUp creates a new user row on Cognito and return its "sub" (the UUID).
 	SignUp(user *User) (string, error)
 
-	// SignIn signs the user in and returns its respective access and ID tokens.
+	// SignIn signs the user in and returns its respective access, ID and refresh tokens.
 	SignIn(user *UserLogin) (*AuthCreate, error)
 
+	// RefreshTokens issues new access and ID tokens from a refresh token (REFRESH_TOKEN_AUTH flow).
+	// The refresh token is only returned when the pool rotates them, otherwise the same one is kept.
+	RefreshTokens(refreshToken string) (*AuthCreate, error)
+
+	// RevokeToken revokes a refresh token, and the access and ID tokens issued from it.
+	RevokeToken(refreshToken string) error
+
 	// GlobalSignOut signs out all the user session in all devices.
 	// In other words, it invalidates all the existing JWT tokens.
 	GlobalSignOut(accessToken string) error
@@ -57,6 +100,22 @@ type CognitoInterface interface {
 	// ResendConfirmation resends the verification code to the provided e-mail.
 	ResendConfirmation(email string) error
 
+	// ForgotPassword sends a code to the provided e-mail, to be used with ConfirmForgotPassword.
+	ForgotPassword(email string) error
+
+	// ConfirmForgotPassword sets a new password using the code sent by ForgotPassword.
+	ConfirmForgotPassword(reset *PasswordReset) error
+
+	// ChangePassword changes the password of the user behind the access token.
+	ChangePassword(change *PasswordChange) error
+
+	// UpdateEmail changes the e-mail of the user behind the access token. A code is sent
+	// to the new address, to be used with VerifyEmail.
+	UpdateEmail(accessToken, email string) error
+
+	// VerifyEmail verifies the new e-mail of the user behind the access token, see UpdateEmail.
+	VerifyEmail(accessToken, code string) error
+
 	//==========================//
 	//                          //
 	//     Admin Operations     //
@@ -65,6 +124,13 @@ type CognitoInterface interface {
 
 	// AdminDeleteUser deletes a user by their email on behalf of the application.
 	AdminDeleteUser(email string) error
+
+	// AdminListUsers lists the users of the pool, one page at a time. The first page is
+	// fetched with an empty token, and the last one comes with an empty next token.
+	AdminListUsers(paginationToken string) (users []*PoolUser, nextToken string, err error)
+
+	// AdminGetUser finds a user by their email on behalf of the application.
+	AdminGetUser(email string) (*PoolUser, error)
 }
 
 type cognitoClient struct {
@@ -136,6 +202,60 @@ func (c *cognitoClient) ResendConfirmation(email string) error {
 	return err
 }
 
+func (c *cognitoClient) ForgotPassword(email string) error {
+	input := &cognitoidentityprovider.ForgotPasswordInput{
+		Username: aws.String(email),
+		ClientId: aws.String(c.appClientId),
+	}
+	_, err := c.cognitoClient.ForgotPassword(context.Background(), input)
+	return err
+}
+
+func (c *cognitoClient) ConfirmForgotPassword(reset *PasswordReset) error {
+	input := &cognitoidentityprovider.ConfirmForgotPasswordInput{
+		Username:         aws.String(reset.Email),
+		ConfirmationCode: aws.String(reset.Code),
+		Password:         aws.String(reset.Password),
+		ClientId:         aws.String(c.appClientId),
+	}
+	_, err := c.cognitoClient.ConfirmForgotPassword(context.Background(), input)
+	return err
+}
+
+func (c *cognitoClient) ChangePassword(change *PasswordChange) error {
+	input := &cognitoidentityprovider.ChangePasswordInput{
+		AccessToken:      aws.String(change.AccessToken),
+		PreviousPassword: aws.String(change.PreviousPassword),
+		ProposedPassword: aws.String(change.ProposedPassword),
+	}
+	_, err := c.cognitoClient.ChangePassword(context.Background(), input)
+	return err
+}
+
+func (c *cognitoClient) UpdateEmail(accessToken, email string) error {
+	input := &cognitoidentityprovider.UpdateUserAttributesInput{
+		AccessToken: aws.String(accessToken),
+		UserAttributes: []types.AttributeType{
+			{
+				Name:  aws.String("email"),
+				Value: aws.String(email),
+			},
+		},
+	}
+	_, err := c.cognitoClient.UpdateUserAttributes(context.Background(), input)
+	return err
+}
+
+func (c *cognitoClient) VerifyEmail(accessToken, code string) error {
+	input := &cognitoidentityprovider.VerifyUserAttributeInput{
+		AccessToken:   aws.String(accessToken),
+		AttributeName: aws.String("email"),
+		Code:          aws.String(code),
+	}
+	_, err := c.cognitoClient.VerifyUserAttribute(context.Background(), input)
+	return err
+}
+
 func (c *cognitoClient) SignIn(user *UserLogin) (*AuthCreate, error) {
 	input := &cognitoidentityprovider.InitiateAuthInput{
 		AuthFlow: types.AuthFlowTypeUserPasswordAuth,
@@ -150,11 +270,40 @@ func (c *cognitoClient) SignIn(user *UserLogin) (*AuthCreate, error) {
 		return nil, err
 	}
 	return &AuthCreate{
-		IDToken:     *result.AuthenticationResult.IdToken,
-		AccessToken: *result.AuthenticationResult.AccessToken,
+		IDToken:      *result.AuthenticationResult.IdToken,
+		AccessToken:  *result.AuthenticationResult.AccessToken,
+		RefreshToken: aws.ToString(result.AuthenticationResult.RefreshToken),
 	}, nil
 }
 
+func (c *cognitoClient) RefreshTokens(refreshToken string) (*AuthCreate, error) {
+	input := &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow: types.AuthFlowTypeRefreshTokenAuth,
+		AuthParameters: map[string]string{
+			"REFRESH_TOKEN": refreshToken,
+		},
+		ClientId: aws.String(c.appClientId),
+	}
+	result, err := c.cognitoClient.InitiateAuth(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthCreate{
+		IDToken:      aws.ToString(result.AuthenticationResult.IdToken),
+		AccessToken:  aws.ToString(result.AuthenticationResult.AccessToken),
+		RefreshToken: aws.ToString(result.AuthenticationResult.RefreshToken),
+	}, nil
+}
+
+func (c *cognitoClient) RevokeToken(refreshToken string) error {
+	input := &cognitoidentityprovider.RevokeTokenInput{
+		Token:    aws.String(refreshToken),
+		ClientId: aws.String(c.appClientId),
+	}
+	_, err := c.cognitoClient.RevokeToken(context.Background(), input)
+	return err
+}
+
 func (c *cognitoClient) AdminDeleteUser(email string) error {
 	input := &cognitoidentityprovider.AdminDeleteUserInput{
 		UserPoolId: aws.String(c.poolId),
@@ -163,3 +312,62 @@ func (c *cognitoClient) AdminDeleteUser(email string) error {
 	_, err := c.cognitoClient.AdminDeleteUser(context.Background(), input)
 	return err
 }
+
+// listUsersLimit is the largest page ListUsers allows.
+const listUsersLimit = 60
+
+func (c *cognitoClient) AdminListUsers(paginationToken string) ([]*PoolUser, string, error) {
+	input := &cognitoidentityprovider.ListUsersInput{
+		UserPoolId: aws.String(c.poolId),
+		Limit:      aws.Int32(listUsersLimit),
+	}
+	if paginationToken != "" {
+		input.PaginationToken = aws.String(paginationToken)
+	}
+
+	out, err := c.cognitoClient.ListUsers(context.Background(), input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	users := make([]*PoolUser, len(out.Users))
+	for i, user := range out.Users {
+		users[i] = toPoolUser(user.Attributes, user.UserStatus, user.Enabled, user.UserCreateDate)
+	}
+	return users, aws.ToString(out.PaginationToken), nil
+}
+
+func (c *cognitoClient) AdminGetUser(email string) (*PoolUser, error) {
+	input := &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: aws.String(c.poolId),
+		Username:   aws.String(email),
+	}
+
+	out, err := c.cognitoClient.AdminGetUser(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+	return toPoolUser(out.UserAttributes, out.UserStatus, out.Enabled, out.UserCreateDate), nil
+}
+
+// toPoolUser maps the attributes of a user. Users confirmed by an admin (e.g. in the AWS console)
+// have no email_verified attribute, while it is "false" for a changed e-mail not verified yet.
+func toPoolUser(attrs []types.AttributeType, status types.UserStatusType, enabled bool, createdAt *time.Time) *PoolUser {
+	user := &PoolUser{Status: string(status), Enabled: enabled, CreatedAt: aws.ToTime(createdAt)}
+
+	verified := ""
+	for _, attr := range attrs {
+		switch aws.ToString(attr.Name) {
+		case "sub":
+			user.Sub = aws.ToString(attr.Value)
+		case "email":
+			user.Email = aws.ToString(attr.Value)
+		case "email_verified":
+			verified = aws.ToString(attr.Value)
+		}
+	}
+
+	confirmed := status == types.UserStatusTypeConfirmed || status == types.UserStatusTypeResetRequired
+	user.EmailVerified = confirmed && verified != "false"
+	return user
+}
@@ -0,0 +1,415 @@
+// Package cognitotest provides an in-memory CognitoInterface for tests.
+package cognitotest
+
+import (
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// Fake is an in-memory CognitoInterface. It keeps just enough state to behave like a user
+// pool (sign up, confirm, sign in...), and returns the same smithy.APIError codes as Cognito.
+// Any call can also be made to fail with a given error, see Fail.
+type Fake struct {
+	mu      sync.Mutex
+	users   map[string]*User  // By email
+	refresh map[string]string // Emails by refresh token
+	errors  map[string]error  // By method name
+	calls   map[string]int    // By method name
+	nextID  int
+}
+
+// User is a user of the fake pool.
+type User struct {
+	Sub       string
+	Password  string
+	Confirmed bool
+
+	// EmailUnverified is set when the user changes their e-mail, until they verify it.
+	EmailUnverified bool
+
+	// Disabled users are still listed, see AdminListUsers.
+	Disabled  bool
+	CreatedAt time.Time
+
+	// Code is the last code sent to the user, to confirm their account or reset their password.
+	Code string
+
+	// SignedOut tells whether GlobalSignOut was called for the user.
+	SignedOut bool
+}
+
+var _ cognitoclient.CognitoInterface = (*Fake)(nil)
+
+func New() *Fake {
+	return &Fake{
+		users:   make(map[string]*User),
+		refresh: make(map[string]string),
+		errors:  make(map[string]error),
+		calls:   make(map[string]int),
+	}
+}
+
+// APIError builds an error like the ones returned by Cognito, e.g. APIError("CodeMismatchException").
+func APIError(code string) error {
+	return &smithy.GenericAPIError{Code: code, Message: code, Fault: smithy.FaultClient}
+}
+
+// Fail makes every following call of the method (e.g. "SignUp") return the error.
+func (f *Fake) Fail(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[method] = err
+}
+
+// FailWith is a shortcut for Fail with an APIError.
+func (f *Fake) FailWith(method, code string) {
+	f.Fail(method, APIError(code))
+}
+
+// Calls tells how many times the method was called.
+func (f *Fake) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// AddUser adds a user to the pool, as if they signed up.
+func (f *Fake) AddUser(email string, user *User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[email] = user
+}
+
+// User returns the user with the given email, or nil.
+func (f *Fake) User(email string) *User {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.users[email]
+}
+
+// call records the call, and returns the error injected for the method if any.
+// The caller must hold the lock.
+func (f *Fake) call(method string) error {
+	f.calls[method]++
+	return f.errors[method]
+}
+
+func (f *Fake) SignUp(user *cognitoclient.User) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("SignUp"); err != nil {
+		return "", err
+	}
+
+	if _, ok := f.users[user.Email]; ok {
+		return "", APIError("UsernameExistsException")
+	}
+
+	f.nextID++
+	sub := fmt.Sprintf("00000000-0000-4000-8000-%012d", f.nextID)
+	f.users[user.Email] = &User{Sub: sub, Password: user.Password, Code: "123456"}
+	return sub, nil
+}
+
+func (f *Fake) SignIn(user *cognitoclient.UserLogin) (*cognitoclient.AuthCreate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("SignIn"); err != nil {
+		return nil, err
+	}
+
+	found, ok := f.users[user.Email]
+	if !ok {
+		return nil, APIError("UserNotFoundException")
+	}
+
+	if found.Password != user.Password {
+		return nil, APIError("NotAuthorizedException")
+	}
+
+	if !found.Confirmed {
+		return nil, APIError("UserNotConfirmedException")
+	}
+
+	found.SignedOut = false
+	f.nextID++
+	refreshToken := fmt.Sprintf("refresh-%s-%d", found.Sub, f.nextID)
+	f.refresh[refreshToken] = user.Email
+	return &cognitoclient.AuthCreate{
+		IDToken:      "id-" + found.Sub,
+		AccessToken:  "access-" + found.Sub,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (f *Fake) RefreshTokens(refreshToken string) (*cognitoclient.AuthCreate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RefreshTokens"); err != nil {
+		return nil, err
+	}
+
+	found, ok := f.users[f.refresh[refreshToken]]
+	if !ok {
+		return nil, APIError("NotAuthorizedException")
+	}
+
+	// Like a pool without rotation, the refresh token is not returned
+	return &cognitoclient.AuthCreate{
+		IDToken:     "id-" + found.Sub,
+		AccessToken: "access-" + found.Sub,
+	}, nil
+}
+
+func (f *Fake) RevokeToken(refreshToken string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RevokeToken"); err != nil {
+		return err
+	}
+
+	delete(f.refresh, refreshToken)
+	return nil
+}
+
+func (f *Fake) GlobalSignOut(accessToken string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("GlobalSignOut"); err != nil {
+		return err
+	}
+
+	for email, user := range f.users {
+		if "access-"+user.Sub == accessToken {
+			user.SignedOut = true
+			for token, owner := range f.refresh {
+				if owner == email {
+					delete(f.refresh, token)
+				}
+			}
+			return nil
+		}
+	}
+	return APIError("NotAuthorizedException")
+}
+
+func (f *Fake) ConfirmAccount(user *cognitoclient.UserConfirmation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ConfirmAccount"); err != nil {
+		return err
+	}
+
+	found, ok := f.users[user.Email]
+	if !ok {
+		return APIError("UserNotFoundException")
+	}
+
+	if found.Confirmed {
+		return APIError("NotAuthorizedException")
+	}
+
+	if found.Code != user.Code {
+		return APIError("CodeMismatchException")
+	}
+
+	found.Confirmed = true
+	return nil
+}
+
+func (f *Fake) ResendConfirmation(email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ResendConfirmation"); err != nil {
+		return err
+	}
+
+	found, ok := f.users[email]
+	if !ok {
+		return APIError("UserNotFoundException")
+	}
+
+	if found.Confirmed {
+		return APIError("InvalidParameterException")
+	}
+	return nil
+}
+
+func (f *Fake) ForgotPassword(email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ForgotPassword"); err != nil {
+		return err
+	}
+
+	found, ok := f.users[email]
+	if !ok {
+		return APIError("UserNotFoundException")
+	}
+
+	if !found.Confirmed {
+		return APIError("InvalidParameterException")
+	}
+
+	found.Code = "654321"
+	return nil
+}
+
+func (f *Fake) ConfirmForgotPassword(reset *cognitoclient.PasswordReset) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ConfirmForgotPassword"); err != nil {
+		return err
+	}
+
+	found, ok := f.users[reset.Email]
+	if !ok {
+		return APIError("UserNotFoundException")
+	}
+
+	if found.Code != reset.Code {
+		return APIError("CodeMismatchException")
+	}
+
+	found.Password = reset.Password
+	found.Code = ""
+	return nil
+}
+
+func (f *Fake) ChangePassword(change *cognitoclient.PasswordChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ChangePassword"); err != nil {
+		return err
+	}
+
+	_, found := f.byAccessToken(change.AccessToken)
+	if found == nil || found.Password != change.PreviousPassword {
+		return APIError("NotAuthorizedException")
+	}
+
+	found.Password = change.ProposedPassword
+	return nil
+}
+
+func (f *Fake) UpdateEmail(accessToken, email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("UpdateEmail"); err != nil {
+		return err
+	}
+
+	previous, found := f.byAccessToken(accessToken)
+	if found == nil {
+		return APIError("NotAuthorizedException")
+	}
+
+	if _, ok := f.users[email]; ok {
+		return APIError("AliasExistsException")
+	}
+
+	delete(f.users, previous)
+	f.users[email] = found
+	found.Code = "123456"
+	found.EmailUnverified = true
+	return nil
+}
+
+func (f *Fake) VerifyEmail(accessToken, code string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("VerifyEmail"); err != nil {
+		return err
+	}
+
+	_, found := f.byAccessToken(accessToken)
+	if found == nil {
+		return APIError("NotAuthorizedException")
+	}
+
+	if found.Code != code {
+		return APIError("CodeMismatchException")
+	}
+
+	found.Code = ""
+	found.EmailUnverified = false
+	return nil
+}
+
+// byAccessToken finds the user the access token was issued to. The caller must hold the lock.
+func (f *Fake) byAccessToken(accessToken string) (string, *User) {
+	for email, user := range f.users {
+		if "access-"+user.Sub == accessToken && !user.SignedOut {
+			return email, user
+		}
+	}
+	return "", nil
+}
+
+func (f *Fake) AdminDeleteUser(email string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("AdminDeleteUser"); err != nil {
+		return err
+	}
+
+	if _, ok := f.users[email]; !ok {
+		return APIError("UserNotFoundException")
+	}
+
+	delete(f.users, email)
+	return nil
+}
+
+// AdminListUsers lists every user at once, by email.
+func (f *Fake) AdminListUsers(paginationToken string) ([]*cognitoclient.PoolUser, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("AdminListUsers"); err != nil {
+		return nil, "", err
+	}
+
+	users := make([]*cognitoclient.PoolUser, 0, len(f.users))
+	for email, user := range f.users {
+		users = append(users, toPoolUser(email, user))
+	}
+
+	slices.SortFunc(users, func(a, b *cognitoclient.PoolUser) int { return strings.Compare(a.Email, b.Email) })
+	return users, "", nil
+}
+
+func (f *Fake) AdminGetUser(email string) (*cognitoclient.PoolUser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("AdminGetUser"); err != nil {
+		return nil, err
+	}
+
+	user, ok := f.users[email]
+	if !ok {
+		return nil, APIError("UserNotFoundException")
+	}
+	return toPoolUser(email, user), nil
+}
+
+func toPoolUser(email string, user *User) *cognitoclient.PoolUser {
+	status := "UNCONFIRMED"
+	if user.Confirmed {
+		status = "CONFIRMED"
+	}
+
+	return &cognitoclient.PoolUser{
+		Sub:           user.Sub,
+		Email:         email,
+		Status:        status,
+		Enabled:       !user.Disabled,
+		EmailVerified: user.Confirmed && !user.EmailUnverified,
+		CreatedAt:     user.CreatedAt,
+	}
+}
@@ -0,0 +1,56 @@
+package localidp
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// CodeSender delivers the codes generated by the local identity provider.
+type CodeSender interface {
+	SendCode(email, purpose, code string) error
+}
+
+// LogSender writes codes to the log, which is enough for local development.
+type LogSender struct{}
+
+func (LogSender) SendCode(email, purpose, code string) error {
+	log.Infof("[local-idp] code for %s to %s: %s", email, purpose, code)
+	return nil
+}
+
+// FileSender appends codes to a local mail sink file, e.g. for tests that need to read them,
+// and writes them to the log as well.
+type FileSender struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileSender) SendCode(email, purpose, code string) error {
+	_ = LogSender{}.SendCode(email, purpose, code)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: Your code to %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC1123Z), email, purpose, code)
+	return err
+}
+
+// NewCodeSender writes codes to the given mail file, or only to the log if there is none.
+func NewCodeSender(mailFile string) CodeSender {
+	if mailFile == "" {
+		return LogSender{}
+	}
+	return &FileSender{Path: mailFile}
+}
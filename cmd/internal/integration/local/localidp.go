@@ -0,0 +1,643 @@
+package localidp
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type IdentityRepository interface {
+	FindByID(id int) (*entity.LocalIdentity, error)
+	FindByEmail(email string) (*entity.LocalIdentity, error)
+	FindBySub(sub string) (*entity.LocalIdentity, error)
+	FindAfter(id, limit int) ([]*entity.LocalIdentity, error)
+	Save(identity *entity.LocalIdentity) error
+	Delete(identity *entity.LocalIdentity) error
+	SaveRefreshToken(token *entity.LocalRefreshToken) error
+	FindRefreshToken(hash string) (*entity.LocalRefreshToken, error)
+	DeleteRefreshToken(hash string) error
+	DeleteRefreshTokens(identityID int) error
+}
+
+const (
+	// listUsersLimit is the page size of AdminListUsers, the same as Cognito's largest page.
+	listUsersLimit = 60
+
+	// maxCodeAttempts is how many wrong codes invalidate the pending one, see checkCode.
+	maxCodeAttempts = 5
+)
+
+// Config describes the local identity provider. See ConfigFromEnv for the defaults.
+type Config struct {
+	// KeyFile is where the RSA key signing the tokens is kept. It is generated if missing.
+	KeyFile string
+
+	Issuer   string
+	ClientID string
+
+	TokenTTL   time.Duration
+	RefreshTTL time.Duration
+	CodeTTL    time.Duration
+
+	// MailFile is where confirmation codes are written, in addition to the log. Optional.
+	MailFile string
+}
+
+// ConfigFromEnv reads the LOCAL_IDP_* variables, falling back to sensible defaults for local development.
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		KeyFile:    envOr("LOCAL_IDP_KEY_FILE", "./local_idp_key.pem"),
+		Issuer:     envOr("LOCAL_IDP_ISSUER", "http://localhost:6060/local-idp"),
+		ClientID:   envOr("LOCAL_IDP_CLIENT_ID", "local"),
+		TokenTTL:   time.Hour,
+		RefreshTTL: 30 * 24 * time.Hour,
+		CodeTTL:    24 * time.Hour,
+		MailFile:   os.Getenv("LOCAL_IDP_MAIL_FILE"),
+	}
+
+	for name, target := range map[string]*time.Duration{
+		"LOCAL_IDP_TOKEN_TTL":   &config.TokenTTL,
+		"LOCAL_IDP_REFRESH_TTL": &config.RefreshTTL,
+		"LOCAL_IDP_CODE_TTL":    &config.CodeTTL,
+	} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", name, raw)
+		}
+		*target = parsed
+	}
+	return config, nil
+}
+
+// Provider is an identity provider that keeps everything in our own database. It implements
+// the same interface as the Cognito client, including its error codes, so that it can stand
+// in for Cognito when running offline or in CI.
+type Provider struct {
+	repo   IdentityRepository
+	config *Config
+	codes  CodeSender
+	key    *rsa.PrivateKey
+	kid    string
+}
+
+var _ cognitoclient.CognitoInterface = (*Provider)(nil)
+
+func NewProvider(repo IdentityRepository, config *Config, codes CodeSender) (*Provider, error) {
+	key, err := loadOrCreateKey(config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		repo:   repo,
+		config: config,
+		codes:  codes,
+		key:    key,
+		kid:    keyID(&key.PublicKey),
+	}, nil
+}
+
+func (p *Provider) SignUp(user *cognitoclient.User) (string, error) {
+	existing, err := p.repo.FindByEmail(user.Email)
+	if err != nil {
+		return "", err
+	}
+
+	if existing != nil {
+		return "", apiError("UsernameExistsException", "An account with the given email already exists.")
+	}
+
+	sub, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	identity := &entity.LocalIdentity{Sub: sub, Email: user.Email}
+	err = p.setPassword(identity, user.Password)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.sendCode(identity, &identity.SignupCode, "confirm your account")
+	if err != nil {
+		return "", err
+	}
+	return sub, nil
+}
+
+func (p *Provider) SignIn(user *cognitoclient.UserLogin) (*cognitoclient.AuthCreate, error) {
+	identity, err := p.repo.FindByEmail(user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return nil, apiError("UserNotFoundException", "User does not exist.")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(identity.PasswordHash), []byte(user.Password))
+	if err != nil {
+		return nil, apiError("NotAuthorizedException", "Incorrect username or password.")
+	}
+
+	if !identity.Confirmed {
+		return nil, apiError("UserNotConfirmedException", "User is not confirmed.")
+	}
+
+	auth, err := p.issueTokens(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.repo.SaveRefreshToken(&entity.LocalRefreshToken{
+		IdentityID: identity.ID,
+		TokenHash:  hashToken(refresh),
+		ExpiresAt:  time.Now().Add(p.config.RefreshTTL).UnixMilli(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auth.RefreshToken = refresh
+	return auth, nil
+}
+
+// RefreshTokens issues new ID and access tokens from a refresh token, like
+// Cognito's REFRESH_TOKEN_AUTH flow. The refresh token itself is kept.
+func (p *Provider) RefreshTokens(refreshToken string) (*cognitoclient.AuthCreate, error) {
+	stored, err := p.repo.FindRefreshToken(hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if stored == nil || stored.ExpiresAt < time.Now().UnixMilli() {
+		return nil, apiError("NotAuthorizedException", "Invalid Refresh Token.")
+	}
+
+	identity, err := p.repo.FindByID(stored.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return nil, apiError("NotAuthorizedException", "Invalid Refresh Token.")
+	}
+	return p.issueTokens(identity)
+}
+
+// RevokeToken revokes a refresh token. Like Cognito, unknown tokens are not an error.
+func (p *Provider) RevokeToken(refreshToken string) error {
+	return p.repo.DeleteRefreshToken(hashToken(refreshToken))
+}
+
+func (p *Provider) GlobalSignOut(accessToken string) error {
+	identity, err := p.identityFromAccessToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	identity.SignedOutAt = time.Now().UnixMilli()
+	err = p.repo.Save(identity)
+	if err != nil {
+		return err
+	}
+	return p.repo.DeleteRefreshTokens(identity.ID)
+}
+
+func (p *Provider) ConfirmAccount(user *cognitoclient.UserConfirmation) error {
+	identity, err := p.repo.FindByEmail(user.Email)
+	if err != nil {
+		return err
+	}
+
+	if identity == nil {
+		return apiError("UserNotFoundException", "Username/client id combination not found.")
+	}
+
+	if identity.Confirmed {
+		return apiError("NotAuthorizedException", "User cannot be confirmed. Current status is CONFIRMED")
+	}
+
+	err = p.checkCode(identity, &identity.SignupCode, user.Code)
+	if err != nil {
+		return err
+	}
+
+	identity.Confirmed = true
+	return p.repo.Save(identity)
+}
+
+func (p *Provider) ResendConfirmation(email string) error {
+	identity, err := p.repo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if identity == nil {
+		return apiError("UserNotFoundException", "Username/client id combination not found.")
+	}
+
+	if identity.Confirmed {
+		return apiError("InvalidParameterException", "User is already confirmed.")
+	}
+	return p.sendCode(identity, &identity.SignupCode, "confirm your account")
+}
+
+func (p *Provider) ForgotPassword(email string) error {
+	identity, err := p.repo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if identity == nil {
+		return apiError("UserNotFoundException", "Username/client id combination not found.")
+	}
+
+	if !identity.Confirmed {
+		return apiError("InvalidParameterException", "Cannot reset password for the user as there is no registered/verified email.")
+	}
+	return p.sendCode(identity, &identity.ResetCode, "reset your password")
+}
+
+func (p *Provider) ConfirmForgotPassword(reset *cognitoclient.PasswordReset) error {
+	identity, err := p.repo.FindByEmail(reset.Email)
+	if err != nil {
+		return err
+	}
+
+	if identity == nil {
+		return apiError("UserNotFoundException", "Username/client id combination not found.")
+	}
+
+	// Only confirmed identities get reset codes, see ForgotPassword
+	if !identity.Confirmed {
+		return errCodeMismatch
+	}
+
+	err = p.checkCode(identity, &identity.ResetCode, reset.Code)
+	if err != nil {
+		return err
+	}
+
+	// Nothing is saved when the password is rejected, so the code can still be used
+	err = p.setPassword(identity, reset.Password)
+	if err != nil {
+		return err
+	}
+	return p.repo.Save(identity)
+}
+
+func (p *Provider) ChangePassword(change *cognitoclient.PasswordChange) error {
+	identity, err := p.identityFromAccessToken(change.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(identity.PasswordHash), []byte(change.PreviousPassword))
+	if err != nil {
+		return apiError("NotAuthorizedException", "Incorrect username or password.")
+	}
+
+	err = p.setPassword(identity, change.ProposedPassword)
+	if err != nil {
+		return err
+	}
+	return p.repo.Save(identity)
+}
+
+func (p *Provider) UpdateEmail(accessToken, email string) error {
+	identity, err := p.identityFromAccessToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.repo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil && existing.ID != identity.ID {
+		return apiError("AliasExistsException", "An account with the given email already exists.")
+	}
+
+	previous := *identity
+	identity.Email = email
+	identity.EmailUnverified = true
+	err = p.sendCode(identity, &identity.EmailCode, "verify your new email")
+	if err != nil {
+		// The new address may not even exist: keep the previous one, which our users table
+		// still has, or the user could no longer sign in
+		*identity = previous
+		if err := p.repo.Save(identity); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (p *Provider) VerifyEmail(accessToken, code string) error {
+	identity, err := p.identityFromAccessToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	err = p.checkCode(identity, &identity.EmailCode, code)
+	if err != nil {
+		return err
+	}
+
+	identity.EmailUnverified = false
+	return p.repo.Save(identity)
+}
+
+func (p *Provider) AdminDeleteUser(email string) error {
+	identity, err := p.repo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if identity == nil {
+		return apiError("UserNotFoundException", "User does not exist.")
+	}
+	return p.repo.Delete(identity)
+}
+
+// AdminListUsers lists the identities by ID, the pagination token being the last ID of the previous page.
+func (p *Provider) AdminListUsers(paginationToken string) ([]*cognitoclient.PoolUser, string, error) {
+	after := 0
+	if paginationToken != "" {
+		var err error
+		after, err = strconv.Atoi(paginationToken)
+		if err != nil {
+			return nil, "", apiError("InvalidParameterException", "Invalid pagination token.")
+		}
+	}
+
+	identities, err := p.repo.FindAfter(after, listUsersLimit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	users := make([]*cognitoclient.PoolUser, len(identities))
+	for i, identity := range identities {
+		users[i] = toPoolUser(identity)
+	}
+
+	next := ""
+	if len(identities) == listUsersLimit {
+		next = strconv.Itoa(identities[len(identities)-1].ID)
+	}
+	return users, next, nil
+}
+
+func (p *Provider) AdminGetUser(email string) (*cognitoclient.PoolUser, error) {
+	identity, err := p.repo.FindByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return nil, apiError("UserNotFoundException", "User does not exist.")
+	}
+	return toPoolUser(identity), nil
+}
+
+// Issuer is the "iss" claim of the tokens issued by the provider.
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+// ClientID is the "aud" (ID tokens) and "client_id" (access tokens) claim of the tokens issued by the provider.
+func (p *Provider) ClientID() string {
+	return p.config.ClientID
+}
+
+// JWKS returns the key set to verify the tokens issued by the provider.
+func (p *Provider) JWKS() []byte {
+	return marshalJWKS(p.kid, &p.key.PublicKey)
+}
+
+// setPassword hashes the password into the identity, without saving it.
+func (p *Provider) setPassword(identity *entity.LocalIdentity, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return apiError("InvalidPasswordException", "Password does not conform to policy.")
+	}
+
+	identity.PasswordHash = string(hash)
+	return nil
+}
+
+// sendCode saves a new code for one of the purposes of the identity (e.g. &identity.ResetCode),
+// replacing the pending one, then sends it.
+func (p *Provider) sendCode(identity *entity.LocalIdentity, pending *entity.LocalCode, purpose string) error {
+	code, err := randomCode()
+	if err != nil {
+		return err
+	}
+
+	*pending = entity.LocalCode{Value: code, ExpiresAt: time.Now().Add(p.config.CodeTTL).UnixMilli()}
+	err = p.repo.Save(identity)
+	if err != nil {
+		return err
+	}
+
+	err = p.codes.SendCode(identity.Email, purpose, code)
+	if err != nil {
+		return apiError("CodeDeliveryFailureException", err.Error())
+	}
+	return nil
+}
+
+// checkCode compares the code with the pending one of the identity, and clears the latter when they
+// match, leaving it to the caller to save the identity. Wrong codes are counted right away, and the
+// pending code is invalidated after maxCodeAttempts of them, so that it cannot be guessed.
+func (p *Provider) checkCode(identity *entity.LocalIdentity, pending *entity.LocalCode, code string) error {
+	if pending.Value == "" {
+		return errCodeMismatch
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pending.Value), []byte(code)) != 1 {
+		pending.FailedAttempts++
+		exceeded := pending.FailedAttempts >= maxCodeAttempts
+		if exceeded {
+			*pending = entity.LocalCode{}
+		}
+
+		err := p.repo.Save(identity)
+		if err != nil {
+			return err
+		}
+
+		if exceeded {
+			return apiError("LimitExceededException", "Attempt limit exceeded, please try after some time.")
+		}
+		return errCodeMismatch
+	}
+
+	if pending.ExpiresAt < time.Now().UnixMilli() {
+		return apiError("ExpiredCodeException", "Invalid code provided, please request a code again.")
+	}
+
+	*pending = entity.LocalCode{}
+	return nil
+}
+
+func (p *Provider) issueTokens(identity *entity.LocalIdentity) (*cognitoclient.AuthCreate, error) {
+	now := time.Now()
+	exp := now.Add(p.config.TokenTTL)
+
+	idToken, err := p.sign(jwt.MapClaims{
+		"sub":            identity.Sub,
+		"email":          identity.Email,
+		"email_verified": identity.Confirmed && !identity.EmailUnverified,
+		"iss":            p.config.Issuer,
+		"aud":            p.config.ClientID,
+		"token_use":      "id",
+		"auth_time":      now.Unix(),
+		"iat":            now.Unix(),
+		"exp":            exp.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := p.sign(jwt.MapClaims{
+		"sub":       identity.Sub,
+		"username":  identity.Sub,
+		"iss":       p.config.Issuer,
+		"client_id": p.config.ClientID,
+		"token_use": "access",
+		"iat":       now.Unix(),
+		"exp":       exp.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cognitoclient.AuthCreate{IDToken: idToken, AccessToken: accessToken}, nil
+}
+
+func (p *Provider) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	return token.SignedString(p.key)
+}
+
+// identityFromAccessToken verifies an access token issued by the provider and finds its identity.
+func (p *Provider) identityFromAccessToken(accessToken string) (*entity.LocalIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(*jwt.Token) (any, error) {
+		return &p.key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(p.config.Issuer), jwt.WithExpirationRequired())
+	if err != nil || claims["token_use"] != "access" {
+		return nil, apiError("NotAuthorizedException", "Invalid Access Token")
+	}
+
+	sub, _ := claims.GetSubject()
+	identity, err := p.repo.FindBySub(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return nil, apiError("NotAuthorizedException", "Invalid Access Token")
+	}
+
+	// Like Cognito, tokens issued before signing out cannot be used anymore. "iat" only has a
+	// precision of one second, so the ones of the same second are accepted (like in
+	// routes.Authenticate), or signing in again right after signing out would give tokens
+	// rejected until they expire.
+	iat, _ := claims.GetIssuedAt()
+	if iat == nil || iat.Unix() < identity.SignedOutAt/1000 {
+		return nil, apiError("NotAuthorizedException", "Access Token has been revoked")
+	}
+	return identity, nil
+}
+
+func toPoolUser(identity *entity.LocalIdentity) *cognitoclient.PoolUser {
+	status := "UNCONFIRMED"
+	if identity.Confirmed {
+		status = "CONFIRMED"
+	}
+
+	return &cognitoclient.PoolUser{
+		Sub:           identity.Sub,
+		Email:         identity.Email,
+		Status:        status,
+		Enabled:       true,
+		EmailVerified: identity.Confirmed && !identity.EmailUnverified,
+		CreatedAt:     time.UnixMilli(identity.CreatedAt).UTC(),
+	}
+}
+
+var errCodeMismatch = apiError("CodeMismatchException", "Invalid verification code provided, please try again.")
+
+func apiError(code, message string) error {
+	return &smithy.GenericAPIError{Code: code, Message: message, Fault: smithy.FaultClient}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// newUUID generates a random (version 4) UUID, like the subs of Cognito.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randomCode generates a 6-digit confirmation code.
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
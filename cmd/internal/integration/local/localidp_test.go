@@ -0,0 +1,232 @@
+package localidp
+
+import (
+	"4shure/cmd/internal/domain/sqlite"
+	"4shure/cmd/internal/domain/sqlite/repository"
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"gorm.io/gorm/logger"
+)
+
+const testPassword = "Passw0rd!"
+
+// lastCodes keeps the last code sent for each purpose.
+type lastCodes map[string]string
+
+func (l lastCodes) SendCode(email, purpose, code string) error {
+	l[purpose] = code
+	return nil
+}
+
+// failingSender fails to deliver any code.
+type failingSender struct{}
+
+func (failingSender) SendCode(email, purpose, code string) error {
+	return errors.New("mailbox unavailable")
+}
+
+func newTestProvider(t *testing.T) (*Provider, lastCodes) {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := sqlite.Open(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.Logger = logger.Discard
+
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	codes := lastCodes{}
+	cfg := &Config{
+		KeyFile:    filepath.Join(dir, "key.pem"),
+		Issuer:     "http://localhost/local-idp",
+		ClientID:   "local",
+		TokenTTL:   time.Hour,
+		RefreshTTL: time.Hour,
+		CodeTTL:    time.Hour,
+	}
+
+	p, err := NewProvider(repository.NewLocalIdentityRepository(db), cfg, codes)
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	return p, codes
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// wrong returns a code that differs from the given one.
+func wrong(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestConfirmForgotPasswordAttemptLimit(t *testing.T) {
+	p, codes := newTestProvider(t)
+	email := "user@example.com"
+	if _, err := p.SignUp(&cognitoclient.User{Email: email, Password: testPassword}); err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+
+	signupCode := codes["confirm your account"]
+	if err := p.ConfirmAccount(&cognitoclient.UserConfirmation{Email: email, Code: signupCode}); err != nil {
+		t.Fatalf("ConfirmAccount() error = %v", err)
+	}
+
+	if err := p.ForgotPassword(email); err != nil {
+		t.Fatalf("ForgotPassword() error = %v", err)
+	}
+	code := codes["reset your password"]
+
+	// Codes only serve their own purpose
+	failures := 0
+	reset := &cognitoclient.PasswordReset{Email: email, Code: signupCode, Password: "N3wPassw0rd!"}
+	if signupCode != code {
+		if err := p.ConfirmForgotPassword(reset); errorCode(err) != "CodeMismatchException" {
+			t.Fatalf("ConfirmForgotPassword() = %v with the signup code, want CodeMismatchException", err)
+		}
+		failures++
+	}
+
+	reset.Code = wrong(code)
+	for ; failures < maxCodeAttempts-1; failures++ {
+		if err := p.ConfirmForgotPassword(reset); errorCode(err) != "CodeMismatchException" {
+			t.Fatalf("ConfirmForgotPassword() = %v after %d failures, want CodeMismatchException", err, failures)
+		}
+	}
+
+	if err := p.ConfirmForgotPassword(reset); errorCode(err) != "LimitExceededException" {
+		t.Fatalf("ConfirmForgotPassword() = %v on the last attempt, want LimitExceededException", err)
+	}
+
+	// The right code does not work anymore either
+	reset.Code = code
+	if err := p.ConfirmForgotPassword(reset); errorCode(err) != "CodeMismatchException" {
+		t.Fatalf("ConfirmForgotPassword() = %v with an invalidated code, want CodeMismatchException", err)
+	}
+
+	if _, err := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: testPassword}); err != nil {
+		t.Fatalf("SignIn() error = %v, want the password unchanged", err)
+	}
+
+	// A new code starts over
+	_ = p.ForgotPassword(email)
+	reset.Code = codes["reset your password"]
+	if err := p.ConfirmForgotPassword(reset); err != nil {
+		t.Fatalf("ConfirmForgotPassword() error = %v", err)
+	}
+
+	if _, err := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: reset.Password}); err != nil {
+		t.Errorf("SignIn() error = %v with the new password", err)
+	}
+}
+
+func TestExpiredCode(t *testing.T) {
+	p, codes := newTestProvider(t)
+	p.config.CodeTTL = -time.Second
+	email := "user@example.com"
+	_, _ = p.SignUp(&cognitoclient.User{Email: email, Password: testPassword})
+
+	err := p.ConfirmAccount(&cognitoclient.UserConfirmation{Email: email, Code: codes["confirm your account"]})
+	if errorCode(err) != "ExpiredCodeException" {
+		t.Errorf("ConfirmAccount() = %v, want ExpiredCodeException", err)
+	}
+}
+
+func TestSignedOutTokens(t *testing.T) {
+	p, codes := newTestProvider(t)
+	email := "user@example.com"
+	_, _ = p.SignUp(&cognitoclient.User{Email: email, Password: testPassword})
+	_ = p.ConfirmAccount(&cognitoclient.UserConfirmation{Email: email, Code: codes["confirm your account"]})
+
+	auth, err := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+
+	if err := p.GlobalSignOut(auth.AccessToken); err != nil {
+		t.Fatalf("GlobalSignOut() error = %v", err)
+	}
+
+	// As if signed out during the second after the token was issued
+	identity, _ := p.repo.FindByEmail(email)
+	identity.SignedOutAt += 1000
+	_ = p.repo.Save(identity)
+
+	change := &cognitoclient.PasswordChange{AccessToken: auth.AccessToken, PreviousPassword: testPassword, ProposedPassword: "N3wPassw0rd!"}
+	if err := p.ChangePassword(change); errorCode(err) != "NotAuthorizedException" {
+		t.Errorf("ChangePassword() = %v with a revoked token, want NotAuthorizedException", err)
+	}
+}
+
+func TestSignInRightAfterSignOut(t *testing.T) {
+	p, codes := newTestProvider(t)
+	email := "user@example.com"
+	_, _ = p.SignUp(&cognitoclient.User{Email: email, Password: testPassword})
+	_ = p.ConfirmAccount(&cognitoclient.UserConfirmation{Email: email, Code: codes["confirm your account"]})
+
+	auth, _ := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: testPassword})
+	if err := p.GlobalSignOut(auth.AccessToken); err != nil {
+		t.Fatalf("GlobalSignOut() error = %v", err)
+	}
+
+	// Most likely within the same second as the sign out
+	auth, err := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+
+	change := &cognitoclient.PasswordChange{AccessToken: auth.AccessToken, PreviousPassword: testPassword, ProposedPassword: "N3wPassw0rd!"}
+	if err := p.ChangePassword(change); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+
+	if err := p.GlobalSignOut(auth.AccessToken); err != nil {
+		t.Fatalf("GlobalSignOut() error = %v", err)
+	}
+
+	if _, err := p.RefreshTokens(auth.RefreshToken); errorCode(err) != "NotAuthorizedException" {
+		t.Errorf("RefreshTokens() = %v after signing out, want NotAuthorizedException", err)
+	}
+}
+
+func TestUpdateEmailDeliveryFailure(t *testing.T) {
+	p, codes := newTestProvider(t)
+	email := "user@example.com"
+	_, _ = p.SignUp(&cognitoclient.User{Email: email, Password: testPassword})
+	_ = p.ConfirmAccount(&cognitoclient.UserConfirmation{Email: email, Code: codes["confirm your account"]})
+	auth, _ := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: testPassword})
+
+	p.codes = failingSender{}
+	if err := p.UpdateEmail(auth.AccessToken, "new@example.com"); errorCode(err) != "CodeDeliveryFailureException" {
+		t.Fatalf("UpdateEmail() = %v, want CodeDeliveryFailureException", err)
+	}
+
+	// The previous address is kept, verified
+	if _, err := p.SignIn(&cognitoclient.UserLogin{Email: email, Password: testPassword}); err != nil {
+		t.Errorf("SignIn() error = %v with the previous email", err)
+	}
+
+	user, err := p.AdminGetUser(email)
+	if err != nil || !user.EmailVerified {
+		t.Errorf("AdminGetUser() = %+v, %v, want the previous email still verified", user, err)
+	}
+
+	if _, err := p.SignIn(&cognitoclient.UserLogin{Email: "new@example.com", Password: testPassword}); errorCode(err) != "UserNotFoundException" {
+		t.Errorf("SignIn() = %v with the new email, want UserNotFoundException", err)
+	}
+}
@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Message is a plain text e-mail.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers e-mails, see New for the available implementations.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// Config tells which mailer to use, and how to reach it.
+type Config struct {
+	// Driver is either "smtp", "file" or "log" (the default).
+	Driver string
+
+	// From is the sender of every e-mail, e.g. "4shure <no-reply@4shure.app>".
+	From string
+
+	// SMTPAddr is the host:port of the SMTP server. The credentials are optional,
+	// e.g. for local SMTP sinks such as MailHog.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// File is where the "file" driver appends e-mails.
+	File string
+}
+
+// ConfigFromEnv reads the MAIL_* and SMTP_* variables.
+func ConfigFromEnv() *Config {
+	return &Config{
+		Driver:       envOr("MAIL_DRIVER", "log"),
+		From:         envOr("MAIL_FROM", "4shure <no-reply@localhost>"),
+		SMTPAddr:     envOr("SMTP_ADDR", "localhost:1025"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		File:         envOr("MAIL_FILE", "./mail.txt"),
+	}
+}
+
+// New returns the mailer picked by the configuration.
+func New(config *Config) (Mailer, error) {
+	switch config.Driver {
+	case "smtp":
+		return NewSMTPMailer(config.SMTPAddr, config.From, config.SMTPUsername, config.SMTPPassword)
+	case "file":
+		return &FileMailer{Path: config.File}, nil
+	case "log", "":
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.Driver)
+	}
+}
+
+// LogMailer writes e-mails to the log, which is enough for local development.
+type LogMailer struct{}
+
+func (LogMailer) Send(msg *Message) error {
+	log.Infof("[mail] to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer appends e-mails to a local mail sink file, e.g. for tests that need to read them.
+type FileMailer struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileMailer) Send(msg *Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().UTC().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// headerValue keeps a header on a single line, so that values cannot inject other headers.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// sink is a minimal SMTP server keeping the envelope and data of every e-mail it receives.
+type sink struct {
+	listener net.Listener
+	received chan string
+}
+
+func newSink(t *testing.T) *sink {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	s := &sink{listener: listener, received: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *sink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *sink) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 sink ready")
+
+	var envelope []string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250 sink")
+		case "MAIL", "RCPT":
+			envelope = append(envelope, line)
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.received <- strings.Join(envelope, "\n") + "\n\n" + string(data)
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	s := newSink(t)
+	mailer, err := NewSMTPMailer(s.listener.Addr().String(), "4shure <no-reply@4shure.test>", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mailer.Send(&Message{
+		To:      "bob@example.com",
+		Subject: "Your appointment is booked\r\nBcc: eve@example.com",
+		Body:    "Hello Bob,\n.\nSee you soon.",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := <-s.received
+	header, body, _ := strings.Cut(got, "\n\n")
+	for _, want := range []string{"MAIL FROM:<no-reply@4shure.test>", "RCPT TO:<bob@example.com>"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("envelope %q does not contain %q", header, want)
+		}
+	}
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(body))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("invalid message %q: %v", body, err)
+	}
+
+	if msg.Get("Subject") != "Your appointment is booked  Bcc: eve@example.com" || msg.Get("Bcc") != "" {
+		t.Errorf("Subject = %q, Bcc = %q, want the subject on a single line", msg.Get("Subject"), msg.Get("Bcc"))
+	}
+
+	if !strings.Contains(body, "Hello Bob,\n.\nSee you soon.") {
+		t.Errorf("body %q does not contain the message", body)
+	}
+}
+
+func TestNewSMTPMailerInvalidConfig(t *testing.T) {
+	if _, err := NewSMTPMailer("localhost", "no-reply@4shure.test", "", ""); err == nil {
+		t.Error("expected an address without port to be rejected")
+	}
+
+	if _, err := NewSMTPMailer("localhost:25", "not an address", "", ""); err == nil {
+		t.Error("expected an invalid sender to be rejected")
+	}
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "delivered", status: http.StatusNoContent, wantStatus: http.StatusNoContent},
+		{name: "server error", status: http.StatusBadGateway, wantStatus: http.StatusBadGateway, wantErr: true},
+		{name: "redirect", status: http.StatusFound, wantStatus: http.StatusFound, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var verified bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+				verified = Verify("s3cret", timestamp, body, r.Header.Get(SignatureHeader)) &&
+					r.Header.Get(EventHeader) == "appointment.created" &&
+					r.Header.Get(EventIDHeader) == "evt_1" &&
+					r.Header.Get(DeliveryHeader) == "42"
+
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			status, err := NewSender(0).Send(&Request{
+				URL:        server.URL,
+				Secret:     "s3cret",
+				EventType:  "appointment.created",
+				EventID:    "evt_1",
+				DeliveryID: 42,
+				Body:       []byte(`{"id":"evt_1"}`),
+			})
+
+			if status != tt.wantStatus || (err != nil) != tt.wantErr {
+				t.Errorf("Send() = %d, %v, want %d (error: %v)", status, err, tt.wantStatus, tt.wantErr)
+			}
+
+			if !verified {
+				t.Error("expected the request to carry a valid signature and event headers")
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	signature := Sign("s3cret", 1700000000, body)
+
+	if !Verify("s3cret", 1700000000, body, signature) {
+		t.Error("expected the signature to be valid")
+	}
+
+	if Verify("s3cret", 1700000001, body, signature) {
+		t.Error("expected another timestamp to invalidate the signature")
+	}
+
+	if Verify("other", 1700000000, body, signature) {
+		t.Error("expected another secret to invalidate the signature")
+	}
+}
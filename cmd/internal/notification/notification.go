@@ -0,0 +1,118 @@
+// Package notification tells users about their appointments: when they are booked,
+// cancelled, or about to begin.
+package notification
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	mailer "4shure/cmd/internal/integration/mail"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	Booked    Kind = "booked"
+	Cancelled Kind = "cancelled"
+	Reminder  Kind = "reminder"
+)
+
+// Event is something that happened to one or more appointments of the same user and resource,
+// e.g. the occurrences of a series booked at once.
+type Event struct {
+	Kind         Kind
+	User         *entity.User
+	Resource     *entity.Resource
+	Appointments []*entity.Appointment
+
+	// Lead is how long before the appointment a Reminder is sent.
+	Lead time.Duration
+}
+
+// MailNotifier sends events by e-mail, with dates in the business time zone.
+type MailNotifier struct {
+	mailer   mailer.Mailer
+	location *time.Location
+}
+
+func NewMailNotifier(m mailer.Mailer, location *time.Location) *MailNotifier {
+	return &MailNotifier{mailer: m, location: location}
+}
+
+func (n *MailNotifier) Notify(event *Event) error {
+	if event.User.Email == "" {
+		return fmt.Errorf("user %d has no e-mail", event.User.ID)
+	}
+	return n.mailer.Send(n.render(event))
+}
+
+func (n *MailNotifier) render(event *Event) *mailer.Message {
+	var subject, intro string
+	plural := len(event.Appointments) > 1
+	switch event.Kind {
+	case Booked:
+		subject, intro = "Your appointment is booked", "Your appointment is booked:"
+		if plural {
+			subject, intro = "Your appointments are booked", "Your appointments are booked:"
+		}
+	case Cancelled:
+		subject, intro = "Your appointment was cancelled", "Your appointment was cancelled:"
+		if plural {
+			subject, intro = "Your appointments were cancelled", "Your appointments were cancelled:"
+		}
+	case Reminder:
+		subject = "Reminder: your appointment begins in " + formatLead(event.Lead)
+		intro = "This is a reminder of your upcoming appointment:"
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hello %s,\n\n%s\n\n", event.User.Username, intro)
+	for _, appt := range event.Appointments {
+		body.WriteString("  - " + n.formatAppointment(event.Resource, appt) + "\n")
+	}
+
+	if event.Kind == Cancelled {
+		first := event.Appointments[0]
+		if first.CancelReason != "" {
+			fmt.Fprintf(&body, "\nReason: %s\n", first.CancelReason)
+		}
+		if first.CancelledBy != 0 && first.CancelledBy != event.User.ID {
+			body.WriteString("\nIt was cancelled by our staff, feel free to book another slot.\n")
+		}
+	}
+
+	return &mailer.Message{
+		To:      event.User.Email,
+		Subject: subject,
+		Body:    body.String(),
+	}
+}
+
+// formatAppointment describes an appointment on a single line, e.g. "Mon 20 Oct 2025, 14:00 - 15:00 (CET), Room A".
+func (n *MailNotifier) formatAppointment(resource *entity.Resource, appt *entity.Appointment) string {
+	begin := time.UnixMilli(appt.BeginsAt).In(n.location)
+	end := time.UnixMilli(appt.EndsAt + 1).In(n.location) // EndsAt is inclusive
+
+	line := fmt.Sprintf("%s - %s (%s)", begin.Format("Mon 2 Jan 2006, 15:04"), end.Format("15:04"), begin.Format("MST"))
+	if resource != nil {
+		line += ", " + resource.Name
+	}
+	if appt.Title != "" {
+		line += ": " + appt.Title
+	}
+	return line
+}
+
+// formatLead turns whole hours and days into words, e.g. "24 hours" or "1 hour".
+func formatLead(lead time.Duration) string {
+	unit, count := "minute", int(lead/time.Minute)
+	if lead%time.Hour == 0 {
+		unit, count = "hour", int(lead/time.Hour)
+	}
+
+	if count == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"4shure/cmd/internal/domain/entity"
 	"4shure/cmd/internal/service"
 	"4shure/cmd/internal/utils"
 	"4shure/cmd/internal/utils/apierror"
@@ -12,10 +13,15 @@ import (
 )
 
 type AppointmentService interface {
-	GetAppointments(subId string) ([]*service.AppointmentResponse, apierror.ErrorResponse)
-	CreateAppointment(req *service.AppointmentRequest, subId string) (*service.AppointmentResponse, apierror.ErrorResponse)
-	DeleteAppointment(id int, sub string) apierror.ErrorResponse
-	GetCalendar(monthStart, monthEnd int64) (*service.CalendarResponse, apierror.ErrorResponse)
+	GetAppointments(includeDeleted bool, caller *entity.User) ([]*service.AppointmentResponse, apierror.ErrorResponse)
+	CreateAppointment(req *service.AppointmentRequest, caller *entity.User) (*service.AppointmentResponse, apierror.ErrorResponse)
+	CreateSeries(req *service.AppointmentRequest, caller *entity.User) (*service.SeriesResponse, apierror.ErrorResponse)
+	UpdateAppointment(id int, req *service.UpdateAppointmentRequest, scope string, caller *entity.User) (*service.AppointmentResponse, apierror.ErrorResponse)
+	DeleteAppointment(id int, req *service.CancelAppointmentRequest, caller *entity.User) apierror.ErrorResponse
+	RestoreAppointment(id int, caller *entity.User) (*service.AppointmentResponse, apierror.ErrorResponse)
+	GetCalendar(resourceID int, monthStart, monthEnd int64) (*service.CalendarResponse, apierror.ErrorResponse)
+	GetFreeSlots(resourceID int, from, to int64, minutes int) (*service.SlotsResponse, apierror.ErrorResponse)
+	GetNextSlot(resourceID int, after int64, minutes int) (*service.ScheduledDay, apierror.ErrorResponse)
 }
 
 type DefaultAppointmentRoute struct {
@@ -27,12 +33,8 @@ func NewAppointmentDefault(apptService AppointmentService) *DefaultAppointmentRo
 }
 
 func (a *DefaultAppointmentRoute) GetAppointments(c echo.Context) error {
-	data, err := utils.ParseTokenDataCtx(c)
-	if err != nil {
-		return c.JSON(401, apierror.InvalidAuthTokenError)
-	}
-
-	appts, apierr := a.AppointmentService.GetAppointments(data.Sub)
+	includeDeleted := c.QueryParam("include_deleted") == "true"
+	appts, apierr := a.AppointmentService.GetAppointments(includeDeleted, CurrentUser(c))
 	if apierr != nil {
 		return c.JSON(apierr.Code(), apierr)
 	}
@@ -47,19 +49,22 @@ func (a *DefaultAppointmentRoute) CreateAppointment(c echo.Context) error {
 		return c.JSON(400, apierror.MalformedBodyError)
 	}
 
-	data, err := utils.ParseTokenDataCtx(c)
-	if err != nil {
-		return c.JSON(401, apierror.InvalidAuthTokenError)
+	if req.Recurrence != nil {
+		series, apierr := a.AppointmentService.CreateSeries(&req, CurrentUser(c))
+		if apierr != nil {
+			return c.JSON(apierr.Code(), apierr)
+		}
+		return c.JSON(http.StatusCreated, series)
 	}
 
-	appt, apierr := a.AppointmentService.CreateAppointment(&req, data.Sub)
+	appt, apierr := a.AppointmentService.CreateAppointment(&req, CurrentUser(c))
 	if apierr != nil {
 		return c.JSON(apierr.Code(), apierr)
 	}
 	return c.JSON(http.StatusCreated, appt)
 }
 
-func (a *DefaultAppointmentRoute) DeleteAppointment(c echo.Context) error {
+func (a *DefaultAppointmentRoute) UpdateAppointment(c echo.Context) error {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -67,37 +72,176 @@ func (a *DefaultAppointmentRoute) DeleteAppointment(c echo.Context) error {
 		return c.JSON(errResp.Code(), errResp)
 	}
 
-	data, err := utils.ParseTokenDataCtx(c)
+	var req service.UpdateAppointmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	scope := c.QueryParam("scope")
+	appt, apierr := a.AppointmentService.UpdateAppointment(id, &req, scope, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, appt)
+}
+
+func (a *DefaultAppointmentRoute) DeleteAppointment(c echo.Context) error {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		return c.JSON(401, apierror.InvalidAuthTokenError)
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	var req service.CancelAppointmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
 	}
 
-	serr := a.AppointmentService.DeleteAppointment(id, data.Sub)
+	serr := a.AppointmentService.DeleteAppointment(id, &req, CurrentUser(c))
 	if serr != nil {
 		return c.JSON(serr.Code(), serr)
 	}
 	return c.NoContent(http.StatusOK)
 }
 
+func (a *DefaultAppointmentRoute) RestoreAppointment(c echo.Context) error {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	appt, apierr := a.AppointmentService.RestoreAppointment(id, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, appt)
+}
+
 func (a *DefaultAppointmentRoute) GetCalendar(c echo.Context) error {
 	monthStr := c.QueryParam("month") // "2025-08"
 	if monthStr == "" {
 		return c.JSON(400, apierror.NewMissingParamError("month"))
 	}
 
+	resourceID, apierr := parseResourceParam(c)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
 	monthStartMillis, monthEndMillis, err := parseMonthString(monthStr)
 	if err != nil {
 		apierr := apierror.NewSimple(400, "Could not understand month format")
 		return c.JSON(apierr.Code(), apierr)
 	}
 
-	calendar, apierr := a.AppointmentService.GetCalendar(monthStartMillis, monthEndMillis)
+	calendar, apierr := a.AppointmentService.GetCalendar(resourceID, monthStartMillis, monthEndMillis)
 	if apierr != nil {
 		return c.JSON(apierr.Code(), apierr)
 	}
 	return c.JSON(http.StatusOK, &calendar)
 }
 
+// GetFreeSlots lists the slots that can still be booked between "from" and "to".
+func (a *DefaultAppointmentRoute) GetFreeSlots(c echo.Context) error {
+	resourceID, apierr := parseResourceParam(c)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	from, apierr := parseDateParam(c, "from", true)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	to, apierr := parseDateParam(c, "to", true)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	minutes, apierr := parseDurationParam(c)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	slots, serr := a.AppointmentService.GetFreeSlots(resourceID, from, to, minutes)
+	if serr != nil {
+		return c.JSON(serr.Code(), serr)
+	}
+	return c.JSON(http.StatusOK, slots)
+}
+
+// GetNextSlot finds the earliest slot that can still be booked, optionally "after" a given date.
+func (a *DefaultAppointmentRoute) GetNextSlot(c echo.Context) error {
+	resourceID, apierr := parseResourceParam(c)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	after, apierr := parseDateParam(c, "after", false)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	minutes, apierr := parseDurationParam(c)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	slot, serr := a.AppointmentService.GetNextSlot(resourceID, after, minutes)
+	if serr != nil {
+		return c.JSON(serr.Code(), serr)
+	}
+	return c.JSON(http.StatusOK, slot)
+}
+
+func parseResourceParam(c echo.Context) (int, apierror.ErrorResponse) {
+	resourceStr := c.QueryParam("resource_id")
+	if resourceStr == "" {
+		return 0, apierror.NewMissingParamError("resource_id")
+	}
+
+	resourceID, err := strconv.Atoi(resourceStr)
+	if err != nil {
+		return 0, apierror.NewInvalidParamTypeError("resource_id", "int32")
+	}
+	return resourceID, nil
+}
+
+// parseDateParam parses an ISO8601 query parameter to epoch millis.
+// Optional parameters that are missing are returned as zero.
+func parseDateParam(c echo.Context, name string, required bool) (int64, apierror.ErrorResponse) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		if required {
+			return 0, apierror.NewMissingParamError(name)
+		}
+		return 0, nil
+	}
+
+	millis, err := utils.FromEpoch(raw)
+	if err != nil {
+		return 0, apierror.NewInvalidParamTypeError(name, "ISO8601 date/time")
+	}
+	return millis, nil
+}
+
+// parseDurationParam parses the optional "duration" query parameter (in minutes).
+func parseDurationParam(c echo.Context) (int, apierror.ErrorResponse) {
+	raw := c.QueryParam("duration")
+	if raw == "" {
+		return 0, nil
+	}
+
+	minutes, err := strconv.Atoi(raw)
+	if err != nil || minutes <= 0 {
+		return 0, apierror.NewInvalidParamTypeError("duration", "positive int32")
+	}
+	return minutes, nil
+}
+
 // parseMonthString takes "YYYY-MM" (e.g., "2025-08") and returns
 // the start of that month and the start of the next month as epoch millis.
 func parseMonthString(monthString string) (int64, int64, error) {
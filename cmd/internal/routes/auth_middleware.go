@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// userContextKey is where Authenticate stores the caller on the echo context.
+const userContextKey = "user"
+
+type UserFinder interface {
+	FindBySub(sub string) (*entity.User, error)
+}
+
+// Authenticate verifies the request token and puts the user behind it on the context,
+// where handlers can get it with CurrentUser. Requests without a valid token, whose
+// user is not in our database, or whose token was issued before the user signed out
+// (see UserService.Logout) are rejected.
+func Authenticate(users UserFinder) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			data, err := utils.ParseTokenDataCtx(c)
+			if err != nil {
+				return c.JSON(401, apierror.InvalidAuthTokenError)
+			}
+
+			user, err := users.FindBySub(data.Sub)
+			if err != nil {
+				log.Errorf("failed to find user (%s) by sub: %v", data.Sub, err)
+				return c.JSON(500, apierror.InternalServerError)
+			}
+
+			if user == nil {
+				return c.JSON(401, apierror.UnregisteredUserError)
+			}
+
+			// Tokens are verified locally, so they would stay valid until they expire.
+			// "iat" only has a precision of one second, so tokens issued during the second
+			// the user signed out are accepted, or signing in again right after signing
+			// out would give tokens rejected until they expire.
+			if data.IssuedAt == 0 || data.IssuedAt < user.SignedOutAt/1000 {
+				return c.JSON(401, apierror.RevokedAuthTokenError)
+			}
+
+			c.Set(userContextKey, user)
+			return next(c)
+		}
+	}
+}
+
+// Require rejects requests from users without the given permission. It must run after Authenticate.
+func Require(permission authz.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !authz.Can(CurrentUser(c), permission) {
+				return c.JSON(403, apierror.ForbiddenError)
+			}
+			return next(c)
+		}
+	}
+}
+
+// CurrentUser returns the user set by Authenticate, or nil on public routes.
+func CurrentUser(c echo.Context) *entity.User {
+	user, _ := c.Get(userContextKey).(*entity.User)
+	return user
+}
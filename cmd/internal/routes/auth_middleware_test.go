@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const testIssuer = "https://idp.example.com"
+
+type fakeUserFinder struct {
+	user *entity.User
+}
+
+func (f *fakeUserFinder) FindBySub(sub string) (*entity.User, error) {
+	if f.user.SubUUID != sub {
+		return nil, nil
+	}
+	return f.user, nil
+}
+
+// newTestSigner sets a token verifier trusting a new key, and returns a function signing
+// access tokens issued at the given time with it.
+func newTestSigner(t *testing.T) func(sub string, issuedAt time.Time) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kid": "test",
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+
+	utils.SetTokenVerifier(utils.NewTokenVerifier(&utils.VerifierConfig{
+		StaticJWKS: jwks,
+		Issuer:     testIssuer,
+		ClientID:   "test-client",
+		TokenUses:  []string{"access"},
+		CacheTTL:   time.Hour,
+	}))
+	t.Cleanup(func() { utils.SetTokenVerifier(nil) })
+
+	return func(sub string, issuedAt time.Time) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub":       sub,
+			"iss":       testIssuer,
+			"client_id": "test-client",
+			"token_use": "access",
+			"iat":       issuedAt.Unix(),
+			"exp":       issuedAt.Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+}
+
+func TestAuthenticateAfterLogout(t *testing.T) {
+	sign := newTestSigner(t)
+	signedOutAt := time.Now()
+	user := &entity.User{ID: 1, SubUUID: "sub-1", SignedOutAt: signedOutAt.UnixMilli()}
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     int
+	}{
+		{name: "signed in again right away", issuedAt: signedOutAt, want: http.StatusOK},
+		{name: "signed in again later", issuedAt: signedOutAt.Add(time.Minute), want: http.StatusOK},
+		{name: "issued before signing out", issuedAt: signedOutAt.Add(-time.Second), want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			}, Authenticate(&fakeUserFinder{user: user}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(user.SubUUID, tt.issuedAt))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/service"
+	"4shure/cmd/internal/utils/apierror"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AvailabilityService interface {
+	GetOpeningHours() (*service.WeeklyHoursResponse, apierror.ErrorResponse)
+	SetOpeningHours(req *service.WeeklyHoursRequest, caller *entity.User) (*service.WeeklyHoursResponse, apierror.ErrorResponse)
+	GetOverrides(fromDate, toDate string) ([]*service.DateOverrideResponse, apierror.ErrorResponse)
+	CreateOverride(req *service.DateOverrideRequest, caller *entity.User) (*service.DateOverrideResponse, apierror.ErrorResponse)
+	DeleteOverride(id int, caller *entity.User) apierror.ErrorResponse
+}
+
+type DefaultAvailabilityRoute struct {
+	AvailabilityService AvailabilityService
+}
+
+func NewAvailabilityDefault(availabilityService AvailabilityService) *DefaultAvailabilityRoute {
+	return &DefaultAvailabilityRoute{AvailabilityService: availabilityService}
+}
+
+func (a *DefaultAvailabilityRoute) GetOpeningHours(c echo.Context) error {
+	hours, apierr := a.AvailabilityService.GetOpeningHours()
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, hours)
+}
+
+func (a *DefaultAvailabilityRoute) SetOpeningHours(c echo.Context) error {
+	var req service.WeeklyHoursRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	hours, apierr := a.AvailabilityService.SetOpeningHours(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, hours)
+}
+
+func (a *DefaultAvailabilityRoute) GetOverrides(c echo.Context) error {
+	from := c.QueryParam("from") // "2025-12-01"
+	to := c.QueryParam("to")     // "2025-12-31"
+	if !isDateOrEmpty(from) {
+		return c.JSON(400, apierror.NewInvalidParamTypeError("from", "date (YYYY-MM-DD)"))
+	}
+
+	if !isDateOrEmpty(to) {
+		return c.JSON(400, apierror.NewInvalidParamTypeError("to", "date (YYYY-MM-DD)"))
+	}
+
+	overrides, apierr := a.AvailabilityService.GetOverrides(from, to)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	resp := echo.Map{"overrides": overrides}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+func (a *DefaultAvailabilityRoute) CreateOverride(c echo.Context) error {
+	var req service.DateOverrideRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	override, apierr := a.AvailabilityService.CreateOverride(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusCreated, override)
+}
+
+func (a *DefaultAvailabilityRoute) DeleteOverride(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	apierr := a.AvailabilityService.DeleteOverride(id, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func isDateOrEmpty(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
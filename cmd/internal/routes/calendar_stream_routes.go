@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"4shure/cmd/internal/service"
+	"4shure/cmd/internal/utils/apierror"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type CalendarStream interface {
+	Subscribe(filter service.CalendarFilter, lastEventID int64) (*service.CalendarSubscription, []*service.CalendarEvent)
+	Unsubscribe(sub *service.CalendarSubscription)
+}
+
+type DefaultCalendarStreamRoute struct {
+	CalendarStream CalendarStream
+	Config         *service.CalendarStreamConfig
+}
+
+func NewCalendarStreamDefault(stream CalendarStream, cfg *service.CalendarStreamConfig) *DefaultCalendarStreamRoute {
+	return &DefaultCalendarStreamRoute{CalendarStream: stream, Config: cfg}
+}
+
+// StreamCalendar sends the slots taken and freed during a month as Server-Sent Events, for every
+// resource or the one given by "resource_id". Clients that reconnect with Last-Event-ID (or the
+// "last_event_id" query parameter) get the events they missed, or a resync event when those are gone.
+func (s *DefaultCalendarStreamRoute) StreamCalendar(c echo.Context) error {
+	monthStr := c.QueryParam("month")
+	if monthStr == "" {
+		return c.JSON(400, apierror.NewMissingParamError("month"))
+	}
+
+	monthStartMillis, monthEndMillis, err := parseMonthString(monthStr)
+	if err != nil {
+		apierr := apierror.NewSimple(400, "Could not understand month format")
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	filter := service.CalendarFilter{From: monthStartMillis, To: monthEndMillis}
+	if resourceStr := c.QueryParam("resource_id"); resourceStr != "" {
+		filter.ResourceID, err = strconv.Atoi(resourceStr)
+		if err != nil {
+			apierr := apierror.NewInvalidParamTypeError("resource_id", "int32")
+			return c.JSON(apierr.Code(), apierr)
+		}
+	}
+
+	lastEventStr := c.Request().Header.Get("Last-Event-ID")
+	if lastEventStr == "" {
+		lastEventStr = c.QueryParam("last_event_id")
+	}
+
+	var lastEventID int64
+	if lastEventStr != "" {
+		lastEventID, err = strconv.ParseInt(lastEventStr, 10, 64)
+		if err != nil {
+			apierr := apierror.NewInvalidParamTypeError("Last-Event-ID", "int64")
+			return c.JSON(apierr.Code(), apierr)
+		}
+	}
+
+	sub, missed := s.CalendarStream.Subscribe(filter, lastEventID)
+	defer s.CalendarStream.Unsubscribe(sub)
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+	resp.Header().Set(echo.HeaderConnection, "keep-alive")
+	resp.Header().Set("X-Accel-Buffering", "no") // Keeps nginx from buffering events
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	for _, event := range missed {
+		if err := writeCalendarEvent(resp, event); err != nil {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(s.Config.Heartbeat)
+	defer heartbeat.Stop()
+
+	// Errors only mean the client is gone, and the response has been sent already anyway
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(resp, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			resp.Flush()
+		case event, ok := <-sub.Events:
+			// Closed when the client fell behind, it will resume from the last event it got
+			if !ok {
+				return nil
+			}
+
+			if err := writeCalendarEvent(resp, event); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func writeCalendarEvent(resp *echo.Response, event *service.CalendarEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(resp, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	if err != nil {
+		return err
+	}
+
+	resp.Flush()
+	return nil
+}
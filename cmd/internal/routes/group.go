@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// Group registers routes under a common prefix, behind the middleware of the group. Unlike echo
+// groups with middleware, it does not add a catch-all route under its prefix, so unknown paths
+// still get a 404 instead of going through the middleware (e.g. a 401 from Authenticate).
+type Group struct {
+	prefix     string
+	echo       *echo.Echo
+	middleware []echo.MiddlewareFunc
+}
+
+// NewGroup creates a group of routes under the given prefix.
+func NewGroup(e *echo.Echo, prefix string, middleware ...echo.MiddlewareFunc) *Group {
+	return &Group{prefix: prefix, echo: e, middleware: middleware}
+}
+
+// Group creates a sub-group, whose routes go through the middleware of this group first.
+func (g *Group) Group(prefix string, middleware ...echo.MiddlewareFunc) *Group {
+	return &Group{prefix: g.prefix + prefix, echo: g.echo, middleware: g.with(middleware)}
+}
+
+func (g *Group) GET(path string, h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route {
+	return g.echo.Add(http.MethodGet, g.prefix+path, h, g.with(middleware)...)
+}
+
+func (g *Group) POST(path string, h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route {
+	return g.echo.Add(http.MethodPost, g.prefix+path, h, g.with(middleware)...)
+}
+
+func (g *Group) PUT(path string, h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route {
+	return g.echo.Add(http.MethodPut, g.prefix+path, h, g.with(middleware)...)
+}
+
+func (g *Group) PATCH(path string, h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route {
+	return g.echo.Add(http.MethodPatch, g.prefix+path, h, g.with(middleware)...)
+}
+
+func (g *Group) DELETE(path string, h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) *echo.Route {
+	return g.echo.Add(http.MethodDelete, g.prefix+path, h, g.with(middleware)...)
+}
+
+// with returns the middleware of the group followed by the given one, without sharing the
+// backing array of the group.
+func (g *Group) with(middleware []echo.MiddlewareFunc) []echo.MiddlewareFunc {
+	return append(g.middleware[:len(g.middleware):len(g.middleware)], middleware...)
+}
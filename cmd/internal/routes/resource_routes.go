@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/service"
+	"4shure/cmd/internal/utils/apierror"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+type ResourceService interface {
+	GetResources() ([]*service.ResourceResponse, apierror.ErrorResponse)
+	GetResource(id int) (*service.ResourceResponse, apierror.ErrorResponse)
+	CreateResource(req *service.ResourceRequest, caller *entity.User) (*service.ResourceResponse, apierror.ErrorResponse)
+	UpdateResource(id int, req *service.UpdateResourceRequest, caller *entity.User) (*service.ResourceResponse, apierror.ErrorResponse)
+	DeleteResource(id int, caller *entity.User) apierror.ErrorResponse
+}
+
+type DefaultResourceRoute struct {
+	ResourceService ResourceService
+}
+
+func NewResourceDefault(resourceService ResourceService) *DefaultResourceRoute {
+	return &DefaultResourceRoute{ResourceService: resourceService}
+}
+
+func (r *DefaultResourceRoute) GetResources(c echo.Context) error {
+	resources, apierr := r.ResourceService.GetResources()
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	resp := echo.Map{"resources": resources}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+func (r *DefaultResourceRoute) GetResource(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	resource, apierr := r.ResourceService.GetResource(id)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, resource)
+}
+
+func (r *DefaultResourceRoute) CreateResource(c echo.Context) error {
+	var req service.ResourceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	resource, apierr := r.ResourceService.CreateResource(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusCreated, resource)
+}
+
+func (r *DefaultResourceRoute) UpdateResource(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	var req service.UpdateResourceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	resource, apierr := r.ResourceService.UpdateResource(id, &req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, resource)
+}
+
+func (r *DefaultResourceRoute) DeleteResource(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	apierr := r.ResourceService.DeleteResource(id, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
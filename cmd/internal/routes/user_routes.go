@@ -1,9 +1,11 @@
 package routes
 
 import (
+	"4shure/cmd/internal/domain/entity"
 	"4shure/cmd/internal/service"
 	"4shure/cmd/internal/utils"
 	"4shure/cmd/internal/utils/apierror"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -11,11 +13,24 @@ import (
 )
 
 type UserService interface {
-	GetUsers() ([]*service.UserResponse, apierror.ErrorResponse)
-	GetUser(rawId, subId string) (*service.UserResponse, apierror.ErrorResponse)
+	GetUsers(caller *entity.User) ([]*service.UserResponse, apierror.ErrorResponse)
+	GetUser(rawId string, caller *entity.User) (*service.UserResponse, apierror.ErrorResponse)
 	CreateUser(req *service.CreateUserRequest) apierror.ErrorResponse
 	Login(req *service.UserLoginRequest) (*service.UserLoginResponse, apierror.ErrorResponse)
+	RefreshTokens(req *service.RefreshTokenRequest) (*service.UserLoginResponse, apierror.ErrorResponse)
 	ConfirmSignup(req *service.ConfirmSignupRequest) apierror.ErrorResponse
+	ResendConfirmationCode(req *service.ResendCodeRequest) apierror.ErrorResponse
+	ForgotPassword(req *service.ForgotPasswordRequest) apierror.ErrorResponse
+	ResetPassword(req *service.ResetPasswordRequest) apierror.ErrorResponse
+	ChangePassword(req *service.ChangePasswordRequest, caller *entity.User) apierror.ErrorResponse
+	UpdateProfile(req *service.UpdateProfileRequest, caller *entity.User) (*service.UserResponse, apierror.ErrorResponse)
+	VerifyEmail(req *service.VerifyEmailRequest, caller *entity.User) apierror.ErrorResponse
+	DeleteAccount(caller *entity.User) apierror.ErrorResponse
+	ExportUser(rawId string, caller *entity.User) (*service.UserExport, apierror.ErrorResponse)
+	Logout(req *service.LogoutRequest, caller *entity.User) apierror.ErrorResponse
+	SetRole(rawId string, req *service.SetRoleRequest, caller *entity.User) (*service.UserResponse, apierror.ErrorResponse)
+	GrantPermission(rawId string, req *service.GrantPermissionRequest, caller *entity.User) (*service.UserResponse, apierror.ErrorResponse)
+	RevokePermission(rawId, permission string, caller *entity.User) apierror.ErrorResponse
 }
 
 type DefaultUserRoute struct {
@@ -27,7 +42,7 @@ func NewUserDefault(userService UserService) *DefaultUserRoute {
 }
 
 func (u *DefaultUserRoute) GetUsers(c echo.Context) error {
-	users, apierr := u.UserService.GetUsers()
+	users, apierr := u.UserService.GetUsers(CurrentUser(c))
 	if apierr != nil {
 		return c.JSON(apierr.Code(), apierr)
 	}
@@ -42,12 +57,7 @@ func (u *DefaultUserRoute) GetUser(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, apierror.NewMissingParamError("id"))
 	}
 
-	data, err := utils.ParseTokenDataCtx(c)
-	if err != nil {
-		return c.JSON(401, apierror.InvalidAuthTokenError)
-	}
-
-	user, apierr := u.UserService.GetUser(rawId, data.Sub)
+	user, apierr := u.UserService.GetUser(rawId, CurrentUser(c))
 	if apierr != nil {
 		return c.JSON(apierr.Code(), apierr)
 	}
@@ -80,6 +90,19 @@ func (u *DefaultUserRoute) CreateLogin(c echo.Context) error {
 	return c.JSON(http.StatusOK, resp)
 }
 
+func (u *DefaultUserRoute) RefreshTokens(c echo.Context) error {
+	var req service.RefreshTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	resp, apierr := u.UserService.RefreshTokens(&req)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
 func (u *DefaultUserRoute) VerifySignup(c echo.Context) error {
 	var req service.ConfirmSignupRequest
 	if err := c.Bind(&req); err != nil {
@@ -92,3 +115,164 @@ func (u *DefaultUserRoute) VerifySignup(c echo.Context) error {
 	}
 	return c.NoContent(http.StatusOK)
 }
+
+func (u *DefaultUserRoute) ResendVerification(c echo.Context) error {
+	var req service.ResendCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	apierr := u.UserService.ResendConfirmationCode(&req)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (u *DefaultUserRoute) ForgotPassword(c echo.Context) error {
+	var req service.ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	apierr := u.UserService.ForgotPassword(&req)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (u *DefaultUserRoute) ResetPassword(c echo.Context) error {
+	var req service.ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	apierr := u.UserService.ResetPassword(&req)
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (u *DefaultUserRoute) ChangePassword(c echo.Context) error {
+	var req service.ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	if req.AccessToken == "" {
+		req.AccessToken = utils.RequestToken(c)
+	}
+
+	apierr := u.UserService.ChangePassword(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (u *DefaultUserRoute) Logout(c echo.Context) error {
+	var req service.LogoutRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	if req.AccessToken == "" {
+		req.AccessToken = utils.RequestToken(c)
+	}
+
+	apierr := u.UserService.Logout(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (u *DefaultUserRoute) UpdateProfile(c echo.Context) error {
+	var req service.UpdateProfileRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	if req.AccessToken == "" {
+		req.AccessToken = utils.RequestToken(c)
+	}
+
+	user, apierr := u.UserService.UpdateProfile(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func (u *DefaultUserRoute) VerifyEmail(c echo.Context) error {
+	var req service.VerifyEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	if req.AccessToken == "" {
+		req.AccessToken = utils.RequestToken(c)
+	}
+
+	apierr := u.UserService.VerifyEmail(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (u *DefaultUserRoute) DeleteAccount(c echo.Context) error {
+	apierr := u.UserService.DeleteAccount(CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// ExportUser sends the export as a JSON file to download.
+func (u *DefaultUserRoute) ExportUser(c echo.Context) error {
+	export, apierr := u.UserService.ExportUser(c.Param("id"), CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	filename := fmt.Sprintf("user-%d-export.json", export.User.ID)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.JSON(http.StatusOK, export)
+}
+
+func (u *DefaultUserRoute) SetRole(c echo.Context) error {
+	var req service.SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	user, apierr := u.UserService.SetRole(c.Param("id"), &req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func (u *DefaultUserRoute) GrantPermission(c echo.Context) error {
+	var req service.GrantPermissionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, apierror.MalformedBodyError)
+	}
+
+	user, apierr := u.UserService.GrantPermission(c.Param("id"), &req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func (u *DefaultUserRoute) RevokePermission(c echo.Context) error {
+	apierr := u.UserService.RevokePermission(c.Param("id"), c.Param("permission"), CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/service"
+	"4shure/cmd/internal/utils/apierror"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+type WebhookService interface {
+	GetWebhooks(caller *entity.User) ([]*service.WebhookResponse, apierror.ErrorResponse)
+	CreateWebhook(req *service.WebhookRequest, caller *entity.User) (*service.WebhookResponse, apierror.ErrorResponse)
+	UpdateWebhook(id int, req *service.UpdateWebhookRequest, caller *entity.User) (*service.WebhookResponse, apierror.ErrorResponse)
+	DeleteWebhook(id int, caller *entity.User) apierror.ErrorResponse
+	GetDeliveries(id int, caller *entity.User) ([]*service.DeliveryResponse, apierror.ErrorResponse)
+	ReplayDelivery(id, deliveryID int, caller *entity.User) (*service.DeliveryResponse, apierror.ErrorResponse)
+}
+
+type DefaultWebhookRoute struct {
+	WebhookService WebhookService
+}
+
+func NewWebhookDefault(webhookService WebhookService) *DefaultWebhookRoute {
+	return &DefaultWebhookRoute{WebhookService: webhookService}
+}
+
+func (w *DefaultWebhookRoute) GetWebhooks(c echo.Context) error {
+	webhooks, apierr := w.WebhookService.GetWebhooks(CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	resp := echo.Map{"webhooks": webhooks, "events": service.WebhookEvents}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+func (w *DefaultWebhookRoute) CreateWebhook(c echo.Context) error {
+	var req service.WebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	webhook, apierr := w.WebhookService.CreateWebhook(&req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusCreated, webhook)
+}
+
+func (w *DefaultWebhookRoute) UpdateWebhook(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	var req service.UpdateWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, apierror.MalformedBodyError)
+	}
+
+	webhook, apierr := w.WebhookService.UpdateWebhook(id, &req, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusOK, webhook)
+}
+
+func (w *DefaultWebhookRoute) DeleteWebhook(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	apierr := w.WebhookService.DeleteWebhook(id, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (w *DefaultWebhookRoute) GetDeliveries(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	deliveries, apierr := w.WebhookService.GetDeliveries(id, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+
+	resp := echo.Map{"deliveries": deliveries}
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// ReplayDelivery queues the event of a past delivery again, answering before it is sent.
+func (w *DefaultWebhookRoute) ReplayDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	deliveryID, err := strconv.Atoi(c.Param("delivery"))
+	if err != nil {
+		errResp := apierror.NewSimple(400, "Delivery ID is not a number")
+		return c.JSON(errResp.Code(), errResp)
+	}
+
+	delivery, apierr := w.WebhookService.ReplayDelivery(id, deliveryID, CurrentUser(c))
+	if apierr != nil {
+		return c.JSON(apierr.Code(), apierr)
+	}
+	return c.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// AppointmentConfig holds the booking rules applied to every new (or moved) appointment.
+type AppointmentConfig struct {
+	// MinDuration is the shortest length an appointment may have.
+	MinDuration time.Duration
+
+	// MaxDuration is the longest length an appointment may have.
+	MaxDuration time.Duration
+
+	// DefaultDuration is used when the request has neither "ends_at" nor "duration".
+	DefaultDuration time.Duration
+
+	// SlotGranularity is the step every begin date must be aligned to (e.g., 14:00, 14:30).
+	SlotGranularity time.Duration
+
+	// Location is the business time zone, used to evaluate opening hours.
+	Location *time.Location
+}
+
+// DefaultAppointmentConfig returns the historical behaviour: one-hour
+// appointments beginning at exact hours.
+func DefaultAppointmentConfig() *AppointmentConfig {
+	return &AppointmentConfig{
+		MinDuration:     time.Hour,
+		MaxDuration:     time.Hour,
+		DefaultDuration: time.Hour,
+		SlotGranularity: time.Hour,
+		Location:        time.UTC,
+	}
+}
+
+// AppointmentConfigFromEnv reads the booking rules from the environment, falling back
+// to DefaultAppointmentConfig for every variable that is missing or invalid. An error is
+// returned when the resulting rules cannot be met by any appointment, see Check.
+//
+// Durations use Go's format, e.g., "30m", "3h" or "1h30m".
+func AppointmentConfigFromEnv() (*AppointmentConfig, error) {
+	cfg := DefaultAppointmentConfig()
+	cfg.MinDuration = durationFromEnv("APPOINTMENT_MIN_DURATION", cfg.MinDuration)
+	cfg.MaxDuration = durationFromEnv("APPOINTMENT_MAX_DURATION", cfg.MaxDuration)
+	cfg.DefaultDuration = durationFromEnv("APPOINTMENT_DEFAULT_DURATION", cfg.DefaultDuration)
+	cfg.SlotGranularity = durationFromEnv("APPOINTMENT_SLOT_GRANULARITY", cfg.SlotGranularity)
+	cfg.Location = locationFromEnv("APPOINTMENT_TIMEZONE", cfg.Location)
+
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Check makes sure the durations are positive, and that the default one lies
+// between the minimum and the maximum.
+func (c *AppointmentConfig) Check() error {
+	if c.MinDuration <= 0 || c.MaxDuration <= 0 || c.DefaultDuration <= 0 || c.SlotGranularity <= 0 {
+		return errors.New("appointment durations and slot granularity must be positive")
+	}
+
+	if c.MinDuration > c.MaxDuration {
+		return fmt.Errorf("minimum appointment duration %s exceeds the maximum %s", c.MinDuration, c.MaxDuration)
+	}
+
+	if c.DefaultDuration < c.MinDuration || c.DefaultDuration > c.MaxDuration {
+		return fmt.Errorf("default appointment duration %s is not between %s and %s", c.DefaultDuration, c.MinDuration, c.MaxDuration)
+	}
+	return nil
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Warnf("invalid duration for %s (%q), using default: %s", key, raw, fallback)
+		return fallback
+	}
+	return d
+}
+
+func locationFromEnv(key string, fallback *time.Location) *time.Location {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+
+	loc, err := time.LoadLocation(raw)
+	if err != nil {
+		log.Warnf("invalid time zone for %s (%q), using default: %s", key, raw, fallback)
+		return fallback
+	}
+	return loc
+}
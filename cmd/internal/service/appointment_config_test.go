@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestAppointmentConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name             string
+		min, max, dflt   string
+		wantErr          bool
+		wantMin, wantMax string
+	}{
+		{name: "defaults", wantMin: "1h0m0s", wantMax: "1h0m0s"},
+		{name: "range", min: "30m", max: "3h", wantMin: "30m0s", wantMax: "3h0m0s"},
+		{name: "invalid falls back", min: "-1h", wantMin: "1h0m0s", wantMax: "1h0m0s"},
+		{name: "min above max", min: "2h", max: "1h", dflt: "1h", wantErr: true},
+		{name: "default below min", min: "1h", max: "3h", dflt: "30m", wantErr: true},
+		{name: "default above max", min: "30m", max: "45m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APPOINTMENT_MIN_DURATION", tt.min)
+			t.Setenv("APPOINTMENT_MAX_DURATION", tt.max)
+			t.Setenv("APPOINTMENT_DEFAULT_DURATION", tt.dflt)
+
+			cfg, err := AppointmentConfigFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("AppointmentConfigFromEnv() = %+v, want an error", cfg)
+				}
+				return
+			}
+
+			if err != nil || cfg.MinDuration.String() != tt.wantMin || cfg.MaxDuration.String() != tt.wantMax {
+				t.Errorf("AppointmentConfigFromEnv() = %+v, %v", cfg, err)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package service
 
 import (
+	"4shure/cmd/internal/authz"
 	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/notification"
 	"4shure/cmd/internal/utils"
 	"4shure/cmd/internal/utils/apierror"
+	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/gommon/log"
 	"time"
@@ -11,61 +14,168 @@ import (
 
 type AppointmentRepository interface {
 	Save(appointment *entity.Appointment) error
-	FindAll() ([]*entity.Appointment, error)
-	IsAvailable(begin, end int64) (bool, error)
-	FindByUserID(id int) ([]*entity.Appointment, error)
+	FindAll(includeDeleted bool) ([]*entity.Appointment, error)
+	IsAvailable(resourceID int, begin, end int64) (bool, error)
+	Book(appts []*entity.Appointment, excludeIDs ...int) ([]*entity.Appointment, error)
+	BookSeries(series *entity.AppointmentSeries, appts []*entity.Appointment) ([]*entity.Appointment, error)
+	FindByUserID(id int, includeDeleted bool) ([]*entity.Appointment, error)
 	FindByID(id int) (*entity.Appointment, error)
-	FindMonthAppointments(monthStart, monthEnd int64) ([]*entity.Appointment, error)
-	Delete(appointment *entity.Appointment) error
+	FindMonthAppointments(resourceID int, monthStart, monthEnd int64) ([]*entity.Appointment, error)
+	FindBySeriesID(seriesID int) ([]*entity.Appointment, error)
+	FindSeriesByID(id int) (*entity.AppointmentSeries, error)
+	SaveSeries(series *entity.AppointmentSeries) error
+	Cancel(appts []*entity.Appointment) error
+}
+
+// CalendarPublisher tells the clients following the calendar about the slots taken and freed,
+// see CalendarBroker.
+type CalendarPublisher interface {
+	Publish(events ...*CalendarEvent)
+}
+
+// Notifier tells users about their appointments, e.g. by e-mail (see notification.MailNotifier).
+type Notifier interface {
+	Notify(event *notification.Event) error
 }
 
 type AppointmentRequest struct {
-	Title    string `json:"title" validate:"max=128"`
-	BeginsAt string `json:"begins_at" validate:"required,iso8601"`
+	Title      string `json:"title" validate:"max=128"`
+	BeginsAt   string `json:"begins_at" validate:"required,iso8601"`
+	ResourceID int    `json:"resource_id" validate:"required,min=1"`
+
+	// UserID books the appointment on behalf of another user, see authz.AppointmentsManageAll.
+	UserID int `json:"user_id" validate:"omitempty,min=1"`
+
+	// EndsAt is exclusive, so a 14:00 appointment with "ends_at" 15:00 lasts one hour.
+	// It cannot be used together with Duration.
+	EndsAt string `json:"ends_at" validate:"omitempty,iso8601"`
+
+	// Duration is the appointment length in minutes.
+	// It cannot be used together with EndsAt.
+	Duration int `json:"duration" validate:"omitempty,min=1"`
+
+	// Recurrence turns the request into a series of appointments, the first
+	// one beginning at BeginsAt. See DefaultAppointmentService.CreateSeries.
+	Recurrence *RecurrenceRequest `json:"recurrence"`
+}
+
+// UpdateAppointmentRequest holds the fields that can be changed on an existing
+// appointment. Fields left empty are kept unchanged.
+type UpdateAppointmentRequest struct {
+	Title      string `json:"title" validate:"max=128"`
+	BeginsAt   string `json:"begins_at" validate:"omitempty,iso8601"`
+	EndsAt     string `json:"ends_at" validate:"omitempty,iso8601"`
+	Duration   int    `json:"duration" validate:"omitempty,min=1"`
+	ResourceID int    `json:"resource_id" validate:"omitempty,min=1"`
 }
 
 type AppointmentResponse struct {
-	ID        int    `json:"id"`
-	BeginsAt  string `json:"begins_at"`
-	EndsAt    string `json:"ends_at"`
-	UserID    int    `json:"user_id"`
-	IsDeleted bool   `json:"is_deleted"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
-	Title     string `json:"title"`
+	ID         int    `json:"id"`
+	BeginsAt   string `json:"begins_at"`
+	EndsAt     string `json:"ends_at"`
+	Duration   int    `json:"duration"`
+	UserID     int    `json:"user_id"`
+	ResourceID int    `json:"resource_id"`
+	SeriesID   int    `json:"series_id"`
+	IsDeleted  bool   `json:"is_deleted"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	Title      string `json:"title"`
+	BookedBy   int    `json:"booked_by"`
+	UpdatedBy  int    `json:"updated_by,omitempty"`
+
+	// Only present for cancelled appointments
+	CancelledBy  int    `json:"cancelled_by,omitempty"`
+	CancelledAt  string `json:"cancelled_at,omitempty"`
+	CancelReason string `json:"cancel_reason,omitempty"`
+}
+
+// CancelAppointmentRequest holds the (optional) details of a cancellation.
+type CancelAppointmentRequest struct {
+	// Scope tells which occurrences of a recurring appointment are cancelled, see ScopeThis.
+	Scope  string `query:"scope" json:"scope"`
+	Reason string `query:"reason" json:"reason" validate:"max=256"`
+}
+
+// SeriesResponse lists the appointments booked for a recurring series, as well as
+// the begin date of every occurrence that was skipped due to conflicts.
+type SeriesResponse struct {
+	SeriesID     int                    `json:"series_id"`
+	Appointments []*AppointmentResponse `json:"appointments"`
+	Conflicts    []string               `json:"conflicts"`
 }
 
 type ScheduledDay struct {
 	BeginsAt string `json:"begins_at"`
 	EndsAt   string `json:"ends_at"`
+	Duration int    `json:"duration"`
 }
 
 type CalendarResponse struct {
+	ResourceID    int             `json:"resource_id"`
 	ScheduledDays []*ScheduledDay `json:"scheduled_days"`
+
+	// ClosedPeriods lists when nothing can be booked, according to the opening hours.
+	ClosedPeriods []*ScheduledDay `json:"closed_periods"`
+}
+
+// SlotsResponse lists the free slots of a resource for appointments of the given length (in minutes).
+type SlotsResponse struct {
+	ResourceID int             `json:"resource_id"`
+	Duration   int             `json:"duration"`
+	Slots      []*ScheduledDay `json:"slots"`
 }
 
+const (
+	// maxSlotRange caps the period a single free slot search can cover.
+	maxSlotRange = 62 * 24 * time.Hour
+
+	// nextSlotHorizon is how far into the future GetNextSlot looks for a free slot.
+	nextSlotHorizon = 366 * 24 * time.Hour
+)
+
 type DefaultAppointmentService struct {
-	AppointmentRepo AppointmentRepository
-	UserRepo        UserRepository
-	Validate        *validator.Validate
+	AppointmentRepo  AppointmentRepository
+	UserRepo         UserRepository
+	ResourceRepo     ResourceRepository
+	AvailabilityRepo AvailabilityRepository
+	Validate         *validator.Validate
+	Config           *AppointmentConfig
+
+	// Tx saves changes along with their notifications and webhook events, see Transactor.
+	Tx Transactor
+
+	// Calendar gets the slots taken and freed once the changes are saved.
+	Calendar CalendarPublisher
 }
 
-func NewAppointmentService(apptRepo AppointmentRepository, userRepo UserRepository, validate *validator.Validate) *DefaultAppointmentService {
-	return &DefaultAppointmentService{AppointmentRepo: apptRepo, UserRepo: userRepo, Validate: validate}
+func NewAppointmentService(apptRepo AppointmentRepository, userRepo UserRepository, resourceRepo ResourceRepository, availabilityRepo AvailabilityRepository, validate *validator.Validate, cfg *AppointmentConfig, tx Transactor, calendar CalendarPublisher) *DefaultAppointmentService {
+	return &DefaultAppointmentService{
+		AppointmentRepo:  apptRepo,
+		UserRepo:         userRepo,
+		ResourceRepo:     resourceRepo,
+		AvailabilityRepo: availabilityRepo,
+		Validate:         validate,
+		Config:           cfg,
+		Tx:               tx,
+		Calendar:         calendar,
+	}
 }
 
-func (a *DefaultAppointmentService) GetAppointments(subId string) ([]*AppointmentResponse, apierror.ErrorResponse) {
-	caller, err := a.UserRepo.FindBySub(subId)
-	if err != nil {
-		log.Errorf("failed to check if user %s is admin: %v", subId, err)
-		return nil, apierror.InternalServerError
+// GetAppointments lists the caller's appointments, or everybody's for those who can manage them.
+// Only the latter can ask for cancelled appointments to be included.
+func (a *DefaultAppointmentService) GetAppointments(includeDeleted bool, caller *entity.User) ([]*AppointmentResponse, apierror.ErrorResponse) {
+	manageAll := authz.Can(caller, authz.AppointmentsManageAll)
+	if includeDeleted && !manageAll {
+		return nil, apierror.ForbiddenError
 	}
 
 	var appts []*entity.Appointment
-	if caller.IsAdmin {
-		appts, err = a.AppointmentRepo.FindAll()
+	var err error
+	if manageAll {
+		appts, err = a.AppointmentRepo.FindAll(includeDeleted)
 	} else {
-		appts, err = a.AppointmentRepo.FindByUserID(caller.ID)
+		appts, err = a.AppointmentRepo.FindByUserID(caller.ID, false)
 	}
 
 	if err != nil {
@@ -80,89 +190,600 @@ func (a *DefaultAppointmentService) GetAppointments(subId string) ([]*Appointmen
 	return response, nil
 }
 
-func (a *DefaultAppointmentService) CreateAppointment(req *AppointmentRequest, subId string) (*AppointmentResponse, apierror.ErrorResponse) {
-	caller, err := a.UserRepo.FindBySub(subId)
+func (a *DefaultAppointmentService) CreateAppointment(req *AppointmentRequest, caller *entity.User) (*AppointmentResponse, apierror.ErrorResponse) {
+	utils.Sanitize(req)
+	if valerr := a.Validate.Struct(req); valerr != nil {
+		return nil, apierror.FromValidationError(valerr)
+	}
+
+	owner, apierr := a.resolveOwner(caller, req.UserID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	begin, err := utils.FromEpoch(req.BeginsAt)
+	if err != nil {
+		return nil, apierror.MalformedBodyError
+	}
+
+	if apierr := a.checkBegin(begin); apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr := a.checkResource(req.ResourceID); apierr != nil {
+		return nil, apierr
+	}
+
+	end, apierr := a.resolveEnd(begin, req.EndsAt, req.Duration, a.Config.DefaultDuration)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr := a.checkOpeningHours(begin, end); apierr != nil {
+		return nil, apierr
+	}
+	now := utils.NowUTC()
+
+	appointment := &entity.Appointment{
+		BeginsAt:   begin,
+		EndsAt:     end,
+		UserID:     owner.ID,
+		ResourceID: req.ResourceID,
+		IsDeleted:  false,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Title:      req.Title,
+		BookedBy:   caller.ID,
+	}
+
+	var conflicts []*entity.Appointment
+	err = a.Tx.Transaction(func(tx *TxRepositories) error {
+		appts := []*entity.Appointment{appointment}
+		conflicts, err = tx.Appointments.Book(appts)
+		if err != nil || len(conflicts) > 0 {
+			return err
+		}
+		return enqueueChanges(tx.Outbox, notification.Booked, EventAppointmentCreated, appts)
+	})
+
 	if err != nil {
-		log.Errorf("failed to fetch user %s: %v", subId, err)
+		log.Errorf("failed to save appointment: %v", err)
 		return nil, apierror.InternalServerError
 	}
 
+	if len(conflicts) > 0 {
+		return nil, apierror.MomentNotAvailable
+	}
+
+	a.Calendar.Publish(slotEvents(SlotTaken, appointment)...)
+	return toAppointmentResponse(appointment), nil
+}
+
+// CreateSeries books every occurrence of a recurring appointment. Each occurrence goes through
+// the same checks as a single appointment. If any of them is not available, the whole series is
+// rejected, unless the recurrence asks to skip conflicts (which are then listed in the response).
+func (a *DefaultAppointmentService) CreateSeries(req *AppointmentRequest, caller *entity.User) (*SeriesResponse, apierror.ErrorResponse) {
+	if req.Recurrence == nil {
+		return nil, apierror.MalformedBodyError
+	}
+
 	utils.Sanitize(req)
+	utils.Sanitize(req.Recurrence)
 	if valerr := a.Validate.Struct(req); valerr != nil {
 		return nil, apierror.FromValidationError(valerr)
 	}
 
+	owner, apierr := a.resolveOwner(caller, req.UserID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
 	begin, err := utils.FromEpoch(req.BeginsAt)
 	if err != nil {
 		return nil, apierror.MalformedBodyError
 	}
 
-	if !utils.IsHourExact(begin) {
-		return nil, apierror.HourNotExactError
+	if apierr := a.checkBegin(begin); apierr != nil {
+		return nil, apierr
 	}
 
-	if !isFuture(begin) {
-		return nil, apierror.AppointmentInPastError
+	if apierr := a.checkResource(req.ResourceID); apierr != nil {
+		return nil, apierr
 	}
 
-	end := begin + time.Hour.Milliseconds() - 1
-	now := utils.NowUTC()
+	end, apierr := a.resolveEnd(begin, req.EndsAt, req.Duration, a.Config.DefaultDuration)
+	if apierr != nil {
+		return nil, apierr
+	}
+	length := end - begin
+
+	occurrences, apierr := expandOccurrences(begin, req.Recurrence, a.Config.Location)
+	if apierr != nil {
+		return nil, apierr
+	}
 
-	available, err := a.AppointmentRepo.IsAvailable(begin, end)
+	if len(occurrences) == 0 {
+		return nil, apierror.NoOccurrencesError
+	}
+
+	// Book only checks the occurrences against the stored appointments, not against each other
+	for i := 1; i < len(occurrences); i++ {
+		if occurrences[i] <= occurrences[i-1]+length {
+			return nil, apierror.OverlappingOccurrencesError
+		}
+	}
+
+	last := occurrences[len(occurrences)-1]
+	schedule, err := loadOpeningSchedule(a.AvailabilityRepo, a.Config.Location, begin, last+length)
 	if err != nil {
-		log.Errorf("failed to check if time %d is available: %v", begin, err)
+		log.Errorf("failed to load opening hours: %v", err)
 		return nil, apierror.InternalServerError
 	}
 
-	if !available {
+	var free []int64
+	conflicts := make([]string, 0)
+	for _, occurrence := range occurrences {
+		if a.checkBegin(occurrence) != nil || !schedule.isOpen(occurrence, occurrence+length) {
+			conflicts = append(conflicts, utils.FormatEpoch(occurrence))
+			continue
+		}
+
+		available, err := a.AppointmentRepo.IsAvailable(req.ResourceID, occurrence, occurrence+length)
+		if err != nil {
+			log.Errorf("failed to check if time %d is available: %v", occurrence, err)
+			return nil, apierror.InternalServerError
+		}
+
+		if !available {
+			conflicts = append(conflicts, utils.FormatEpoch(occurrence))
+			continue
+		}
+		free = append(free, occurrence)
+	}
+
+	if len(conflicts) > 0 && !req.Recurrence.SkipConflicts {
+		return nil, apierror.NewConflictsError(conflicts)
+	}
+
+	if len(free) == 0 {
 		return nil, apierror.MomentNotAvailable
 	}
 
-	appointment := &entity.Appointment{
-		BeginsAt:  begin,
-		EndsAt:    end,
-		UserID:    caller.ID,
-		IsDeleted: false,
-		CreatedAt: now,
-		UpdatedAt: now,
-		Title:     req.Title,
+	now := utils.NowUTC()
+	series := &entity.AppointmentSeries{
+		UserID:     owner.ID,
+		ResourceID: req.ResourceID,
+		Frequency:  req.Recurrence.Frequency,
+		Interval:   max(req.Recurrence.Interval, 1),
+		Count:      req.Recurrence.Count,
+		Weekdays:   joinWeekdays(req.Recurrence.Weekdays),
+		IsDeleted:  false,
+		CreatedAt:  now,
+		UpdatedAt:  now,
 	}
 
-	err = a.AppointmentRepo.Save(appointment)
+	if req.Recurrence.Until != "" {
+		series.Until, _ = utils.FromEpoch(req.Recurrence.Until)
+	}
+
+	appointments := make([]*entity.Appointment, len(free))
+	for i, occurrence := range free {
+		appointments[i] = &entity.Appointment{
+			BeginsAt:   occurrence,
+			EndsAt:     occurrence + length,
+			UserID:     owner.ID,
+			ResourceID: req.ResourceID,
+			IsDeleted:  false,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			Title:      req.Title,
+			BookedBy:   caller.ID,
+		}
+	}
+
+	// Someone may have booked one of the free occurrences in the meantime
+	var taken []*entity.Appointment
+	err = a.Tx.Transaction(func(tx *TxRepositories) error {
+		taken, err = tx.Appointments.BookSeries(series, appointments)
+		if err != nil || len(taken) > 0 {
+			return err
+		}
+		return enqueueChanges(tx.Outbox, notification.Booked, EventAppointmentCreated, appointments)
+	})
+
 	if err != nil {
-		log.Errorf("failed to save appointment: %v", err)
+		log.Errorf("failed to save appointment series: %v", err)
 		return nil, apierror.InternalServerError
 	}
-	return toAppointmentResponse(appointment), nil
+
+	if len(taken) > 0 {
+		return nil, apierror.NewConflictsError(formatBegins(taken))
+	}
+
+	a.Calendar.Publish(slotEvents(SlotTaken, appointments...)...)
+	appts := make([]*AppointmentResponse, len(appointments))
+	for i, appointment := range appointments {
+		appts[i] = toAppointmentResponse(appointment)
+	}
+
+	return &SeriesResponse{
+		SeriesID:     series.ID,
+		Appointments: appts,
+		Conflicts:    conflicts,
+	}, nil
 }
 
-func (a *DefaultAppointmentService) DeleteAppointment(id int, issuerSub string) apierror.ErrorResponse {
-	caller, err := a.UserRepo.FindBySub(issuerSub)
+// DeleteAppointment cancels an appointment that has not ended yet, keeping it (and who cancelled
+// it, when and why) for history. For recurring appointments, the scope tells whether the following (or all upcoming)
+// occurrences are cancelled as well.
+func (a *DefaultAppointmentService) DeleteAppointment(id int, req *CancelAppointmentRequest, caller *entity.User) apierror.ErrorResponse {
+	utils.Sanitize(req)
+	if valerr := a.Validate.Struct(req); valerr != nil {
+		return apierror.FromValidationError(valerr)
+	}
+
+	scope, apierr := parseScope(req.Scope)
+	if apierr != nil {
+		return apierr
+	}
+
+	appt, err := a.AppointmentRepo.FindByID(id)
+	if err != nil {
+		log.Errorf("failed to fetch appointment by id %d: %v", id, err)
+		return apierror.InternalServerError
+	}
+
+	if appt == nil || appt.IsDeleted || !canManage(caller, appt) {
+		return apierror.NotFoundError
+	}
+
+	// Past appointments are history, and their slots cannot be booked anymore anyway
+	if appt.EndsAt < utils.NowUTC() {
+		return apierror.AppointmentEndedError
+	}
+
+	targets, apierr := a.scopeTargets(appt, scope)
+	if apierr != nil {
+		return apierr
+	}
+
+	now := utils.NowUTC()
+	for _, target := range targets {
+		target.IsDeleted = true
+		target.CancelledBy = caller.ID
+		target.CancelledAt = now
+		target.CancelReason = req.Reason
+		target.UpdatedAt = now
+	}
+
+	err = a.Tx.Transaction(func(tx *TxRepositories) error {
+		err := tx.Appointments.Cancel(targets)
+		if err != nil {
+			return err
+		}
+
+		if scope != ScopeThis && appt.SeriesID != 0 {
+			err = closeSeries(tx.Appointments, appt, scope)
+			if err != nil {
+				return err
+			}
+		}
+		return enqueueChanges(tx.Outbox, notification.Cancelled, EventAppointmentCancelled, targets)
+	})
+
 	if err != nil {
-		log.Errorf("failed to check if user %s is admin: %v", issuerSub, err)
+		log.Errorf("failed to cancel appointment by id %d: %v", id, err)
 		return apierror.InternalServerError
 	}
 
+	a.Calendar.Publish(slotEvents(SlotFreed, targets...)...)
+	return nil
+}
+
+// RestoreAppointment brings a cancelled appointment back, as long as it has not begun yet,
+// is still within the opening hours, and its period was not taken by someone else in the meantime.
+// Appointments cancelled along with the account of their owner or with their series stay
+// cancelled. A restored appointment is announced like a new booking.
+func (a *DefaultAppointmentService) RestoreAppointment(id int, caller *entity.User) (*AppointmentResponse, apierror.ErrorResponse) {
 	appt, err := a.AppointmentRepo.FindByID(id)
 	if err != nil {
 		log.Errorf("failed to fetch appointment by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if appt == nil || !canManage(caller, appt) {
+		return nil, apierror.NotFoundError
+	}
+
+	if !appt.IsDeleted {
+		return nil, apierror.NotCancelledError
+	}
+
+	// The slot step may have changed since the appointment was booked
+	if apierr := a.checkBegin(appt.BeginsAt); apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr := a.checkRestorable(appt); apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr := a.checkResource(appt.ResourceID); apierr != nil {
+		return nil, apierr
+	}
+
+	// Opening hours may have changed since the appointment was booked
+	if apierr := a.checkOpeningHours(appt.BeginsAt, appt.EndsAt); apierr != nil {
+		return nil, apierr
+	}
+
+	appt.IsDeleted = false
+	appt.CancelledBy = 0
+	appt.CancelledAt = 0
+	appt.CancelReason = ""
+	appt.UpdatedAt = utils.NowUTC()
+	appt.UpdatedBy = caller.ID
+
+	var taken []*entity.Appointment
+	err = a.Tx.Transaction(func(tx *TxRepositories) error {
+		appts := []*entity.Appointment{appt}
+		taken, err = tx.Appointments.Book(appts)
+		if err != nil || len(taken) > 0 {
+			return err
+		}
+		return enqueueChanges(tx.Outbox, notification.Booked, EventAppointmentCreated, appts)
+	})
+
+	if err != nil {
+		log.Errorf("failed to restore appointment by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if len(taken) > 0 {
+		return nil, apierror.MomentNotAvailable
+	}
+
+	a.Calendar.Publish(slotEvents(SlotTaken, appt)...)
+	return toAppointmentResponse(appt), nil
+}
+
+// checkRestorable makes sure that nothing else ended along with the cancelled appointment:
+// the account of its owner (see closeAccount), or its series (see closeSeries).
+func (a *DefaultAppointmentService) checkRestorable(appt *entity.Appointment) apierror.ErrorResponse {
+	owner, err := a.UserRepo.FindByID(appt.UserID)
+	if err != nil {
+		log.Errorf("failed to fetch user by id %d: %v", appt.UserID, err)
 		return apierror.InternalServerError
 	}
 
-	if caller == nil || appt == nil || appt.IsDeleted || appt.UserID != caller.ID {
-		return apierror.NotFoundError
+	if owner == nil || owner.IsDeleted {
+		return apierror.NotRestorableError
+	}
+
+	if appt.SeriesID == 0 {
+		return nil
 	}
 
-	err = a.AppointmentRepo.Delete(appt)
+	series, err := a.AppointmentRepo.FindSeriesByID(appt.SeriesID)
 	if err != nil {
-		log.Errorf("failed to delete appointment by id %d: %v", id, err)
+		log.Errorf("failed to fetch series %d: %v", appt.SeriesID, err)
 		return apierror.InternalServerError
 	}
+
+	if series == nil || series.IsDeleted || (series.Until != 0 && series.Until < appt.BeginsAt) {
+		return apierror.NotRestorableError
+	}
 	return nil
 }
 
-func (a *DefaultAppointmentService) GetCalendar(monthStart, monthEnd int64) (*CalendarResponse, apierror.ErrorResponse) {
-	appts, err := a.AppointmentRepo.FindMonthAppointments(monthStart, monthEnd)
+// UpdateAppointment changes the title, begin date and/or length of an existing appointment,
+// keeping its ID. A moved appointment keeps its current length unless a new one is given.
+// When moved, the appointment goes through the same checks as a new one, except that it
+// never conflicts with its own (current) period. Its timing and resource cannot change once
+// it has begun.
+//
+// For recurring appointments, the scope tells which occurrences are changed. Every one
+// of them is shifted by the same amount of time as the selected occurrence, and the
+// whole change is rejected if any of them conflicts.
+func (a *DefaultAppointmentService) UpdateAppointment(id int, req *UpdateAppointmentRequest, scope string, caller *entity.User) (*AppointmentResponse, apierror.ErrorResponse) {
+	scope, apierr := parseScope(scope)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if valerr := a.Validate.Struct(req); valerr != nil {
+		return nil, apierror.FromValidationError(valerr)
+	}
+
+	if req.Title == "" && req.BeginsAt == "" && req.EndsAt == "" && req.Duration == 0 && req.ResourceID == 0 {
+		return nil, apierror.NothingToUpdateError
+	}
+
+	appt, err := a.AppointmentRepo.FindByID(id)
+	if err != nil {
+		log.Errorf("failed to fetch appointment by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if appt == nil || appt.IsDeleted || !canManage(caller, appt) {
+		return nil, apierror.NotFoundError
+	}
+
+	targets, apierr := a.scopeTargets(appt, scope)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	excluded := make([]int, len(targets))
+	previous := make([]entity.Appointment, len(targets))
+	for i, target := range targets {
+		excluded[i] = target.ID
+		previous[i] = *target
+	}
+
+	// Appointments that already began keep their timing and resource, e.g. they cannot be made
+	// longer or moved elsewhere afterwards
+	timingChanged := req.BeginsAt != "" || req.EndsAt != "" || req.Duration != 0
+	resourceChanged := req.ResourceID != 0 && req.ResourceID != appt.ResourceID
+	if (timingChanged || resourceChanged) && !isFuture(appt.BeginsAt) {
+		return nil, apierror.AppointmentInPastError
+	}
+
+	if timingChanged || req.ResourceID != 0 {
+		resourceID := appt.ResourceID
+		if req.ResourceID != 0 {
+			if apierr := a.checkResource(req.ResourceID); apierr != nil {
+				return nil, apierr
+			}
+			resourceID = req.ResourceID
+		}
+
+		begin := appt.BeginsAt
+		if req.BeginsAt != "" {
+			begin, err = utils.FromEpoch(req.BeginsAt)
+			if err != nil {
+				return nil, apierror.MalformedBodyError
+			}
+
+			if apierr := a.checkBegin(begin); apierr != nil {
+				return nil, apierr
+			}
+		}
+		shift := begin - appt.BeginsAt
+
+		// Moving an appointment keeps its current length, unless a new one is given
+		var length int64
+		if req.EndsAt != "" || req.Duration != 0 {
+			end, apierr := a.resolveEnd(begin, req.EndsAt, req.Duration, 0)
+			if apierr != nil {
+				return nil, apierr
+			}
+			length = end - begin
+		}
+
+		first, last := targets[0], targets[len(targets)-1]
+		from := min(first.BeginsAt, first.BeginsAt+shift)
+		to := max(last.EndsAt, last.EndsAt+shift, last.BeginsAt+shift+length)
+		schedule, err := loadOpeningSchedule(a.AvailabilityRepo, a.Config.Location, from, to)
+		if err != nil {
+			log.Errorf("failed to load opening hours: %v", err)
+			return nil, apierror.InternalServerError
+		}
+
+		begins := make([]int64, len(targets))
+		ends := make([]int64, len(targets))
+		conflicts := make([]string, 0)
+		for i, target := range targets {
+			begins[i] = target.BeginsAt + shift
+			ends[i] = target.EndsAt + shift
+			if length > 0 {
+				ends[i] = begins[i] + length
+			}
+
+			if target.ID != appt.ID && a.checkBegin(begins[i]) != nil {
+				conflicts = append(conflicts, utils.FormatEpoch(begins[i]))
+				continue
+			}
+
+			if !schedule.isOpen(begins[i], ends[i]) {
+				if len(targets) == 1 {
+					return nil, apierror.OutsideOpeningHoursError
+				}
+				conflicts = append(conflicts, utils.FormatEpoch(begins[i]))
+				continue
+			}
+
+			// Moved occurrences cannot overlap each other either (e.g., when made longer)
+			if i > 0 && begins[i] <= ends[i-1] {
+				conflicts = append(conflicts, utils.FormatEpoch(begins[i]))
+			}
+		}
+
+		if len(conflicts) > 0 {
+			if len(targets) == 1 {
+				return nil, apierror.MomentNotAvailable
+			}
+			return nil, apierror.NewConflictsError(conflicts)
+		}
+
+		for i, target := range targets {
+			target.BeginsAt = begins[i]
+			target.EndsAt = ends[i]
+			target.ResourceID = resourceID
+		}
+	}
+
+	now := utils.NowUTC()
+	for _, target := range targets {
+		if req.Title != "" {
+			target.Title = req.Title
+		}
+		target.UpdatedAt = now
+		target.UpdatedBy = caller.ID
+	}
+
+	// The new periods are checked against everybody else's right when they are saved
+	var taken []*entity.Appointment
+	err = a.Tx.Transaction(func(tx *TxRepositories) error {
+		taken, err = tx.Appointments.Book(targets, excluded...)
+		if err != nil || len(taken) > 0 {
+			return err
+		}
+
+		var msgs []*entity.OutboxMessage
+		for i, target := range targets {
+			before := &previous[i]
+			if target.BeginsAt == before.BeginsAt && target.EndsAt == before.EndsAt && target.ResourceID == before.ResourceID {
+				continue
+			}
+
+			msg, err := webhookMessage(EventAppointmentRescheduled, &RescheduledEventData{
+				AppointmentResponse: toAppointmentResponse(target),
+				PreviousBeginsAt:    utils.FormatEpoch(before.BeginsAt),
+				PreviousEndsAt:      utils.FormatEpoch(before.EndsAt),
+				PreviousResourceID:  before.ResourceID,
+			})
+			if err != nil {
+				return err
+			}
+			msgs = append(msgs, msg)
+		}
+		return tx.Outbox.Enqueue(msgs...)
+	})
+
+	if err != nil {
+		log.Errorf("failed to update appointment by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if len(taken) > 0 {
+		if len(targets) == 1 {
+			return nil, apierror.MomentNotAvailable
+		}
+		return nil, apierror.NewConflictsError(formatBegins(taken))
+	}
+
+	// Moved appointments free their previous period, which may overlap the new one
+	var freed, booked []*entity.Appointment
+	for i, target := range targets {
+		before := &previous[i]
+		if target.BeginsAt != before.BeginsAt || target.EndsAt != before.EndsAt || target.ResourceID != before.ResourceID {
+			freed = append(freed, before)
+			booked = append(booked, target)
+		}
+	}
+
+	a.Calendar.Publish(append(slotEvents(SlotFreed, freed...), slotEvents(SlotTaken, booked...)...)...)
+	return toAppointmentResponse(appt), nil
+}
+
+func (a *DefaultAppointmentService) GetCalendar(resourceID int, monthStart, monthEnd int64) (*CalendarResponse, apierror.ErrorResponse) {
+	if apierr := a.requireResource(resourceID); apierr != nil {
+		return nil, apierr
+	}
+
+	appts, err := a.AppointmentRepo.FindMonthAppointments(resourceID, monthStart, monthEnd)
 	if err != nil {
 		log.Errorf("failed to fetch appointments availability [%d - %d]: %v", monthStart, monthEnd, err)
 		return nil, apierror.InternalServerError
@@ -173,12 +794,394 @@ func (a *DefaultAppointmentService) GetCalendar(monthStart, monthEnd int64) (*Ca
 		schedDays[i] = toScheduledDay(appt)
 	}
 
+	schedule, err := loadOpeningSchedule(a.AvailabilityRepo, a.Config.Location, monthStart, monthEnd)
+	if err != nil {
+		log.Errorf("failed to load opening hours [%d - %d]: %v", monthStart, monthEnd, err)
+		return nil, apierror.InternalServerError
+	}
+
+	closed := schedule.closedPeriods(monthStart, monthEnd)
+	closedPeriods := make([]*ScheduledDay, len(closed))
+	for i, p := range closed {
+		closedPeriods[i] = toScheduledPeriod(p)
+	}
+
 	calendar := &CalendarResponse{
+		ResourceID:    resourceID,
 		ScheduledDays: schedDays,
+		ClosedPeriods: closedPeriods,
 	}
 	return calendar, nil
 }
 
+// scopeTargets returns the appointments affected by an operation on appt, in chronological
+// order. Appointments that are not recurring are treated as a series of one.
+func (a *DefaultAppointmentService) scopeTargets(appt *entity.Appointment, scope string) ([]*entity.Appointment, apierror.ErrorResponse) {
+	if scope == ScopeThis || appt.SeriesID == 0 {
+		return []*entity.Appointment{appt}, nil
+	}
+
+	siblings, err := a.AppointmentRepo.FindBySeriesID(appt.SeriesID)
+	if err != nil {
+		log.Errorf("failed to fetch appointments of series %d: %v", appt.SeriesID, err)
+		return nil, apierror.InternalServerError
+	}
+
+	now := utils.NowUTC()
+	var targets []*entity.Appointment
+	for _, sibling := range siblings {
+		if sibling.ID == appt.ID {
+			targets = append(targets, appt)
+			continue
+		}
+
+		following := scope == ScopeFollowing && sibling.BeginsAt > appt.BeginsAt
+		upcoming := scope == ScopeAll && sibling.BeginsAt > now
+		if following || upcoming {
+			targets = append(targets, sibling)
+		}
+	}
+	return targets, nil
+}
+
+// closeSeries updates the series rule along with the cancellation of its following
+// (or all upcoming) occurrences, through the repository of the same transaction.
+func closeSeries(apptRepo AppointmentRepository, appt *entity.Appointment, scope string) error {
+	series, err := apptRepo.FindSeriesByID(appt.SeriesID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch series %d: %w", appt.SeriesID, err)
+	}
+
+	if series == nil {
+		return fmt.Errorf("series %d not found", appt.SeriesID)
+	}
+
+	if scope == ScopeAll {
+		series.IsDeleted = true
+	} else {
+		series.Count = 0
+		series.Until = appt.BeginsAt - 1
+	}
+
+	series.UpdatedAt = utils.NowUTC()
+	return apptRepo.SaveSeries(series)
+}
+
+// enqueueChanges tells the owner of the appointments (which all belong to the same user and
+// resource) what happened to them, and publishes an event for each of them.
+func enqueueChanges(outbox OutboxRepository, kind notification.Kind, eventType string, appts []*entity.Appointment) error {
+	msg, err := notificationMessage(kind, appts, 0)
+	if err != nil {
+		return err
+	}
+
+	msgs := []*entity.OutboxMessage{msg}
+	for _, appt := range appts {
+		msg, err = webhookMessage(eventType, toAppointmentResponse(appt))
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	return outbox.Enqueue(msgs...)
+}
+
+// newNotificationEvent loads the owner and resource of the appointments. It returns a nil event
+// when there is nobody left to notify, i.e. the owner deleted their account.
+func newNotificationEvent(userRepo UserRepository, resourceRepo ResourceRepository, kind notification.Kind, appts []*entity.Appointment) (*notification.Event, error) {
+	owner, err := userRepo.FindByID(appts[0].UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner == nil || owner.IsDeleted {
+		return nil, nil
+	}
+
+	resource, err := resourceRepo.FindByID(appts[0].ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification.Event{
+		Kind:         kind,
+		User:         owner,
+		Resource:     resource,
+		Appointments: appts,
+	}, nil
+}
+
+// checkResource makes sure the given resource exists and can be booked.
+func (a *DefaultAppointmentService) checkResource(resourceID int) apierror.ErrorResponse {
+	resource, err := a.ResourceRepo.FindByID(resourceID)
+	if err != nil {
+		log.Errorf("failed to fetch resource by id %d: %v", resourceID, err)
+		return apierror.InternalServerError
+	}
+
+	if resource == nil || resource.IsDeleted {
+		return apierror.InvalidResourceError
+	}
+	return nil
+}
+
+// checkOpeningHours makes sure the whole appointment fits in the opening hours.
+func (a *DefaultAppointmentService) checkOpeningHours(begin, end int64) apierror.ErrorResponse {
+	schedule, err := loadOpeningSchedule(a.AvailabilityRepo, a.Config.Location, begin, end)
+	if err != nil {
+		log.Errorf("failed to load opening hours [%d - %d]: %v", begin, end, err)
+		return apierror.InternalServerError
+	}
+
+	if !schedule.isOpen(begin, end) {
+		return apierror.OutsideOpeningHoursError
+	}
+	return nil
+}
+
+// checkBegin applies the rules every appointment begin date must follow.
+func (a *DefaultAppointmentService) checkBegin(begin int64) apierror.ErrorResponse {
+	if !utils.IsAligned(begin, a.Config.SlotGranularity) {
+		if a.Config.SlotGranularity == time.Hour {
+			return apierror.HourNotExactError
+		}
+		return apierror.NewTimeNotAlignedError(a.Config.SlotGranularity)
+	}
+
+	if !isFuture(begin) {
+		return apierror.AppointmentInPastError
+	}
+	return nil
+}
+
+// resolveEnd computes the (inclusive) end of an appointment from either an exclusive
+// end date or a duration in minutes. The fallback length is used if neither is given.
+func (a *DefaultAppointmentService) resolveEnd(begin int64, endsAt string, minutes int, fallback time.Duration) (int64, apierror.ErrorResponse) {
+	if endsAt != "" && minutes != 0 {
+		return 0, apierror.AmbiguousEndError
+	}
+
+	length := fallback
+	if endsAt != "" {
+		end, err := utils.FromEpoch(endsAt)
+		if err != nil {
+			return 0, apierror.MalformedBodyError
+		}
+
+		if end <= begin {
+			return 0, apierror.EndBeforeBeginError
+		}
+		length = time.Duration(end-begin) * time.Millisecond
+	} else if minutes != 0 {
+		length = time.Duration(minutes) * time.Minute
+	}
+
+	if apierr := a.checkLength(length); apierr != nil {
+		return 0, apierr
+	}
+	return begin + length.Milliseconds() - 1, nil
+}
+
+func (a *DefaultAppointmentService) checkLength(length time.Duration) apierror.ErrorResponse {
+	if length < a.Config.MinDuration || length > a.Config.MaxDuration {
+		return apierror.NewInvalidDurationError(a.Config.MinDuration, a.Config.MaxDuration)
+	}
+	return nil
+}
+
+// GetFreeSlots lists every slot beginning between from and to in which an appointment of the
+// given length (in minutes, zero for the default one) could be booked right now. It applies
+// the same rules as CreateAppointment: slot granularity, no past dates, opening hours and,
+// of course, the existing appointments.
+func (a *DefaultAppointmentService) GetFreeSlots(resourceID int, from, to int64, minutes int) (*SlotsResponse, apierror.ErrorResponse) {
+	if to <= from {
+		return nil, apierror.InvalidRangeError
+	}
+
+	if to-from > maxSlotRange.Milliseconds() {
+		return nil, apierror.NewRangeTooLargeError(maxSlotRange)
+	}
+
+	if apierr := a.requireResource(resourceID); apierr != nil {
+		return nil, apierr
+	}
+
+	length, apierr := a.slotLength(minutes)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	free, apierr := a.findFreeSlots(resourceID, from, to, length, 0)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	slots := make([]*ScheduledDay, len(free))
+	for i, p := range free {
+		slots[i] = toScheduledPeriod(p)
+	}
+
+	return &SlotsResponse{
+		ResourceID: resourceID,
+		Duration:   int(length / time.Minute),
+		Slots:      slots,
+	}, nil
+}
+
+// GetNextSlot finds the earliest slot after the given date in which an appointment of the
+// given length (in minutes, zero for the default one) could be booked right now.
+func (a *DefaultAppointmentService) GetNextSlot(resourceID int, after int64, minutes int) (*ScheduledDay, apierror.ErrorResponse) {
+	if apierr := a.requireResource(resourceID); apierr != nil {
+		return nil, apierr
+	}
+
+	length, apierr := a.slotLength(minutes)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	// Search one chunk at a time, so appointments are not loaded for the whole horizon at once
+	from := max(after, utils.NowUTC())
+	horizon := from + nextSlotHorizon.Milliseconds()
+	for from < horizon {
+		to := min(from+maxSlotRange.Milliseconds(), horizon)
+		free, apierr := a.findFreeSlots(resourceID, from, to, length, 1)
+		if apierr != nil {
+			return nil, apierr
+		}
+
+		if len(free) > 0 {
+			return toScheduledPeriod(free[0]), nil
+		}
+		from = to
+	}
+	return nil, apierror.NoSlotAvailableError
+}
+
+// findFreeSlots returns up to limit (zero for no limit) free slots beginning between from and to.
+func (a *DefaultAppointmentService) findFreeSlots(resourceID int, from, to int64, length time.Duration, limit int) ([]period, apierror.ErrorResponse) {
+	step := a.Config.SlotGranularity.Milliseconds()
+	lengthMillis := length.Milliseconds()
+
+	// Slots must begin in the future, just like in CreateAppointment
+	first := alignUp(max(from, utils.NowUTC()+1), step)
+	last := to + lengthMillis
+
+	appts, err := a.AppointmentRepo.FindMonthAppointments(resourceID, first, last)
+	if err != nil {
+		log.Errorf("failed to fetch appointments availability [%d - %d]: %v", first, last, err)
+		return nil, apierror.InternalServerError
+	}
+
+	schedule, err := loadOpeningSchedule(a.AvailabilityRepo, a.Config.Location, first, last)
+	if err != nil {
+		log.Errorf("failed to load opening hours [%d - %d]: %v", first, last, err)
+		return nil, apierror.InternalServerError
+	}
+	open := schedule.openPeriods(first, last)
+
+	// Both appointments and open periods are sorted and never overlap each other,
+	// so they can be walked along with the candidates instead of searched every time.
+	var slots []period
+	nextAppt, nextOpen := 0, 0
+	for begin := first; begin < to; begin += step {
+		end := begin + lengthMillis
+
+		for nextAppt < len(appts) && appts[nextAppt].EndsAt < begin {
+			nextAppt++
+		}
+
+		if nextAppt < len(appts) && appts[nextAppt].BeginsAt < end {
+			continue
+		}
+
+		for nextOpen < len(open) && open[nextOpen].end < end {
+			nextOpen++
+		}
+
+		if nextOpen == len(open) {
+			break
+		}
+
+		if open[nextOpen].begin > begin {
+			continue
+		}
+
+		slots = append(slots, period{begin: begin, end: end})
+		if limit > 0 && len(slots) == limit {
+			break
+		}
+	}
+	return slots, nil
+}
+
+// slotLength converts a length in minutes (zero for the default one) to a valid appointment length.
+func (a *DefaultAppointmentService) slotLength(minutes int) (time.Duration, apierror.ErrorResponse) {
+	length := a.Config.DefaultDuration
+	if minutes != 0 {
+		length = time.Duration(minutes) * time.Minute
+	}
+
+	if apierr := a.checkLength(length); apierr != nil {
+		return 0, apierr
+	}
+	return length, nil
+}
+
+// resolveOwner finds the user an appointment is booked for. Users book for themselves,
+// while those who can manage all appointments can book on behalf of anyone by giving their ID.
+func (a *DefaultAppointmentService) resolveOwner(caller *entity.User, userID int) (*entity.User, apierror.ErrorResponse) {
+	if userID == 0 || userID == caller.ID {
+		return caller, nil
+	}
+
+	if !authz.Can(caller, authz.AppointmentsManageAll) {
+		return nil, apierror.ForbiddenError
+	}
+
+	owner, err := a.UserRepo.FindByID(userID)
+	if err != nil {
+		log.Errorf("failed to fetch user by id %d: %v", userID, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if owner == nil || owner.IsDeleted {
+		return nil, apierror.InvalidUserError
+	}
+	return owner, nil
+}
+
+// requireResource makes sure the given resource exists, for read-only operations.
+func (a *DefaultAppointmentService) requireResource(resourceID int) apierror.ErrorResponse {
+	resource, err := a.ResourceRepo.FindByID(resourceID)
+	if err != nil {
+		log.Errorf("failed to fetch resource by id %d: %v", resourceID, err)
+		return apierror.InternalServerError
+	}
+
+	if resource == nil || resource.IsDeleted {
+		return apierror.NotFoundError
+	}
+	return nil
+}
+
+// alignUp rounds the given epoch milliseconds up to the next multiple of step.
+func alignUp(millis, step int64) int64 {
+	if step <= 0 || millis%step == 0 {
+		return millis
+	}
+	return millis - millis%step + step
+}
+
+// formatBegins lists the begin date of the given appointments, e.g., to report conflicts.
+func formatBegins(appts []*entity.Appointment) []string {
+	begins := make([]string, len(appts))
+	for i, appt := range appts {
+		begins[i] = utils.FormatEpoch(appt.BeginsAt)
+	}
+	return begins
+}
+
 func isFuture(millis int64) bool {
 	now := utils.NowUTC()
 	return millis > now
@@ -188,18 +1191,52 @@ func toScheduledDay(appt *entity.Appointment) *ScheduledDay {
 	return &ScheduledDay{
 		BeginsAt: utils.FormatEpoch(appt.BeginsAt),
 		EndsAt:   utils.FormatEpoch(appt.EndsAt),
+		Duration: durationMinutes(appt),
+	}
+}
+
+// toScheduledPeriod follows the same (inclusive) end convention as appointments.
+func toScheduledPeriod(p period) *ScheduledDay {
+	return &ScheduledDay{
+		BeginsAt: utils.FormatEpoch(p.begin),
+		EndsAt:   utils.FormatEpoch(p.end - 1),
+		Duration: int((p.end - p.begin) / time.Minute.Milliseconds()),
 	}
 }
 
+// durationMinutes returns the length of the appointment in minutes.
+// Remember that EndsAt is inclusive, i.e., one millisecond before the actual end.
+func durationMinutes(appt *entity.Appointment) int {
+	return int((appt.EndsAt - appt.BeginsAt + 1) / time.Minute.Milliseconds())
+}
+
+// canManage tells whether the user can change or cancel the appointment, which is
+// the case for its owner and for those who can manage all appointments.
+func canManage(user *entity.User, appt *entity.Appointment) bool {
+	return appt.UserID == user.ID || authz.Can(user, authz.AppointmentsManageAll)
+}
+
 func toAppointmentResponse(appt *entity.Appointment) *AppointmentResponse {
-	return &AppointmentResponse{
-		ID:        appt.ID,
-		UserID:    appt.UserID,
-		IsDeleted: appt.IsDeleted,
-		Title:     appt.Title,
-		BeginsAt:  utils.FormatEpoch(appt.BeginsAt),
-		EndsAt:    utils.FormatEpoch(appt.EndsAt),
-		CreatedAt: utils.FormatEpoch(appt.CreatedAt),
-		UpdatedAt: utils.FormatEpoch(appt.UpdatedAt),
+	resp := &AppointmentResponse{
+		ID:         appt.ID,
+		UserID:     appt.UserID,
+		ResourceID: appt.ResourceID,
+		SeriesID:   appt.SeriesID,
+		IsDeleted:  appt.IsDeleted,
+		Title:      appt.Title,
+		BeginsAt:   utils.FormatEpoch(appt.BeginsAt),
+		EndsAt:     utils.FormatEpoch(appt.EndsAt),
+		Duration:   durationMinutes(appt),
+		CreatedAt:  utils.FormatEpoch(appt.CreatedAt),
+		UpdatedAt:  utils.FormatEpoch(appt.UpdatedAt),
+		BookedBy:   appt.BookedBy,
+		UpdatedBy:  appt.UpdatedBy,
+	}
+
+	if appt.IsDeleted {
+		resp.CancelledBy = appt.CancelledBy
+		resp.CancelledAt = utils.FormatEpoch(appt.CancelledAt)
+		resp.CancelReason = appt.CancelReason
 	}
+	return resp
 }
@@ -0,0 +1,460 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/notification"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	member = &entity.User{ID: 1, Role: authz.RoleMember}
+	other  = &entity.User{ID: 2, Role: authz.RoleMember}
+	staff  = &entity.User{ID: 3, Role: authz.RoleStaff}
+)
+
+// tomorrow returns an aligned begin date in the future, offset by the given number of hours.
+func tomorrow(hours int) time.Time {
+	return time.Now().UTC().Add(24 * time.Hour).Truncate(time.Hour).Add(time.Duration(hours) * time.Hour)
+}
+
+func newTestAppointmentService(appts ...*entity.Appointment) (*DefaultAppointmentService, *fakeAppointmentRepo) {
+	apptRepo := &fakeAppointmentRepo{appts: appts}
+	userRepo := &fakeUserRepo{users: []*entity.User{member, other, staff}}
+	resourceRepo := &fakeResourceRepo{resources: []*entity.Resource{
+		{ID: 1, Name: "Room"},
+		{ID: 2, Name: "Old room", IsDeleted: true},
+		{ID: 3, Name: "Other room"},
+	}}
+
+	tx := &fakeTransactor{repos: &TxRepositories{Users: userRepo, Appointments: apptRepo, Outbox: &fakeOutboxRepo{}}}
+	svc := NewAppointmentService(apptRepo, userRepo, resourceRepo, &fakeAvailabilityRepo{}, newTestValidator(), DefaultAppointmentConfig(), tx, NewCalendarBroker())
+	return svc, apptRepo
+}
+
+// flushOutbox hands the messages queued by the service to the notification and webhook
+// handlers, and returns what they sent.
+func flushOutbox(t *testing.T, svc *DefaultAppointmentService) (*fakeNotifier, *fakePublisher) {
+	t.Helper()
+	notifier, publisher := &fakeNotifier{}, &fakePublisher{}
+	outbox := svc.Tx.(*fakeTransactor).repos.Outbox.(*fakeOutboxRepo)
+
+	dispatcher := NewOutboxDispatcher(outbox, &OutboxConfig{MaxAttempts: 1})
+	dispatcher.Handle(OutboxNotification, NotificationHandler(svc.AppointmentRepo, svc.UserRepo, svc.ResourceRepo, notifier))
+	dispatcher.Handle(OutboxWebhookEvent, WebhookHandler(publisher))
+	dispatcher.DispatchDue(utils.NowUTC())
+
+	if len(outbox.msgs) != 0 {
+		t.Fatalf("outbox messages %v were not handled", outbox.kinds())
+	}
+	return notifier, publisher
+}
+
+// existing builds a one hour appointment on resource 1.
+func existing(id int, owner *entity.User, begin time.Time, deleted bool) *entity.Appointment {
+	return &entity.Appointment{
+		ID:         id,
+		UserID:     owner.ID,
+		BookedBy:   owner.ID,
+		ResourceID: 1,
+		BeginsAt:   begin.UnixMilli(),
+		EndsAt:     begin.Add(time.Hour).UnixMilli() - 1,
+		IsDeleted:  deleted,
+	}
+}
+
+func TestCreateAppointment(t *testing.T) {
+	tests := []struct {
+		name       string
+		caller     *entity.User
+		begin      time.Time
+		resourceID int
+		userID     int
+		want       apierror.ErrorResponse
+		wantOwner  int
+	}{
+		{name: "booked", caller: member, begin: tomorrow(2), resourceID: 1, wantOwner: member.ID},
+		{name: "in the past", caller: member, begin: tomorrow(-48), resourceID: 1, want: apierror.AppointmentInPastError},
+		{name: "not aligned", caller: member, begin: tomorrow(2).Add(time.Minute), resourceID: 1, want: apierror.HourNotExactError},
+		{name: "unknown resource", caller: member, begin: tomorrow(2), resourceID: 9, want: apierror.InvalidResourceError},
+		{name: "deleted resource", caller: member, begin: tomorrow(2), resourceID: 2, want: apierror.InvalidResourceError},
+		{name: "conflict", caller: member, begin: tomorrow(0), resourceID: 1, want: apierror.MomentNotAvailable},
+		{name: "right after another one", caller: member, begin: tomorrow(1), resourceID: 1, wantOwner: member.ID},
+		{name: "member on behalf of someone", caller: member, begin: tomorrow(2), resourceID: 1, userID: other.ID, want: apierror.ForbiddenError},
+		{name: "staff on behalf of someone", caller: staff, begin: tomorrow(2), resourceID: 1, userID: other.ID, wantOwner: other.ID},
+		{name: "staff on behalf of unknown user", caller: staff, begin: tomorrow(2), resourceID: 1, userID: 99, want: apierror.InvalidUserError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestAppointmentService(existing(1, other, tomorrow(0), false))
+
+			req := &AppointmentRequest{
+				BeginsAt:   tt.begin.Format(time.RFC3339),
+				ResourceID: tt.resourceID,
+				UserID:     tt.userID,
+			}
+
+			resp, got := svc.CreateAppointment(req, tt.caller)
+			if got != tt.want {
+				t.Fatalf("CreateAppointment() = %v, want %v", got, tt.want)
+			}
+
+			if tt.want != nil {
+				return
+			}
+
+			if resp.UserID != tt.wantOwner || resp.BookedBy != tt.caller.ID {
+				t.Errorf("user = %d, booked by = %d, want %d and %d", resp.UserID, resp.BookedBy, tt.wantOwner, tt.caller.ID)
+			}
+
+			notifier, publisher := flushOutbox(t, svc)
+			events := notifier.events
+			if len(events) != 1 || events[0].Kind != notification.Booked || events[0].User.ID != tt.wantOwner {
+				t.Errorf("unexpected notifications %+v, want one booked event for user %d", events, tt.wantOwner)
+			}
+
+			if published := publisher.types(); !slices.Equal(published, []string{EventAppointmentCreated}) {
+				t.Errorf("published %v, want one appointment.created event", published)
+			}
+		})
+	}
+}
+
+func TestDeleteAppointment(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  *entity.User
+		begin   time.Time
+		deleted bool
+		want    apierror.ErrorResponse
+	}{
+		{name: "owner", caller: member},
+		{name: "staff", caller: staff},
+		{name: "someone else", caller: other, want: apierror.NotFoundError},
+		{name: "already cancelled", caller: member, deleted: true, want: apierror.NotFoundError},
+		{name: "ongoing", caller: member, begin: tomorrow(-24)},
+		{name: "ended", caller: member, begin: tomorrow(-48), want: apierror.AppointmentEndedError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.begin.IsZero() {
+				tt.begin = tomorrow(0)
+			}
+			appt := existing(1, member, tt.begin, tt.deleted)
+			svc, _ := newTestAppointmentService(appt)
+
+			got := svc.DeleteAppointment(1, &CancelAppointmentRequest{Reason: "sick"}, tt.caller)
+			if got != tt.want {
+				t.Fatalf("DeleteAppointment() = %v, want %v", got, tt.want)
+			}
+
+			if tt.want != nil {
+				return
+			}
+
+			if !appt.IsDeleted || appt.CancelledBy != tt.caller.ID || appt.CancelledAt == 0 || appt.CancelReason != "sick" {
+				t.Errorf("unexpected cancelled appointment %+v", appt)
+			}
+
+			notifier, publisher := flushOutbox(t, svc)
+			events := notifier.events
+			if len(events) != 1 || events[0].Kind != notification.Cancelled || events[0].User.ID != member.ID {
+				t.Errorf("unexpected notifications %+v, want one cancelled event for the owner", events)
+			}
+
+			if published := publisher.types(); !slices.Equal(published, []string{EventAppointmentCancelled}) {
+				t.Errorf("published %v, want one appointment.cancelled event", published)
+			}
+		})
+	}
+}
+
+func TestRestoreAppointment(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  *entity.User
+		begin   time.Time
+		deleted bool
+		taken   bool // Whether another appointment took the period meanwhile
+		closed  bool // Whether the day was closed meanwhile
+		gone    bool // Whether the account of the owner was deleted meanwhile
+		series  *entity.AppointmentSeries
+		want    apierror.ErrorResponse
+	}{
+		{name: "restored", caller: member, begin: tomorrow(0), deleted: true},
+		{name: "by staff", caller: staff, begin: tomorrow(0), deleted: true},
+		{name: "someone else", caller: other, begin: tomorrow(0), deleted: true, want: apierror.NotFoundError},
+		{name: "not cancelled", caller: member, begin: tomorrow(0), want: apierror.NotCancelledError},
+		{name: "in the past", caller: member, begin: tomorrow(-48), deleted: true, want: apierror.AppointmentInPastError},
+		{name: "period taken", caller: member, begin: tomorrow(0), deleted: true, taken: true, want: apierror.MomentNotAvailable},
+		{name: "day closed", caller: member, begin: tomorrow(0), deleted: true, closed: true, want: apierror.OutsideOpeningHoursError},
+		{name: "not aligned", caller: member, begin: tomorrow(0).Add(30 * time.Minute), deleted: true, want: apierror.HourNotExactError},
+		{name: "owner deleted", caller: staff, begin: tomorrow(0), deleted: true, gone: true, want: apierror.NotRestorableError},
+		{name: "series going on", caller: member, begin: tomorrow(0), deleted: true, series: &entity.AppointmentSeries{ID: 1, Count: 3}},
+		{name: "series cancelled", caller: member, begin: tomorrow(0), deleted: true, series: &entity.AppointmentSeries{ID: 1, IsDeleted: true}, want: apierror.NotRestorableError},
+		{name: "series ended before", caller: member, begin: tomorrow(0), deleted: true, series: &entity.AppointmentSeries{ID: 1, Until: tomorrow(0).UnixMilli() - 1}, want: apierror.NotRestorableError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appt := existing(1, member, tt.begin, tt.deleted)
+			appt.CancelledBy = member.ID
+			appt.CancelReason = "sick"
+
+			appts := []*entity.Appointment{appt}
+			if tt.taken {
+				appts = append(appts, existing(2, other, tt.begin, false))
+			}
+			svc, repo := newTestAppointmentService(appts...)
+			if tt.series != nil {
+				appt.SeriesID = tt.series.ID
+				repo.series = append(repo.series, tt.series)
+			}
+
+			if tt.gone {
+				owner := &entity.User{ID: 4, IsDeleted: true}
+				appt.UserID = owner.ID
+				userRepo := svc.UserRepo.(*fakeUserRepo)
+				userRepo.users = append(userRepo.users, owner)
+			}
+
+			if tt.closed {
+				override := &entity.DateOverride{Date: tt.begin.Format(time.DateOnly), IsClosed: true}
+				_ = svc.AvailabilityRepo.SaveOverride(override)
+			}
+
+			sub, _ := svc.Calendar.(*CalendarBroker).Subscribe(CalendarFilter{ResourceID: 1, From: 0, To: tomorrow(24).UnixMilli()}, 0)
+			_, got := svc.RestoreAppointment(1, tt.caller)
+			if got != tt.want {
+				t.Fatalf("RestoreAppointment() = %v, want %v", got, tt.want)
+			}
+
+			if tt.want != nil {
+				return
+			}
+
+			if appt.IsDeleted || appt.CancelledBy != 0 || appt.CancelReason != "" || appt.UpdatedBy != tt.caller.ID {
+				t.Errorf("unexpected restored appointment %+v", appt)
+			}
+
+			notifier, publisher := flushOutbox(t, svc)
+			if len(notifier.events) != 1 || notifier.events[0].Kind != notification.Booked || !slices.Equal(publisher.types(), []string{EventAppointmentCreated}) {
+				t.Errorf("notified %+v, published %v, want the appointment booked again", notifier.events, publisher.types())
+			}
+
+			if streamed := receive(sub); !slices.Equal(streamed, []string{SlotTaken}) {
+				t.Errorf("streamed %v, want the slot taken", streamed)
+			}
+		})
+	}
+}
+
+func TestUpdateAppointmentPublishesReschedule(t *testing.T) {
+	appt := existing(1, member, tomorrow(0), false)
+	svc, _ := newTestAppointmentService(appt)
+
+	_, apierr := svc.UpdateAppointment(1, &UpdateAppointmentRequest{Title: "Renamed"}, "", member)
+	if notifier, publisher := flushOutbox(t, svc); apierr != nil || len(publisher.events) != 0 || len(notifier.events) != 0 {
+		t.Fatalf("UpdateAppointment() = %v, published %v, want no event for a new title", apierr, publisher.types())
+	}
+
+	_, apierr = svc.UpdateAppointment(1, &UpdateAppointmentRequest{BeginsAt: tomorrow(3).Format(time.RFC3339)}, "", member)
+	if apierr != nil {
+		t.Fatalf("UpdateAppointment() = %v", apierr)
+	}
+
+	_, publisher := flushOutbox(t, svc)
+	if len(publisher.events) != 1 || publisher.events[0].Type != EventAppointmentRescheduled {
+		t.Fatalf("published %v, want one appointment.rescheduled event", publisher.types())
+	}
+
+	var data RescheduledEventData
+	err := json.Unmarshal(publisher.events[0].Data.(json.RawMessage), &data)
+	if err != nil || data.AppointmentResponse == nil {
+		t.Fatalf("unexpected event data %s (%v)", publisher.events[0].Data, err)
+	}
+
+	if data.ID != 1 || data.BeginsAt != utils.FormatEpoch(tomorrow(3).UnixMilli()) || data.PreviousBeginsAt != utils.FormatEpoch(tomorrow(0).UnixMilli()) {
+		t.Errorf("unexpected event data %+v", data)
+	}
+}
+
+func TestUpdateStartedAppointment(t *testing.T) {
+	tests := []struct {
+		name string
+		req  UpdateAppointmentRequest
+		want apierror.ErrorResponse
+	}{
+		{name: "title", req: UpdateAppointmentRequest{Title: "Renamed"}},
+		{name: "duration", req: UpdateAppointmentRequest{Duration: 120}, want: apierror.AppointmentInPastError},
+		{name: "end", req: UpdateAppointmentRequest{EndsAt: tomorrow(-22).Format(time.RFC3339)}, want: apierror.AppointmentInPastError},
+		{name: "begin", req: UpdateAppointmentRequest{BeginsAt: tomorrow(2).Format(time.RFC3339)}, want: apierror.AppointmentInPastError},
+		{name: "same resource", req: UpdateAppointmentRequest{Title: "Renamed", ResourceID: 1}},
+		{name: "resource", req: UpdateAppointmentRequest{ResourceID: 3}, want: apierror.AppointmentInPastError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Began at the start of the current hour, and still going on
+			appt := existing(1, member, tomorrow(-24), false)
+			svc, _ := newTestAppointmentService(appt)
+			previous := *appt
+
+			_, got := svc.UpdateAppointment(1, &tt.req, "", member)
+			if got != tt.want {
+				t.Fatalf("UpdateAppointment() = %v, want %v", got, tt.want)
+			}
+
+			if appt.BeginsAt != previous.BeginsAt || appt.EndsAt != previous.EndsAt || appt.ResourceID != previous.ResourceID {
+				t.Errorf("unexpected timing %+v, want it unchanged", appt)
+			}
+		})
+	}
+}
+
+func TestGetAppointments(t *testing.T) {
+	tests := []struct {
+		name           string
+		caller         *entity.User
+		includeDeleted bool
+		want           apierror.ErrorResponse
+		wantIDs        []int
+	}{
+		{name: "own only", caller: member, wantIDs: []int{1}},
+		{name: "member with cancelled", caller: member, includeDeleted: true, want: apierror.ForbiddenError},
+		{name: "staff sees everyone", caller: staff, wantIDs: []int{1, 3}},
+		{name: "staff with cancelled", caller: staff, includeDeleted: true, wantIDs: []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestAppointmentService(
+				existing(1, member, tomorrow(0), false),
+				existing(2, member, tomorrow(1), true),
+				existing(3, other, tomorrow(2), false),
+			)
+
+			resp, got := svc.GetAppointments(tt.includeDeleted, tt.caller)
+			if got != tt.want {
+				t.Fatalf("GetAppointments() = %v, want %v", got, tt.want)
+			}
+
+			if len(resp) != len(tt.wantIDs) {
+				t.Fatalf("got %d appointments, want %v", len(resp), tt.wantIDs)
+			}
+
+			for i, appt := range resp {
+				if appt.ID != tt.wantIDs[i] {
+					t.Errorf("appointment %d has ID %d, want %d", i, appt.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteAppointmentClosesSeries(t *testing.T) {
+	for _, scope := range []string{ScopeFollowing, ScopeAll} {
+		t.Run(scope, func(t *testing.T) {
+			var appts []*entity.Appointment
+			for i := range 3 {
+				appt := existing(i+1, member, tomorrow(24*i), false)
+				appt.SeriesID = 1
+				appts = append(appts, appt)
+			}
+
+			svc, repo := newTestAppointmentService(appts...)
+			series := &entity.AppointmentSeries{ID: 1, UserID: member.ID, ResourceID: 1, Count: 3}
+			repo.series = append(repo.series, series)
+
+			if apierr := svc.DeleteAppointment(2, &CancelAppointmentRequest{Scope: scope}, member); apierr != nil {
+				t.Fatalf("DeleteAppointment() = %v", apierr)
+			}
+
+			if appts[0].IsDeleted == (scope == ScopeFollowing) || !appts[1].IsDeleted || !appts[2].IsDeleted {
+				t.Errorf("unexpected cancellations %v, %v, %v", appts[0].IsDeleted, appts[1].IsDeleted, appts[2].IsDeleted)
+			}
+
+			closed := series.IsDeleted
+			if scope == ScopeFollowing {
+				closed = series.Count == 0 && series.Until == appts[1].BeginsAt-1
+			}
+
+			if !closed {
+				t.Errorf("unexpected series %+v, want it closed", series)
+			}
+		})
+	}
+
+	// The cancellation fails along with the series
+	appt := existing(1, member, tomorrow(0), false)
+	appt.SeriesID = 1
+	svc, _ := newTestAppointmentService(appt)
+	if apierr := svc.DeleteAppointment(1, &CancelAppointmentRequest{Scope: ScopeAll}, member); apierr != apierror.InternalServerError {
+		t.Errorf("DeleteAppointment() = %v without a series, want %v", apierr, apierror.InternalServerError)
+	}
+}
+
+func TestCreateSeriesRejectsOverlappingOccurrences(t *testing.T) {
+	svc, repo := newTestAppointmentService()
+	svc.Config.MaxDuration = 48 * time.Hour
+
+	// A daily series of 25 hour appointments
+	req := &AppointmentRequest{
+		BeginsAt:   tomorrow(0).Format(time.RFC3339),
+		ResourceID: 1,
+		Duration:   25 * 60,
+		Recurrence: &RecurrenceRequest{Frequency: FrequencyDaily, Count: 3},
+	}
+
+	if _, apierr := svc.CreateSeries(req, member); apierr != apierror.OverlappingOccurrencesError || len(repo.appts) != 0 {
+		t.Fatalf("CreateSeries() = %v, booked %d, want %v", apierr, len(repo.appts), apierror.OverlappingOccurrencesError)
+	}
+
+	req.Duration = 24 * 60
+	if series, apierr := svc.CreateSeries(req, member); apierr != nil || len(series.Appointments) != 3 {
+		t.Errorf("CreateSeries() = %+v, %v, want back-to-back occurrences booked", series, apierr)
+	}
+}
+
+func TestCreateSeriesAcrossDaylightSavingTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	// Weekly at 10:00, until the first occurrence after the next change of offset
+	start := time.Now().In(loc).AddDate(0, 0, 1)
+	start = time.Date(start.Year(), start.Month(), start.Day(), 10, 0, 0, 0, loc)
+	_, offset := start.Zone()
+	count := 1
+	for ; ; count++ {
+		if _, o := start.AddDate(0, 0, 7*count).Zone(); o != offset {
+			break
+		}
+	}
+
+	svc, repo := newTestAppointmentService()
+	svc.Config.Location = loc
+	req := &AppointmentRequest{
+		BeginsAt:   start.Format(time.RFC3339),
+		ResourceID: 1,
+		Recurrence: &RecurrenceRequest{Frequency: FrequencyWeekly, Count: count + 1},
+	}
+
+	if _, apierr := svc.CreateSeries(req, member); apierr != nil || len(repo.appts) != count+1 {
+		t.Fatalf("CreateSeries() = %v, booked %d, want %d occurrences", apierr, len(repo.appts), count+1)
+	}
+
+	for _, appt := range repo.appts {
+		if begin := time.UnixMilli(appt.BeginsAt).In(loc); begin.Hour() != 10 || begin.Minute() != 0 {
+			t.Errorf("occurrence begins at %v, want 10:00 local time", begin)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/gommon/log"
+	"time"
+)
+
+type AvailabilityRepository interface {
+	FindOpeningHours() ([]*entity.OpeningHours, error)
+	ReplaceOpeningHours(hours []*entity.OpeningHours) error
+	FindOverrides(fromDate, toDate string) ([]*entity.DateOverride, error)
+	FindOverrideByID(id int) (*entity.DateOverride, error)
+	SaveOverride(override *entity.DateOverride) error
+	DeleteOverride(override *entity.DateOverride) error
+}
+
+type OpeningHoursRequest struct {
+	// Weekday goes from 0 (Sunday) to 6 (Saturday).
+	Weekday  int    `json:"weekday" validate:"min=0,max=6"`
+	OpensAt  string `json:"opens_at" validate:"required,clock"`
+	ClosesAt string `json:"closes_at" validate:"required,clock"`
+}
+
+// WeeklyHoursRequest replaces all the weekly opening hours at once. A weekday may have
+// several windows (e.g., a lunch break), and weekdays without any window are closed.
+// An empty list removes every restriction.
+type WeeklyHoursRequest struct {
+	Hours []*OpeningHoursRequest `json:"hours" validate:"max=100,dive,required"`
+}
+
+// DateOverrideRequest replaces the weekly opening hours of a single date. Either both
+// opening times are given, or the date is closed (e.g., holidays).
+type DateOverrideRequest struct {
+	Date     string `json:"date" validate:"required,datetime=2006-01-02"`
+	OpensAt  string `json:"opens_at" validate:"omitempty,clock"`
+	ClosesAt string `json:"closes_at" validate:"omitempty,clock"`
+	IsClosed bool   `json:"is_closed"`
+	Reason   string `json:"reason" validate:"max=128"`
+}
+
+type OpeningHoursResponse struct {
+	Weekday  int    `json:"weekday"`
+	OpensAt  string `json:"opens_at"`
+	ClosesAt string `json:"closes_at"`
+}
+
+type WeeklyHoursResponse struct {
+	Timezone string                  `json:"timezone"`
+	Hours    []*OpeningHoursResponse `json:"hours"`
+}
+
+type DateOverrideResponse struct {
+	ID        int    `json:"id"`
+	Date      string `json:"date"`
+	OpensAt   string `json:"opens_at"`
+	ClosesAt  string `json:"closes_at"`
+	IsClosed  bool   `json:"is_closed"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type DefaultAvailabilityService struct {
+	AvailabilityRepo AvailabilityRepository
+	Validate         *validator.Validate
+	Config           *AppointmentConfig
+}
+
+func NewAvailabilityService(availabilityRepo AvailabilityRepository, validate *validator.Validate, cfg *AppointmentConfig) *DefaultAvailabilityService {
+	return &DefaultAvailabilityService{AvailabilityRepo: availabilityRepo, Validate: validate, Config: cfg}
+}
+
+func (a *DefaultAvailabilityService) GetOpeningHours() (*WeeklyHoursResponse, apierror.ErrorResponse) {
+	hours, err := a.AvailabilityRepo.FindOpeningHours()
+	if err != nil {
+		log.Errorf("failed to fetch opening hours: %v", err)
+		return nil, apierror.InternalServerError
+	}
+	return a.toWeeklyHoursResponse(hours), nil
+}
+
+func (a *DefaultAvailabilityService) SetOpeningHours(req *WeeklyHoursRequest, caller *entity.User) (*WeeklyHoursResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.AvailabilityManage); apierr != nil {
+		return nil, apierr
+	}
+
+	for _, h := range req.Hours {
+		if h != nil {
+			utils.Sanitize(h)
+		}
+	}
+
+	if err := a.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	now := utils.NowUTC()
+	hours := make([]*entity.OpeningHours, len(req.Hours))
+	for i, h := range req.Hours {
+		opensAt, closesAt, apierr := parseWindow(h.OpensAt, h.ClosesAt)
+		if apierr != nil {
+			return nil, apierr
+		}
+
+		hours[i] = &entity.OpeningHours{
+			Weekday:   h.Weekday,
+			OpensAt:   opensAt,
+			ClosesAt:  closesAt,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	err := a.AvailabilityRepo.ReplaceOpeningHours(hours)
+	if err != nil {
+		log.Errorf("failed to replace opening hours: %v", err)
+		return nil, apierror.InternalServerError
+	}
+	return a.GetOpeningHours()
+}
+
+// GetOverrides lists the date overrides between two dates (YYYY-MM-DD), both inclusive.
+// Empty dates list everything from today on.
+func (a *DefaultAvailabilityService) GetOverrides(fromDate, toDate string) ([]*DateOverrideResponse, apierror.ErrorResponse) {
+	if fromDate == "" {
+		fromDate = time.Now().In(a.Config.Location).Format(dateLayout)
+	}
+
+	if toDate == "" {
+		toDate = "9999-12-31"
+	}
+
+	overrides, err := a.AvailabilityRepo.FindOverrides(fromDate, toDate)
+	if err != nil {
+		log.Errorf("failed to fetch date overrides [%s - %s]: %v", fromDate, toDate, err)
+		return nil, apierror.InternalServerError
+	}
+
+	resp := make([]*DateOverrideResponse, len(overrides))
+	for i, override := range overrides {
+		resp[i] = toDateOverrideResponse(override)
+	}
+	return resp, nil
+}
+
+func (a *DefaultAvailabilityService) CreateOverride(req *DateOverrideRequest, caller *entity.User) (*DateOverrideResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.AvailabilityManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := a.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	now := utils.NowUTC()
+	override := &entity.DateOverride{
+		Date:      req.Date,
+		IsClosed:  req.IsClosed,
+		Reason:    req.Reason,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if !req.IsClosed {
+		if req.OpensAt == "" || req.ClosesAt == "" {
+			return nil, apierror.OverrideHoursMissingError
+		}
+
+		opensAt, closesAt, apierr := parseWindow(req.OpensAt, req.ClosesAt)
+		if apierr != nil {
+			return nil, apierr
+		}
+		override.OpensAt = opensAt
+		override.ClosesAt = closesAt
+	}
+
+	err := a.AvailabilityRepo.SaveOverride(override)
+	if err != nil {
+		log.Errorf("failed to save date override: %v", err)
+		return nil, apierror.InternalServerError
+	}
+	return toDateOverrideResponse(override), nil
+}
+
+func (a *DefaultAvailabilityService) DeleteOverride(id int, caller *entity.User) apierror.ErrorResponse {
+	if apierr := authorize(caller, authz.AvailabilityManage); apierr != nil {
+		return apierr
+	}
+
+	override, err := a.AvailabilityRepo.FindOverrideByID(id)
+	if err != nil {
+		log.Errorf("failed to fetch date override by id %d: %v", id, err)
+		return apierror.InternalServerError
+	}
+
+	if override == nil {
+		return apierror.NotFoundError
+	}
+
+	err = a.AvailabilityRepo.DeleteOverride(override)
+	if err != nil {
+		log.Errorf("failed to delete date override by id %d: %v", id, err)
+		return apierror.InternalServerError
+	}
+	return nil
+}
+
+func (a *DefaultAvailabilityService) toWeeklyHoursResponse(hours []*entity.OpeningHours) *WeeklyHoursResponse {
+	resp := &WeeklyHoursResponse{
+		Timezone: a.Config.Location.String(),
+		Hours:    make([]*OpeningHoursResponse, len(hours)),
+	}
+
+	for i, h := range hours {
+		resp.Hours[i] = &OpeningHoursResponse{
+			Weekday:  h.Weekday,
+			OpensAt:  utils.FormatClock(h.OpensAt),
+			ClosesAt: utils.FormatClock(h.ClosesAt),
+		}
+	}
+	return resp
+}
+
+// parseWindow converts the opening and closing times of a window to minutes since midnight.
+func parseWindow(opens, closes string) (int, int, apierror.ErrorResponse) {
+	opensAt, err := utils.ParseClock(opens)
+	if err != nil {
+		return 0, 0, apierror.MalformedBodyError
+	}
+
+	closesAt, err := utils.ParseClock(closes)
+	if err != nil {
+		return 0, 0, apierror.MalformedBodyError
+	}
+
+	if closesAt <= opensAt {
+		return 0, 0, apierror.InvalidOpeningWindowError
+	}
+	return opensAt, closesAt, nil
+}
+
+func toDateOverrideResponse(override *entity.DateOverride) *DateOverrideResponse {
+	resp := &DateOverrideResponse{
+		ID:        override.ID,
+		Date:      override.Date,
+		IsClosed:  override.IsClosed,
+		Reason:    override.Reason,
+		CreatedAt: utils.FormatEpoch(override.CreatedAt),
+		UpdatedAt: utils.FormatEpoch(override.UpdatedAt),
+	}
+
+	if !override.IsClosed {
+		resp.OpensAt = utils.FormatClock(override.OpensAt)
+		resp.ClosesAt = utils.FormatClock(override.ClosesAt)
+	}
+	return resp
+}
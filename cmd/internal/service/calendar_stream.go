@@ -0,0 +1,180 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"sync"
+	"time"
+)
+
+// Kinds of calendar events, see CalendarBroker.
+const (
+	// SlotTaken is a period of a resource that was just booked, e.g. by a new or moved appointment.
+	SlotTaken = "slot-taken"
+
+	// SlotFreed is a period of a resource that can be booked again, e.g. after a cancellation.
+	SlotFreed = "slot-freed"
+
+	// CalendarResync tells a resuming client that some events cannot be replayed anymore,
+	// so it has to load the calendar again.
+	CalendarResync = "resync"
+)
+
+const (
+	// calendarHistorySize is how many events are kept for clients resuming with Last-Event-ID.
+	calendarHistorySize = 1024
+
+	// calendarSubscriberBuffer is how many events a client may fall behind before it is dropped.
+	calendarSubscriberBuffer = 64
+)
+
+// CalendarEvent is a change of the calendar, sent to the clients following it.
+type CalendarEvent struct {
+	ID         int64  `json:"-"`
+	Type       string `json:"-"`
+	ResourceID int    `json:"resource_id,omitempty"`
+	*ScheduledDay
+
+	begin, end int64
+}
+
+// CalendarFilter picks the events a client follows: the ones of a resource (or of every resource
+// when zero) overlapping [From, To).
+type CalendarFilter struct {
+	ResourceID int
+	From, To   int64
+}
+
+func (f *CalendarFilter) matches(event *CalendarEvent) bool {
+	if f.ResourceID != 0 && event.ResourceID != f.ResourceID {
+		return false
+	}
+	return event.begin < f.To && event.end > f.From
+}
+
+// CalendarSubscription receives the events of a client, until it unsubscribes.
+type CalendarSubscription struct {
+	// Events is closed when the client falls too far behind. It may then subscribe
+	// again with the ID of the last event it got, see CalendarBroker.Subscribe.
+	Events <-chan *CalendarEvent
+
+	events chan *CalendarEvent
+	filter CalendarFilter
+}
+
+// CalendarStreamConfig tells how calendar streams are kept alive.
+type CalendarStreamConfig struct {
+	// Heartbeat is how often an idle stream gets a comment, so that proxies keep it open.
+	Heartbeat time.Duration
+}
+
+// CalendarStreamConfigFromEnv reads CALENDAR_STREAM_HEARTBEAT, 15s by default.
+func CalendarStreamConfigFromEnv() *CalendarStreamConfig {
+	return &CalendarStreamConfig{
+		Heartbeat: durationFromEnv("CALENDAR_STREAM_HEARTBEAT", 15*time.Second),
+	}
+}
+
+// CalendarBroker fans calendar events out to every subscribed client of this process, and keeps
+// the latest ones so that clients can resume after a disconnection.
+//
+// Event IDs follow each other, starting from the time the broker was created (in milliseconds),
+// so that the IDs of a previous run are not mistaken for ours and lead to a resync.
+type CalendarBroker struct {
+	mu          sync.Mutex
+	lastID      int64
+	history     []*CalendarEvent
+	subscribers map[*CalendarSubscription]struct{}
+}
+
+func NewCalendarBroker() *CalendarBroker {
+	return &CalendarBroker{
+		lastID:      time.Now().UnixMilli(),
+		subscribers: make(map[*CalendarSubscription]struct{}),
+	}
+}
+
+// Publish numbers the events and sends them to the subscribers following them.
+// Subscribers that fell too far behind are dropped rather than waited for.
+func (b *CalendarBroker) Publish(events ...*CalendarEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range events {
+		b.lastID++
+		event.ID = b.lastID
+		b.history = append(b.history, event)
+
+		for sub := range b.subscribers {
+			if !sub.filter.matches(event) {
+				continue
+			}
+
+			select {
+			case sub.events <- event:
+			default:
+				b.drop(sub)
+			}
+		}
+	}
+
+	if extra := len(b.history) - calendarHistorySize; extra > 0 {
+		b.history = append(b.history[:0:0], b.history[extra:]...)
+	}
+}
+
+// Subscribe follows the events matching the filter. Clients resuming with the ID of the last event
+// they got (e.g. from Last-Event-ID) also get the ones they missed, or a CalendarResync event when
+// some of them are not kept anymore. Zero means a new client, with nothing to resume.
+func (b *CalendarBroker) Subscribe(filter CalendarFilter, lastEventID int64) (*CalendarSubscription, []*CalendarEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan *CalendarEvent, calendarSubscriberBuffer)
+	sub := &CalendarSubscription{Events: events, events: events, filter: filter}
+	b.subscribers[sub] = struct{}{}
+
+	var missed []*CalendarEvent
+	first := b.lastID - int64(len(b.history)) + 1
+	switch {
+	case lastEventID == 0:
+	case lastEventID < first-1 || lastEventID > b.lastID:
+		missed = append(missed, &CalendarEvent{ID: b.lastID, Type: CalendarResync})
+	default:
+		for _, event := range b.history[lastEventID-first+1:] {
+			if filter.matches(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	return sub, missed
+}
+
+// Unsubscribe stops sending events to the subscription, e.g. once its client is gone.
+func (b *CalendarBroker) Unsubscribe(sub *CalendarSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(sub)
+}
+
+// drop removes the subscription, closing its channel. The caller must hold the lock.
+func (b *CalendarBroker) drop(sub *CalendarSubscription) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// slotEvents builds the events of the periods taken or freed by the appointments.
+func slotEvents(kind string, appts ...*entity.Appointment) []*CalendarEvent {
+	events := make([]*CalendarEvent, len(appts))
+	for i, appt := range appts {
+		events[i] = &CalendarEvent{
+			Type:         kind,
+			ResourceID:   appt.ResourceID,
+			ScheduledDay: toScheduledDay(appt),
+			begin:        appt.BeginsAt,
+			end:          appt.EndsAt,
+		}
+	}
+	return events
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"4shure/cmd/internal/utils"
+	"slices"
+	"testing"
+	"time"
+)
+
+// receive returns the types of the events waiting for the subscription.
+func receive(sub *CalendarSubscription) []string {
+	var types []string
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			if !ok {
+				return append(types, "closed")
+			}
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestCalendarBroker(t *testing.T) {
+	broker := NewCalendarBroker()
+	january := CalendarFilter{From: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), To: time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC).UnixMilli()}
+	all, _ := broker.Subscribe(january, 0)
+	room, _ := broker.Subscribe(CalendarFilter{ResourceID: 1, From: january.From, To: january.To}, 0)
+
+	inJanuary := existing(1, member, time.Date(2030, 1, 31, 23, 0, 0, 0, time.UTC), false)
+	inFebruary := existing(2, member, time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC), false)
+	otherRoom := existing(3, member, time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC), false)
+	otherRoom.ResourceID = 2
+
+	broker.Publish(slotEvents(SlotTaken, inJanuary, inFebruary, otherRoom)...)
+	broker.Publish(slotEvents(SlotFreed, inJanuary)...)
+
+	if got := receive(all); !slices.Equal(got, []string{SlotTaken, SlotTaken, SlotFreed}) {
+		t.Errorf("received %v for every resource, want the January events", got)
+	}
+
+	if got := receive(room); !slices.Equal(got, []string{SlotTaken, SlotFreed}) {
+		t.Errorf("received %v for resource 1, want its January events", got)
+	}
+
+	broker.Unsubscribe(room)
+	if got := receive(room); !slices.Equal(got, []string{"closed"}) {
+		t.Errorf("received %v after unsubscribing, want the subscription closed", got)
+	}
+}
+
+func TestCalendarBrokerResume(t *testing.T) {
+	broker := NewCalendarBroker()
+	filter := CalendarFilter{From: 0, To: time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()}
+	appt := existing(1, member, time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC), false)
+
+	broker.Publish(slotEvents(SlotTaken, appt)...)
+	first := broker.lastID
+	broker.Publish(slotEvents(SlotFreed, appt)...)
+
+	tests := []struct {
+		name        string
+		lastEventID int64
+		want        []string
+	}{
+		{name: "new client"},
+		{name: "up to date", lastEventID: first + 1},
+		{name: "missed one", lastEventID: first, want: []string{SlotFreed}},
+		{name: "missed both", lastEventID: first - 1, want: []string{SlotTaken, SlotFreed}},
+		{name: "too old", lastEventID: first - 2, want: []string{CalendarResync}},
+		{name: "previous run", lastEventID: first + 2, want: []string{CalendarResync}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed := broker.Subscribe(filter, tt.lastEventID)
+			defer broker.Unsubscribe(sub)
+
+			var got []string
+			for _, event := range missed {
+				got = append(got, event.Type)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("missed %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Only the latest events are kept
+	for range calendarHistorySize {
+		broker.Publish(slotEvents(SlotTaken, appt)...)
+	}
+
+	if _, missed := broker.Subscribe(filter, first); len(missed) != 1 || missed[0].Type != CalendarResync || missed[0].ID != broker.lastID {
+		t.Errorf("missed %v, want a resync from the last event", missed)
+	}
+}
+
+func TestCalendarBrokerDropsSlowSubscribers(t *testing.T) {
+	broker := NewCalendarBroker()
+	sub, _ := broker.Subscribe(CalendarFilter{From: 0, To: time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()}, 0)
+	appt := existing(1, member, time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC), false)
+
+	for range calendarSubscriberBuffer + 1 {
+		broker.Publish(slotEvents(SlotTaken, appt)...)
+	}
+
+	if got := receive(sub); len(got) != calendarSubscriberBuffer+1 || got[len(got)-1] != "closed" {
+		t.Fatalf("received %d events, want the buffered ones then the subscription closed", len(got))
+	}
+
+	// Resuming gets the dropped event back
+	if _, missed := broker.Subscribe(sub.filter, broker.lastID-1); len(missed) != 1 || missed[0].ID != broker.lastID {
+		t.Errorf("missed %v, want the dropped event", missed)
+	}
+}
+
+func TestAppointmentChangesStreamCalendar(t *testing.T) {
+	svc, _ := newTestAppointmentService()
+	broker := svc.Calendar.(*CalendarBroker)
+	sub, _ := broker.Subscribe(CalendarFilter{ResourceID: 1, From: utils.NowUTC(), To: tomorrow(48).UnixMilli()}, 0)
+
+	created, apierr := svc.CreateAppointment(&AppointmentRequest{BeginsAt: tomorrow(0).Format(time.RFC3339), ResourceID: 1}, member)
+	if apierr != nil {
+		t.Fatalf("CreateAppointment() = %v", apierr)
+	}
+
+	_, apierr = svc.UpdateAppointment(created.ID, &UpdateAppointmentRequest{Title: "Renamed"}, "", member)
+	if got := receive(sub); apierr != nil || !slices.Equal(got, []string{SlotTaken}) {
+		t.Fatalf("received %v (%v), want the booked slot only, not the new title", got, apierr)
+	}
+
+	_, apierr = svc.UpdateAppointment(created.ID, &UpdateAppointmentRequest{BeginsAt: tomorrow(3).Format(time.RFC3339)}, "", member)
+	if got := receive(sub); apierr != nil || !slices.Equal(got, []string{SlotFreed, SlotTaken}) {
+		t.Fatalf("received %v (%v), want the previous slot freed and the new one taken", got, apierr)
+	}
+
+	apierr = svc.DeleteAppointment(created.ID, &CancelAppointmentRequest{}, member)
+	if got := receive(sub); apierr != nil || !slices.Equal(got, []string{SlotFreed}) {
+		t.Fatalf("received %v (%v), want the slot freed", got, apierr)
+	}
+
+	// Rejected changes are not streamed
+	svc.CreateAppointment(&AppointmentRequest{BeginsAt: tomorrow(0).Format(time.RFC3339), ResourceID: 2}, member)
+	if got := receive(sub); len(got) != 0 {
+		t.Errorf("received %v for a rejected booking", got)
+	}
+}
@@ -0,0 +1,558 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/integration/webhook"
+	"4shure/cmd/internal/notification"
+	"4shure/cmd/internal/utils/validators"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var errFake = errors.New("fake failure")
+
+var (
+	_ UserRepository         = (*fakeUserRepo)(nil)
+	_ AppointmentRepository  = (*fakeAppointmentRepo)(nil)
+	_ ResourceRepository     = (*fakeResourceRepo)(nil)
+	_ AvailabilityRepository = (*fakeAvailabilityRepo)(nil)
+	_ ReminderRepository     = (*fakeReminderRepo)(nil)
+	_ Notifier               = (*fakeNotifier)(nil)
+	_ EventPublisher         = (*fakePublisher)(nil)
+	_ WebhookRepository      = (*fakeWebhookRepo)(nil)
+	_ WebhookSender          = (*fakeSender)(nil)
+	_ OutboxRepository       = (*fakeOutboxRepo)(nil)
+	_ Transactor             = (*fakeTransactor)(nil)
+)
+
+func newTestValidator() *validator.Validate {
+	validate := validator.New()
+	_ = validate.RegisterValidation("hasupper", validators.HasUpper)
+	_ = validate.RegisterValidation("haslower", validators.HasLower)
+	_ = validate.RegisterValidation("hasdigit", validators.HasDigit)
+	_ = validate.RegisterValidation("hasspecial", validators.HasSpecial)
+	_ = validate.RegisterValidation("nodupes", validators.NoDupes)
+	_ = validate.RegisterValidation("iso8601", validators.IsIso8601)
+	_ = validate.RegisterValidation("clock", validators.IsClock)
+	return validate
+}
+
+// fakeUserRepo keeps users in memory. Saving an existing user stores a copy of it, so that
+// tests can tell what was saved from what was only changed in memory. Setting saveErr makes
+// Save fail.
+type fakeUserRepo struct {
+	users   []*entity.User
+	saveErr error
+}
+
+func (f *fakeUserRepo) FindByID(id int) (*entity.User, error) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserRepo) FindBySub(sub string) (*entity.User, error) {
+	for _, user := range f.users {
+		if user.SubUUID == sub {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserRepo) FindAll() ([]*entity.User, error) {
+	var users []*entity.User
+	for _, user := range f.users {
+		if !user.IsDeleted {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeUserRepo) FindByEmail(email string) (*entity.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUserRepo) ExistsByEmail(email string) (bool, error) {
+	user, _ := f.FindByEmail(email)
+	return user != nil, nil
+}
+
+func (f *fakeUserRepo) Save(user *entity.User) error {
+	if f.saveErr != nil {
+		return f.saveErr
+	}
+
+	if user.ID == 0 {
+		user.ID = len(f.users) + 1
+		f.users = append(f.users, user)
+		return nil
+	}
+
+	for i, existing := range f.users {
+		if existing.ID == user.ID {
+			saved := *user
+			f.users[i] = &saved
+		}
+	}
+	return nil
+}
+
+func (f *fakeUserRepo) GrantPermission(permission *entity.UserPermission) error {
+	return nil
+}
+
+func (f *fakeUserRepo) RevokePermission(userID int, permission string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeUserRepo) Anonymise(user *entity.User) error {
+	user.Permissions = nil
+	return f.Save(user)
+}
+
+// fakeAppointmentRepo keeps appointments in memory, with the same overlap rules as the real one.
+type fakeAppointmentRepo struct {
+	appts  []*entity.Appointment
+	series []*entity.AppointmentSeries
+}
+
+func (f *fakeAppointmentRepo) Save(appt *entity.Appointment) error {
+	if appt.ID == 0 {
+		appt.ID = len(f.appts) + 1
+		f.appts = append(f.appts, appt)
+	}
+	return nil
+}
+
+func (f *fakeAppointmentRepo) FindAll(includeDeleted bool) ([]*entity.Appointment, error) {
+	return f.filter(func(appt *entity.Appointment) bool {
+		return includeDeleted || !appt.IsDeleted
+	}), nil
+}
+
+func (f *fakeAppointmentRepo) IsAvailable(resourceID int, begin, end int64) (bool, error) {
+	return f.isAvailable(resourceID, begin, end, nil), nil
+}
+
+func (f *fakeAppointmentRepo) Book(appts []*entity.Appointment, excludeIDs ...int) ([]*entity.Appointment, error) {
+	var conflicts []*entity.Appointment
+	for _, appt := range appts {
+		if !f.isAvailable(appt.ResourceID, appt.BeginsAt, appt.EndsAt, append(excludeIDs, appt.ID)) {
+			conflicts = append(conflicts, appt)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+
+	for _, appt := range appts {
+		_ = f.Save(appt)
+	}
+	return nil, nil
+}
+
+func (f *fakeAppointmentRepo) BookSeries(series *entity.AppointmentSeries, appts []*entity.Appointment) ([]*entity.Appointment, error) {
+	series.ID = len(f.series) + 1
+	for _, appt := range appts {
+		appt.SeriesID = series.ID
+	}
+
+	conflicts, err := f.Book(appts)
+	if err == nil && len(conflicts) == 0 {
+		f.series = append(f.series, series)
+	}
+	return conflicts, err
+}
+
+func (f *fakeAppointmentRepo) FindByUserID(id int, includeDeleted bool) ([]*entity.Appointment, error) {
+	return f.filter(func(appt *entity.Appointment) bool {
+		return appt.UserID == id && (includeDeleted || !appt.IsDeleted)
+	}), nil
+}
+
+func (f *fakeAppointmentRepo) FindByID(id int) (*entity.Appointment, error) {
+	for _, appt := range f.appts {
+		if appt.ID == id {
+			return appt, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeAppointmentRepo) FindMonthAppointments(resourceID int, monthStart, monthEnd int64) ([]*entity.Appointment, error) {
+	return f.filter(func(appt *entity.Appointment) bool {
+		return appt.ResourceID == resourceID && !appt.IsDeleted && appt.BeginsAt < monthEnd && appt.EndsAt >= monthStart
+	}), nil
+}
+
+func (f *fakeAppointmentRepo) FindBySeriesID(seriesID int) ([]*entity.Appointment, error) {
+	return f.filter(func(appt *entity.Appointment) bool {
+		return appt.SeriesID == seriesID && !appt.IsDeleted
+	}), nil
+}
+
+func (f *fakeAppointmentRepo) FindSeriesByID(id int) (*entity.AppointmentSeries, error) {
+	for _, series := range f.series {
+		if series.ID == id {
+			return series, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeAppointmentRepo) SaveSeries(series *entity.AppointmentSeries) error {
+	return nil
+}
+
+func (f *fakeAppointmentRepo) Cancel(appts []*entity.Appointment) error {
+	return nil // Appointments are cancelled in place
+}
+
+func (f *fakeAppointmentRepo) isAvailable(resourceID int, begin, end int64, excludeIDs []int) bool {
+	for _, appt := range f.appts {
+		if appt.ResourceID != resourceID || appt.IsDeleted || slices.Contains(excludeIDs, appt.ID) {
+			continue
+		}
+
+		if appt.BeginsAt <= end && appt.EndsAt >= begin {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeAppointmentRepo) filter(keep func(*entity.Appointment) bool) []*entity.Appointment {
+	var found []*entity.Appointment
+	for _, appt := range f.appts {
+		if keep(appt) {
+			found = append(found, appt)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].BeginsAt < found[j].BeginsAt })
+	return found
+}
+
+type fakeResourceRepo struct {
+	resources []*entity.Resource
+}
+
+func (f *fakeResourceRepo) FindByID(id int) (*entity.Resource, error) {
+	for _, resource := range f.resources {
+		if resource.ID == id {
+			return resource, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeResourceRepo) FindAll() ([]*entity.Resource, error) {
+	return f.resources, nil
+}
+
+func (f *fakeResourceRepo) Save(resource *entity.Resource) error {
+	if resource.ID == 0 {
+		resource.ID = len(f.resources) + 1
+		f.resources = append(f.resources, resource)
+	}
+	return nil
+}
+
+// fakeAvailabilityRepo has no opening hours by default, i.e., it is always open.
+type fakeAvailabilityRepo struct {
+	hours     []*entity.OpeningHours
+	overrides []*entity.DateOverride
+}
+
+func (f *fakeAvailabilityRepo) FindOpeningHours() ([]*entity.OpeningHours, error) {
+	return f.hours, nil
+}
+
+func (f *fakeAvailabilityRepo) ReplaceOpeningHours(hours []*entity.OpeningHours) error {
+	f.hours = hours
+	return nil
+}
+
+func (f *fakeAvailabilityRepo) FindOverrides(fromDate, toDate string) ([]*entity.DateOverride, error) {
+	var found []*entity.DateOverride
+	for _, override := range f.overrides {
+		if override.Date >= fromDate && override.Date <= toDate {
+			found = append(found, override)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeAvailabilityRepo) FindOverrideByID(id int) (*entity.DateOverride, error) {
+	for _, override := range f.overrides {
+		if override.ID == id {
+			return override, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeAvailabilityRepo) SaveOverride(override *entity.DateOverride) error {
+	if override.ID == 0 {
+		override.ID = len(f.overrides) + 1
+		f.overrides = append(f.overrides, override)
+	}
+	return nil
+}
+
+func (f *fakeAvailabilityRepo) DeleteOverride(override *entity.DateOverride) error {
+	f.overrides = slices.DeleteFunc(f.overrides, func(o *entity.DateOverride) bool { return o.ID == override.ID })
+	return nil
+}
+
+// fakeNotifier records the events it is given. Setting err makes Notify fail.
+type fakeNotifier struct {
+	events []*notification.Event
+	err    error
+}
+
+func (f *fakeNotifier) Notify(event *notification.Event) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+// fakeReminderRepo applies the same rules as the SQLite repository to the appointments of appts.
+type fakeReminderRepo struct {
+	appts    []*entity.Appointment
+	reminded map[int][]time.Duration
+}
+
+func (f *fakeReminderRepo) FindDue(lead time.Duration, now int64) ([]*entity.Appointment, error) {
+	var due []*entity.Appointment
+	for _, appt := range f.appts {
+		inWindow := appt.BeginsAt > now && appt.BeginsAt <= now+lead.Milliseconds()
+		bookedBefore := appt.CreatedAt <= appt.BeginsAt-lead.Milliseconds()
+		if !appt.IsDeleted && inWindow && bookedBefore && !slices.Contains(f.reminded[appt.ID], lead) {
+			due = append(due, appt)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeReminderRepo) MarkReminded(appt *entity.Appointment, lead time.Duration) error {
+	if f.reminded == nil {
+		f.reminded = make(map[int][]time.Duration)
+	}
+	f.reminded[appt.ID] = append(f.reminded[appt.ID], lead)
+	return nil
+}
+
+type publishedEvent struct {
+	ID   string
+	Type string
+	Data any
+}
+
+// fakePublisher records the events published. Setting err makes Publish fail.
+type fakePublisher struct {
+	events []publishedEvent
+	err    error
+}
+
+func (f *fakePublisher) Publish(eventID, eventType string, data any) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.events = append(f.events, publishedEvent{ID: eventID, Type: eventType, Data: data})
+	return nil
+}
+
+// types returns the type of every event published, in order.
+func (f *fakePublisher) types() []string {
+	types := make([]string, len(f.events))
+	for i, event := range f.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+// fakeWebhookRepo keeps webhooks and their deliveries in memory.
+type fakeWebhookRepo struct {
+	webhooks   []*entity.Webhook
+	deliveries []*entity.WebhookDelivery
+}
+
+func (f *fakeWebhookRepo) FindByID(id int) (*entity.Webhook, error) {
+	for _, webhook := range f.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeWebhookRepo) FindAll() ([]*entity.Webhook, error) {
+	var webhooks []*entity.Webhook
+	for _, webhook := range f.webhooks {
+		if !webhook.IsDeleted {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (f *fakeWebhookRepo) FindActive() ([]*entity.Webhook, error) {
+	var webhooks []*entity.Webhook
+	for _, webhook := range f.webhooks {
+		if webhook.IsActive && !webhook.IsDeleted {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (f *fakeWebhookRepo) Save(webhook *entity.Webhook) error {
+	if webhook.ID == 0 {
+		webhook.ID = len(f.webhooks) + 1
+		f.webhooks = append(f.webhooks, webhook)
+	}
+	return nil
+}
+
+func (f *fakeWebhookRepo) FindDelivery(id int) (*entity.WebhookDelivery, error) {
+	for _, delivery := range f.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeWebhookRepo) FindDeliveries(webhookID, limit int) ([]*entity.WebhookDelivery, error) {
+	var deliveries []*entity.WebhookDelivery
+	for i := len(f.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if f.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, f.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (f *fakeWebhookRepo) FindDueDeliveries(now int64, limit int) ([]*entity.WebhookDelivery, error) {
+	var deliveries []*entity.WebhookDelivery
+	for _, delivery := range f.deliveries {
+		if delivery.Status == entity.DeliveryPending && delivery.NextAttemptAt <= now && len(deliveries) < limit {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (f *fakeWebhookRepo) CreateDeliveries(deliveries []*entity.WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		if slices.ContainsFunc(f.deliveries, func(d *entity.WebhookDelivery) bool {
+			return d.WebhookID == delivery.WebhookID && d.EventID == delivery.EventID && d.ReplayOf == 0 && delivery.ReplayOf == 0
+		}) {
+			continue
+		}
+		delivery.ID = len(f.deliveries) + 1
+		f.deliveries = append(f.deliveries, delivery)
+	}
+	return nil
+}
+
+func (f *fakeWebhookRepo) SaveDelivery(*entity.WebhookDelivery) error {
+	return nil
+}
+
+// fakeSender records the requests it is given, answering with status (and err, if set).
+type fakeSender struct {
+	requests []*webhook.Request
+	status   int
+	err      error
+}
+
+func (f *fakeSender) Send(req *webhook.Request) (int, error) {
+	f.requests = append(f.requests, req)
+	return f.status, f.err
+}
+
+// fakeOutboxRepo keeps outbox messages in memory.
+type fakeOutboxRepo struct {
+	msgs   []*entity.OutboxMessage
+	nextID int
+}
+
+func (f *fakeOutboxRepo) Enqueue(msgs ...*entity.OutboxMessage) error {
+	for _, msg := range msgs {
+		f.nextID++
+		msg.ID = f.nextID
+		f.msgs = append(f.msgs, msg)
+	}
+	return nil
+}
+
+func (f *fakeOutboxRepo) FindDue(now int64, limit int) ([]*entity.OutboxMessage, error) {
+	var due []*entity.OutboxMessage
+	for _, msg := range f.msgs {
+		if msg.Status == entity.OutboxPending && msg.NextAttemptAt <= now && len(due) < limit {
+			due = append(due, msg)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeOutboxRepo) FindByKind(kind string) ([]*entity.OutboxMessage, error) {
+	var found []*entity.OutboxMessage
+	for _, msg := range f.msgs {
+		if msg.Kind == kind {
+			found = append(found, msg)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeOutboxRepo) Save(msg *entity.OutboxMessage) error {
+	return nil
+}
+
+func (f *fakeOutboxRepo) Delete(id int) error {
+	f.msgs = slices.DeleteFunc(f.msgs, func(msg *entity.OutboxMessage) bool { return msg.ID == id })
+	return nil
+}
+
+// kinds returns the kind of every message left, in order.
+func (f *fakeOutboxRepo) kinds() []string {
+	kinds := make([]string, len(f.msgs))
+	for i, msg := range f.msgs {
+		kinds[i] = msg.Kind
+	}
+	return kinds
+}
+
+// fakeTransactor hands fn the fake repositories. Nothing is rolled back, but setting
+// err makes every transaction fail before fn is run.
+type fakeTransactor struct {
+	repos *TxRepositories
+	err   error
+}
+
+func (f *fakeTransactor) Transaction(fn func(tx *TxRepositories) error) error {
+	if f.err != nil {
+		return f.err
+	}
+	return fn(f.repos)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"sort"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// period is a half-open interval of time, [begin, end), in epoch milliseconds.
+type period struct {
+	begin int64
+	end   int64
+}
+
+// openingSchedule tells when appointments can be booked, according to the
+// weekly opening hours and the date overrides.
+//
+// When no weekly opening hours are configured, every day is open all day long
+// (overrides still apply), which is how the server behaved before opening hours existed.
+type openingSchedule struct {
+	location  *time.Location
+	weekly    map[time.Weekday][]*entity.OpeningHours
+	overrides map[string][]*entity.DateOverride
+}
+
+// loadOpeningSchedule loads every rule needed to evaluate the period between from and to.
+func loadOpeningSchedule(repo AvailabilityRepository, loc *time.Location, from, to int64) (*openingSchedule, error) {
+	hours, err := repo.FindOpeningHours()
+	if err != nil {
+		return nil, err
+	}
+
+	fromDate := time.UnixMilli(from).In(loc).Format(dateLayout)
+	toDate := time.UnixMilli(to).In(loc).Format(dateLayout)
+	overrides, err := repo.FindOverrides(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &openingSchedule{
+		location:  loc,
+		weekly:    make(map[time.Weekday][]*entity.OpeningHours),
+		overrides: make(map[string][]*entity.DateOverride),
+	}
+
+	for _, h := range hours {
+		weekday := time.Weekday(h.Weekday)
+		schedule.weekly[weekday] = append(schedule.weekly[weekday], h)
+	}
+
+	for _, o := range overrides {
+		schedule.overrides[o.Date] = append(schedule.overrides[o.Date], o)
+	}
+	return schedule, nil
+}
+
+// isOpen checks if an appointment fits entirely in the opening hours.
+// Just like entity.Appointment, the end is inclusive.
+func (s *openingSchedule) isOpen(begin, end int64) bool {
+	for _, p := range s.openPeriods(begin, end+1) {
+		if p.begin <= begin && end < p.end {
+			return true
+		}
+	}
+	return false
+}
+
+// closedPeriods returns every period between from and to in which nothing can be booked.
+func (s *openingSchedule) closedPeriods(from, to int64) []period {
+	var closed []period
+	cursor := from
+	for _, p := range s.openPeriods(from, to) {
+		if p.end <= cursor {
+			continue
+		}
+
+		if p.begin >= to {
+			break
+		}
+
+		if p.begin > cursor {
+			closed = append(closed, period{begin: cursor, end: p.begin})
+		}
+		cursor = p.end
+	}
+
+	if cursor < to {
+		closed = append(closed, period{begin: cursor, end: to})
+	}
+	return closed
+}
+
+// openPeriods returns the open periods of every day between from and to, in
+// chronological order. Periods that touch each other (e.g., across midnight) are merged.
+func (s *openingSchedule) openPeriods(from, to int64) []period {
+	var merged []period
+	start := time.UnixMilli(from).In(s.location)
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, s.location)
+
+	for day.UnixMilli() < to {
+		for _, p := range s.dayPeriods(day) {
+			last := len(merged) - 1
+			if last >= 0 && p.begin <= merged[last].end {
+				merged[last].end = max(merged[last].end, p.end)
+				continue
+			}
+			merged = append(merged, p)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return merged
+}
+
+// dayPeriods returns the open periods of a single day, sorted by their begin.
+func (s *openingSchedule) dayPeriods(day time.Time) []period {
+	var periods []period
+	if overrides, ok := s.overrides[day.Format(dateLayout)]; ok {
+		for _, o := range overrides {
+			if o.IsClosed {
+				return nil
+			}
+			periods = append(periods, s.window(day, o.OpensAt, o.ClosesAt))
+		}
+	} else if len(s.weekly) == 0 {
+		periods = append(periods, s.window(day, 0, 24*60))
+	} else {
+		for _, h := range s.weekly[day.Weekday()] {
+			periods = append(periods, s.window(day, h.OpensAt, h.ClosesAt))
+		}
+	}
+
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].begin < periods[j].begin
+	})
+	return periods
+}
+
+// window converts opening and closing minutes (since midnight) of a day to a period.
+// Using time.Date keeps the wall clock right on days with daylight saving changes.
+func (s *openingSchedule) window(day time.Time, opensAt, closesAt int) period {
+	y, m, d := day.Date()
+	return period{
+		begin: time.Date(y, m, d, 0, opensAt, 0, 0, s.location).UnixMilli(),
+		end:   time.Date(y, m, d, 0, closesAt, 0, 0, s.location).UnixMilli(),
+	}
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/notification"
+	"4shure/cmd/internal/utils"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Kinds of outbox messages, see the handlers in outbox_handlers.go.
+const (
+	OutboxNotification   = "notification"
+	OutboxWebhookEvent   = "webhook.event"
+	OutboxDeleteIdentity = "identity.delete"
+	OutboxSignupCleanup  = "identity.signup_cleanup"
+	OutboxCalendarEvent  = "calendar.event"
+)
+
+// outboxBatchSize caps the messages handled in a single run of the dispatcher.
+const outboxBatchSize = 50
+
+type OutboxRepository interface {
+	Enqueue(msgs ...*entity.OutboxMessage) error
+	FindDue(now int64, limit int) ([]*entity.OutboxMessage, error)
+	FindByKind(kind string) ([]*entity.OutboxMessage, error)
+	Save(msg *entity.OutboxMessage) error
+	Delete(id int) error
+}
+
+// TxRepositories are the repositories available within a transaction, see Transactor.
+type TxRepositories struct {
+	Users        UserRepository
+	Appointments AppointmentRepository
+	Reminders    ReminderRepository
+	Outbox       OutboxRepository
+}
+
+// Transactor runs fn within a single database transaction: everything fn saves through
+// the given repositories is committed if it returns nil, and rolled back otherwise.
+// Changes with side effects enqueue them in the outbox, within the same transaction.
+type Transactor interface {
+	Transaction(fn func(tx *TxRepositories) error) error
+}
+
+// notificationPayload is the payload of OutboxNotification messages. The appointments
+// are loaded when the message is handled, and must belong to the same user and resource.
+type notificationPayload struct {
+	Kind           notification.Kind `json:"kind"`
+	AppointmentIDs []int             `json:"appointment_ids"`
+	LeadMinutes    int               `json:"lead_minutes,omitempty"`
+}
+
+// webhookPayload is the payload of OutboxWebhookEvent messages.
+type webhookPayload struct {
+	// ID identifies the event, so that it is delivered once however many times it is published
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// identityPayload is the payload of OutboxDeleteIdentity and OutboxSignupCleanup messages.
+type identityPayload struct {
+	Email string `json:"email"`
+}
+
+// calendarPayload is the payload of OutboxCalendarEvent messages. The periods are kept as
+// they were, since the appointments may have changed again when the message is handled.
+type calendarPayload struct {
+	Type  string        `json:"type"`
+	Slots []slotPayload `json:"slots"`
+}
+
+type slotPayload struct {
+	ResourceID int   `json:"resource_id"`
+	BeginsAt   int64 `json:"begins_at"`
+	EndsAt     int64 `json:"ends_at"`
+}
+
+// newOutboxMessage builds a message with the given payload, to be handled from the given time on.
+func newOutboxMessage(kind string, payload any, at int64) (*entity.OutboxMessage, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s message: %w", kind, err)
+	}
+
+	return &entity.OutboxMessage{
+		Kind:          kind,
+		Payload:       string(raw),
+		Status:        entity.OutboxPending,
+		NextAttemptAt: at,
+		CreatedAt:     utils.NowUTC(),
+		UpdatedAt:     utils.NowUTC(),
+	}, nil
+}
+
+// notificationMessage tells the owner of the appointments what happened to them.
+func notificationMessage(kind notification.Kind, appts []*entity.Appointment, lead time.Duration) (*entity.OutboxMessage, error) {
+	ids := make([]int, len(appts))
+	for i, appt := range appts {
+		ids[i] = appt.ID
+	}
+
+	payload := &notificationPayload{Kind: kind, AppointmentIDs: ids, LeadMinutes: int(lead / time.Minute)}
+	return newOutboxMessage(OutboxNotification, payload, utils.NowUTC())
+}
+
+// webhookMessage publishes the event to webhooks, with its data as it is right now.
+func webhookMessage(eventType string, data any) (*entity.OutboxMessage, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	return newOutboxMessage(OutboxWebhookEvent, &webhookPayload{ID: "evt_" + rand.Text(), Type: eventType, Data: raw}, utils.NowUTC())
+}
+
+// calendarMessage publishes the slots of the appointments to the calendar streams of the API,
+// for changes made by another process (e.g. the reconcile command), which nobody follows.
+func calendarMessage(kind string, appts []*entity.Appointment) (*entity.OutboxMessage, error) {
+	slots := make([]slotPayload, len(appts))
+	for i, appt := range appts {
+		slots[i] = slotPayload{ResourceID: appt.ResourceID, BeginsAt: appt.BeginsAt, EndsAt: appt.EndsAt}
+	}
+	return newOutboxMessage(OutboxCalendarEvent, &calendarPayload{Type: kind, Slots: slots}, utils.NowUTC())
+}
+
+// OutboxHandler carries out the side effect described by a message payload. Messages are
+// handled at least once, so handlers must be idempotent. Failed messages are retried.
+type OutboxHandler func(payload []byte) error
+
+// OutboxConfig tells how outbox messages are retried.
+type OutboxConfig struct {
+	// MaxAttempts is how many times a message is handled before it is marked as failed.
+	MaxAttempts int
+
+	// RetryDelay is the wait after the first failed attempt. It doubles after every
+	// other failure, up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// PollInterval is how often the dispatcher looks for messages that are due.
+	PollInterval time.Duration
+}
+
+// OutboxConfigFromEnv reads the OUTBOX_* variables, falling back to defaults that retry
+// for about a day: 10s, 20s, 40s... up to 2h between attempts, 20 attempts in total.
+func OutboxConfigFromEnv() *OutboxConfig {
+	cfg := &OutboxConfig{
+		MaxAttempts:   20,
+		RetryDelay:    durationFromEnv("OUTBOX_RETRY_DELAY", 10*time.Second),
+		MaxRetryDelay: durationFromEnv("OUTBOX_MAX_RETRY_DELAY", 2*time.Hour),
+		PollInterval:  durationFromEnv("OUTBOX_POLL_INTERVAL", time.Second),
+	}
+
+	if raw := os.Getenv("OUTBOX_MAX_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			log.Warnf("invalid OUTBOX_MAX_ATTEMPTS (%q), using default: %d", raw, cfg.MaxAttempts)
+		} else {
+			cfg.MaxAttempts = attempts
+		}
+	}
+	return cfg
+}
+
+// OutboxDispatcher hands the outbox messages to their handler, in the background.
+type OutboxDispatcher struct {
+	OutboxRepo OutboxRepository
+	Config     *OutboxConfig
+
+	handlers map[string]OutboxHandler
+}
+
+func NewOutboxDispatcher(outboxRepo OutboxRepository, cfg *OutboxConfig) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		OutboxRepo: outboxRepo,
+		Config:     cfg,
+		handlers:   make(map[string]OutboxHandler),
+	}
+}
+
+// Handle registers the handler of a kind of messages.
+func (d *OutboxDispatcher) Handle(kind string, handler OutboxHandler) {
+	d.handlers[kind] = handler
+}
+
+// Run handles the messages as they are due, every poll interval, until the context is done.
+// Messages are kept in the database until handled, so the ones interrupted by a restart are resumed.
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back, there may be more due
+		for d.DispatchDue(utils.NowUTC()) == outboxBatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchDue handles the messages that are due at the given time, and returns how many were handled.
+// Handled messages are deleted, while failed ones are tried again later on, until they run out of attempts.
+func (d *OutboxDispatcher) DispatchDue(now int64) int {
+	msgs, err := d.OutboxRepo.FindDue(now, outboxBatchSize)
+	if err != nil {
+		log.Errorf("failed to fetch due outbox messages: %v", err)
+		return 0
+	}
+
+	for _, msg := range msgs {
+		err = d.dispatch(msg)
+		if err == nil {
+			err = d.OutboxRepo.Delete(msg.ID)
+			if err != nil {
+				log.Errorf("failed to delete outbox message %d: %v", msg.ID, err)
+			}
+			continue
+		}
+
+		msg.Attempts++
+		msg.LastError = err.Error()
+		msg.UpdatedAt = now
+		if msg.Attempts >= d.Config.MaxAttempts {
+			msg.Status = entity.OutboxFailed
+			log.Errorf("giving up %s outbox message %d after %d attempts: %v", msg.Kind, msg.ID, msg.Attempts, err)
+		} else {
+			msg.NextAttemptAt = now + backoff(d.Config.RetryDelay, d.Config.MaxRetryDelay, msg.Attempts).Milliseconds()
+			log.Warnf("failed to handle %s outbox message %d (attempt %d): %v", msg.Kind, msg.ID, msg.Attempts, err)
+		}
+
+		err = d.OutboxRepo.Save(msg)
+		if err != nil {
+			log.Errorf("failed to save outbox message %d: %v", msg.ID, err)
+		}
+	}
+	return len(msgs)
+}
+
+func (d *OutboxDispatcher) dispatch(msg *entity.OutboxMessage) (err error) {
+	handler, ok := d.handlers[msg.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for %s messages", msg.Kind)
+	}
+
+	// A bug in a handler must not take the dispatcher down
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler([]byte(msg.Payload))
+}
+
+// backoff returns the wait after the given number of failed attempts: base, twice base,
+// four times base... up to max.
+func backoff(base, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"4shure/cmd/internal/notification"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// NotificationHandler sends the OutboxNotification messages. Appointments are loaded as they are
+// right now: the ones gone missing are skipped, as well as cancelled ones for reminders.
+func NotificationHandler(apptRepo AppointmentRepository, userRepo UserRepository, resourceRepo ResourceRepository, notifier Notifier) OutboxHandler {
+	return func(raw []byte) error {
+		var payload notificationPayload
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return err
+		}
+
+		var appts []*entity.Appointment
+		for _, id := range payload.AppointmentIDs {
+			appt, err := apptRepo.FindByID(id)
+			if err != nil {
+				return fmt.Errorf("failed to fetch appointment by id %d: %w", id, err)
+			}
+
+			if appt == nil || (payload.Kind == notification.Reminder && appt.IsDeleted) {
+				continue
+			}
+			appts = append(appts, appt)
+		}
+
+		if len(appts) == 0 {
+			return nil
+		}
+
+		event, err := newNotificationEvent(userRepo, resourceRepo, payload.Kind, appts)
+		if err != nil {
+			return err
+		}
+
+		if event == nil {
+			return nil
+		}
+
+		event.Lead = time.Duration(payload.LeadMinutes) * time.Minute
+		return notifier.Notify(event)
+	}
+}
+
+// WebhookHandler publishes the OutboxWebhookEvent messages.
+func WebhookHandler(publisher EventPublisher) OutboxHandler {
+	return func(raw []byte) error {
+		var payload webhookPayload
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return err
+		}
+		// Messages queued before events had an ID get a new one each time
+		if payload.ID == "" {
+			payload.ID = "evt_" + rand.Text()
+		}
+		return publisher.Publish(payload.ID, payload.Type, payload.Data)
+	}
+}
+
+// CalendarHandler publishes the slots of the OutboxCalendarEvent messages to the calendar
+// streams of this process.
+func CalendarHandler(calendar CalendarPublisher) OutboxHandler {
+	return func(raw []byte) error {
+		var payload calendarPayload
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return err
+		}
+
+		appts := make([]*entity.Appointment, len(payload.Slots))
+		for i, slot := range payload.Slots {
+			appts[i] = &entity.Appointment{ResourceID: slot.ResourceID, BeginsAt: slot.BeginsAt, EndsAt: slot.EndsAt}
+		}
+		calendar.Publish(slotEvents(payload.Type, appts...)...)
+		return nil
+	}
+}
+
+// DeleteIdentityHandler deletes the Cognito user of the OutboxDeleteIdentity messages,
+// e.g. once their account was deleted. Users already gone are done with.
+func DeleteIdentityHandler(cogClient cognitoclient.CognitoInterface) OutboxHandler {
+	return func(raw []byte) error {
+		var payload identityPayload
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return err
+		}
+		return deleteIdentity(cogClient, payload.Email)
+	}
+}
+
+// SignupCleanupHandler deletes the Cognito user of the OutboxSignupCleanup messages, unless the
+// signup went through and the user was saved in our database. See DefaultUserService.CreateUser.
+func SignupCleanupHandler(cogClient cognitoclient.CognitoInterface, userRepo UserRepository) OutboxHandler {
+	return func(raw []byte) error {
+		var payload identityPayload
+		err := json.Unmarshal(raw, &payload)
+		if err != nil {
+			return err
+		}
+
+		user, err := userRepo.FindByEmail(payload.Email)
+		if err != nil {
+			return fmt.Errorf("failed to fetch user by email: %w", err)
+		}
+
+		if user != nil && !user.IsDeleted {
+			return nil
+		}
+		return deleteIdentity(cogClient, payload.Email)
+	}
+}
+
+func deleteIdentity(cogClient cognitoclient.CognitoInterface, email string) error {
+	err := cogClient.AdminDeleteUser(email)
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "UserNotFoundException" {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/integration/aws/cognito/cognitotest"
+	"testing"
+	"time"
+)
+
+func newTestOutboxDispatcher(msgs ...*entity.OutboxMessage) (*OutboxDispatcher, *fakeOutboxRepo) {
+	repo := &fakeOutboxRepo{}
+	_ = repo.Enqueue(msgs...)
+	cfg := &OutboxConfig{
+		MaxAttempts:   3,
+		RetryDelay:    time.Minute,
+		MaxRetryDelay: time.Hour,
+		PollInterval:  time.Second,
+	}
+	return NewOutboxDispatcher(repo, cfg), repo
+}
+
+func TestDispatchDue(t *testing.T) {
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC).UnixMilli()
+	msg := &entity.OutboxMessage{Kind: "test", Payload: "{}", Status: entity.OutboxPending, NextAttemptAt: now}
+	dispatcher, repo := newTestOutboxDispatcher(msg)
+
+	handled := 0
+	var err error
+	dispatcher.Handle("test", func([]byte) error {
+		handled++
+		return err
+	})
+
+	// Failed messages are tried again later on, twice as late every time
+	err = errFake
+	for attempt, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if n := dispatcher.DispatchDue(now); n != 1 {
+			t.Fatalf("DispatchDue() = %d on attempt %d, want 1", n, attempt+1)
+		}
+
+		if msg.Status != entity.OutboxPending || msg.LastError != errFake.Error() || msg.NextAttemptAt != now+wait.Milliseconds() {
+			t.Fatalf("unexpected message after attempt %d: %+v", attempt+1, msg)
+		}
+
+		if n := dispatcher.DispatchDue(now); n != 0 {
+			t.Fatalf("DispatchDue() = %d before the retry is due, want 0", n)
+		}
+		now = msg.NextAttemptAt
+	}
+
+	// Handled messages are deleted
+	err = nil
+	if n := dispatcher.DispatchDue(now); n != 1 || handled != 3 || len(repo.msgs) != 0 {
+		t.Errorf("DispatchDue() = %d, handled %d times, %d messages left, want it handled and deleted", n, handled, len(repo.msgs))
+	}
+}
+
+func TestDispatchDueGivesUp(t *testing.T) {
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC).UnixMilli()
+	unknown := &entity.OutboxMessage{Kind: "unknown", Status: entity.OutboxPending, NextAttemptAt: now}
+	panics := &entity.OutboxMessage{Kind: "panics", Status: entity.OutboxPending, NextAttemptAt: now}
+	dispatcher, repo := newTestOutboxDispatcher(unknown, panics)
+	dispatcher.Handle("panics", func([]byte) error { panic("bug") })
+
+	for range dispatcher.Config.MaxAttempts {
+		dispatcher.DispatchDue(now)
+		now += time.Hour.Milliseconds()
+	}
+
+	for _, msg := range []*entity.OutboxMessage{unknown, panics} {
+		if msg.Status != entity.OutboxFailed || msg.Attempts != 3 || msg.LastError == "" {
+			t.Errorf("unexpected message %+v, want it failed after 3 attempts", msg)
+		}
+	}
+
+	if n := dispatcher.DispatchDue(now); n != 0 || len(repo.msgs) != 2 {
+		t.Errorf("DispatchDue() = %d, want failed messages kept but not handled again", n)
+	}
+}
+
+func TestSignupCleanupHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		saved   bool
+		inPool  bool
+		deleted bool
+	}{
+		{name: "signup went through", saved: true, inPool: true},
+		{name: "not saved", inPool: true, deleted: true},
+		{name: "not in pool either"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUserRepo{}
+			if tt.saved {
+				repo.users = append(repo.users, &entity.User{ID: 1, Email: "new@example.com"})
+			}
+
+			cognito := cognitotest.New()
+			if tt.inPool {
+				cognito.AddUser("new@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword})
+			}
+
+			err := SignupCleanupHandler(cognito, repo)([]byte(`{"email":"new@example.com"}`))
+			if err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+
+			if deleted := tt.inPool && cognito.User("new@example.com") == nil; deleted != tt.deleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerRetriesFailures(t *testing.T) {
+	publisher := &fakePublisher{err: errFake}
+	handle := WebhookHandler(publisher)
+	payload := []byte(`{"type":"user.verified","data":{"id":1}}`)
+
+	if err := handle(payload); err != errFake {
+		t.Fatalf("handler error = %v, want %v", err, errFake)
+	}
+
+	publisher.err = nil
+	if err := handle(payload); err != nil || len(publisher.events) != 1 || publisher.events[0].Type != EventUserVerified {
+		t.Errorf("handler error = %v, published %v", err, publisher.types())
+	}
+}
+
+func TestWebhookMessageKeepsEventID(t *testing.T) {
+	msg, err := webhookMessage(EventUserVerified, &UserResponse{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every attempt publishes the event under the ID it was queued with
+	publisher := &fakePublisher{}
+	handle := WebhookHandler(publisher)
+	for range 2 {
+		if err := handle([]byte(msg.Payload)); err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+	}
+
+	if len(publisher.events) != 2 || publisher.events[0].ID == "" || publisher.events[0].ID != publisher.events[1].ID {
+		t.Errorf("published %+v, want the same event ID twice", publisher.events)
+	}
+}
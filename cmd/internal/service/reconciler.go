@@ -0,0 +1,269 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"4shure/cmd/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// Kinds of drift between the Cognito pool and our database, see Reconciler.
+const (
+	// DriftMissingRow is a confirmed and enabled pool user without a row in our database,
+	// e.g. after a signup that failed halfway through. It is fixed by saving the row. Users
+	// whose account was deleted, and whose pool user is still to be deleted, are left alone.
+	DriftMissingRow = "missing_row"
+
+	// DriftOrphan is a user of our database that is not in the pool anymore, e.g. after
+	// being deleted in the AWS console. It is fixed like a deleted account: the upcoming
+	// appointments of the user are cancelled and their row is anonymised.
+	DriftOrphan = "orphan"
+
+	// DriftEmailVerified is a user whose EmailVerified differs from the pool, e.g. after
+	// being confirmed in the AWS console. It is fixed by taking the value of the pool.
+	DriftEmailVerified = "email_verified"
+
+	// DriftConflict is a pool user whose e-mail belongs to another user of our database.
+	// It is only reported, as it needs someone to look into it.
+	DriftConflict = "conflict"
+)
+
+// Drift is a difference between the pool and our database, found by the Reconciler.
+type Drift struct {
+	Kind   string `json:"kind"`
+	Sub    string `json:"sub"`
+	Email  string `json:"email"`
+	UserID int    `json:"user_id,omitempty"`
+	Fixed  bool   `json:"fixed"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ReconcileReport struct {
+	PoolUsers  int      `json:"pool_users"`
+	LocalUsers int      `json:"local_users"`
+	Drifts     []*Drift `json:"drifts"`
+}
+
+// Reconciler compares the users of the Cognito pool with the ones of our database, by sub,
+// and fixes the drifts found (see DriftMissingRow and the other kinds) unless asked for a dry run.
+type Reconciler struct {
+	UserRepo        UserRepository
+	AppointmentRepo AppointmentRepository
+	OutboxRepo      OutboxRepository
+	Cognito         cognitoclient.CognitoInterface
+	Tx              Transactor
+
+	// GracePeriod leaves the pool users created since alone, as their signup may still be going on.
+	GracePeriod time.Duration
+}
+
+func NewReconciler(userRepo UserRepository, apptRepo AppointmentRepository, outboxRepo OutboxRepository, cogClient cognitoclient.CognitoInterface, tx Transactor) *Reconciler {
+	return &Reconciler{
+		UserRepo:        userRepo,
+		AppointmentRepo: apptRepo,
+		OutboxRepo:      outboxRepo,
+		Cognito:         cogClient,
+		Tx:              tx,
+		GracePeriod:     signupCleanupDelay,
+	}
+}
+
+// Reconcile lists every user of the pool, and compares them with the (not deleted) users of our
+// database. Nothing is changed when dryRun is set. An error is only returned if the users could not
+// be listed, failures to fix a drift are reported along with it.
+func (r *Reconciler) Reconcile(dryRun bool) (*ReconcileReport, error) {
+	var poolUsers []*cognitoclient.PoolUser
+	token := ""
+	for {
+		page, next, err := r.Cognito.AdminListUsers(token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pool users: %w", err)
+		}
+
+		poolUsers = append(poolUsers, page...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	users, err := r.UserRepo.FindAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch all users: %w", err)
+	}
+
+	deleting, err := r.pendingDeletions()
+	if err != nil {
+		return nil, err
+	}
+
+	bySub := make(map[string]*entity.User, len(users))
+	byEmail := make(map[string]*entity.User, len(users))
+	for _, user := range users {
+		bySub[user.SubUUID] = user
+		byEmail[user.Email] = user
+	}
+
+	report := &ReconcileReport{PoolUsers: len(poolUsers), LocalUsers: len(users), Drifts: make([]*Drift, 0)}
+	seen := make(map[int]bool, len(users))
+	since := time.Now().Add(-r.GracePeriod)
+	for _, poolUser := range poolUsers {
+		user := bySub[poolUser.Sub]
+		if user == nil {
+			if poolUser.CreatedAt.After(since) || !poolUser.Confirmed() || !poolUser.Enabled || deleting[poolUser.Email] {
+				continue
+			}
+
+			if other := byEmail[poolUser.Email]; other != nil {
+				seen[other.ID] = true
+				report.add(&Drift{Kind: DriftConflict, Sub: poolUser.Sub, Email: poolUser.Email, UserID: other.ID}, nil)
+				continue
+			}
+
+			drift := &Drift{Kind: DriftMissingRow, Sub: poolUser.Sub, Email: poolUser.Email}
+			report.add(drift, r.fix(dryRun, drift, func() error { return r.saveMissing(poolUser, drift) }))
+			continue
+		}
+
+		seen[user.ID] = true
+		if user.EmailVerified != poolUser.EmailVerified {
+			drift := &Drift{Kind: DriftEmailVerified, Sub: user.SubUUID, Email: user.Email, UserID: user.ID}
+			report.add(drift, r.fix(dryRun, drift, func() error { return r.setEmailVerified(user, poolUser.EmailVerified) }))
+		}
+	}
+
+	for _, user := range users {
+		if seen[user.ID] {
+			continue
+		}
+
+		drift, err := r.checkOrphan(user)
+		switch {
+		case err != nil:
+			report.add(&Drift{Kind: DriftOrphan, Sub: user.SubUUID, Email: user.Email, UserID: user.ID}, err)
+		case drift == nil:
+		case drift.Kind == DriftConflict:
+			report.add(drift, nil)
+		default:
+			report.add(drift, r.fix(dryRun, drift, func() error { return closeAccount(r.AppointmentRepo, r.Tx, nil, user, false) }))
+		}
+	}
+	return report, nil
+}
+
+// pendingDeletions returns the e-mails of the pool users still to be deleted, see OutboxDeleteIdentity.
+// Their account is already deleted, so they must not be taken for missing rows.
+func (r *Reconciler) pendingDeletions() (map[string]bool, error) {
+	msgs, err := r.OutboxRepo.FindByKind(OutboxDeleteIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pending deletions: %w", err)
+	}
+
+	emails := make(map[string]bool, len(msgs))
+	for _, msg := range msgs {
+		var payload identityPayload
+		err := json.Unmarshal([]byte(msg.Payload), &payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s message %d: %w", msg.Kind, msg.ID, err)
+		}
+		emails[payload.Email] = true
+	}
+	return emails, nil
+}
+
+// checkOrphan looks the user missing from the listing up by e-mail, as they may have signed up
+// in the meantime. It returns nil when they did, and a conflict when the e-mail now belongs to
+// another pool user.
+func (r *Reconciler) checkOrphan(user *entity.User) (*Drift, error) {
+	drift := &Drift{Kind: DriftOrphan, Sub: user.SubUUID, Email: user.Email, UserID: user.ID}
+	poolUser, err := r.Cognito.AdminGetUser(user.Email)
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "UserNotFoundException" {
+		return drift, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool user: %w", err)
+	}
+
+	if poolUser.Sub == user.SubUUID {
+		return nil, nil
+	}
+
+	drift.Kind = DriftConflict
+	drift.Sub = poolUser.Sub
+	return drift, nil
+}
+
+// fix runs the fix of the drift, unless it is a dry run.
+func (r *Reconciler) fix(dryRun bool, drift *Drift, fn func() error) error {
+	if dryRun {
+		return nil
+	}
+
+	err := fn()
+	drift.Fixed = err == nil
+	return err
+}
+
+// saveMissing saves the row of a pool user, named after their e-mail until they change it.
+func (r *Reconciler) saveMissing(poolUser *cognitoclient.PoolUser, drift *Drift) error {
+	now := utils.NowUTC()
+	createdAt := now
+	if !poolUser.CreatedAt.IsZero() {
+		createdAt = poolUser.CreatedAt.UnixMilli()
+	}
+
+	username, _, _ := strings.Cut(poolUser.Email, "@")
+	if len(username) < 2 || len(username) > 80 {
+		username = "New user"
+	}
+
+	user := &entity.User{
+		SubUUID:       poolUser.Sub,
+		Username:      username,
+		Email:         poolUser.Email,
+		EmailVerified: poolUser.EmailVerified,
+		Role:          authz.RoleMember,
+		CreatedAt:     createdAt,
+		UpdatedAt:     now,
+	}
+
+	err := r.UserRepo.Save(user)
+	drift.UserID = user.ID
+	return err
+}
+
+// setEmailVerified takes the value of the pool, letting webhooks know about newly verified users.
+func (r *Reconciler) setEmailVerified(user *entity.User, verified bool) error {
+	user.EmailVerified = verified
+	user.UpdatedAt = utils.NowUTC()
+	return r.Tx.Transaction(func(tx *TxRepositories) error {
+		err := tx.Users.Save(user)
+		if err != nil || !verified {
+			return err
+		}
+
+		msg, err := webhookMessage(EventUserVerified, toUserResponse(user, user))
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Enqueue(msg)
+	})
+}
+
+// add reports the drift, along with the failure to fix it if any.
+func (r *ReconcileReport) add(drift *Drift, err error) {
+	if err != nil {
+		drift.Error = err.Error()
+	}
+	r.Drifts = append(r.Drifts, drift)
+}
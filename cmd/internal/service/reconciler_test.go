@@ -0,0 +1,230 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
+	"4shure/cmd/internal/integration/aws/cognito/cognitotest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestReconciler(users ...*entity.User) (*Reconciler, *fakeUserRepo, *cognitotest.Fake, *fakeOutboxRepo) {
+	repo := &fakeUserRepo{users: users}
+	apptRepo := &fakeAppointmentRepo{}
+	outbox := &fakeOutboxRepo{}
+	cognito := cognitotest.New()
+	tx := &fakeTransactor{repos: &TxRepositories{Users: repo, Appointments: apptRepo, Outbox: outbox}}
+	return NewReconciler(repo, apptRepo, outbox, cognito, tx), repo, cognito, outbox
+}
+
+// copyUsers copies the users, so that each run starts from the same ones.
+func copyUsers(users ...*entity.User) []*entity.User {
+	copies := make([]*entity.User, len(users))
+	for i, user := range users {
+		c := *user
+		copies[i] = &c
+	}
+	return copies
+}
+
+func TestReconcile(t *testing.T) {
+	inSync := &entity.User{ID: 1, SubUUID: "sub-1", Email: "sync@example.com", EmailVerified: true}
+	confirmedByAdmin := &entity.User{ID: 2, SubUUID: "sub-2", Email: "admin-confirmed@example.com"}
+	orphan := &entity.User{ID: 3, SubUUID: "sub-3", Email: "orphan@example.com", EmailVerified: true}
+	replaced := &entity.User{ID: 4, SubUUID: "sub-4", Email: "replaced@example.com", EmailVerified: true}
+
+	for _, dryRun := range []bool{true, false} {
+		svc, repo, cognito, outbox := newTestReconciler(copyUsers(inSync, confirmedByAdmin, orphan, replaced)...)
+		cognito.AddUser(inSync.Email, &cognitotest.User{Sub: "sub-1", Confirmed: true})
+		cognito.AddUser(confirmedByAdmin.Email, &cognitotest.User{Sub: "sub-2", Confirmed: true})
+		cognito.AddUser(replaced.Email, &cognitotest.User{Sub: "sub-44", Confirmed: true})
+		cognito.AddUser("missing@example.com", &cognitotest.User{Sub: "sub-5", Confirmed: true})
+		cognito.AddUser("signing-up@example.com", &cognitotest.User{Sub: "sub-6", CreatedAt: time.Now()})
+
+		report, err := svc.Reconcile(dryRun)
+		if err != nil {
+			t.Fatalf("Reconcile(%v) error = %v", dryRun, err)
+		}
+
+		got := make(map[string]*Drift)
+		for _, drift := range report.Drifts {
+			got[drift.Email] = drift
+			if drift.Error != "" || drift.Fixed == dryRun && drift.Kind != DriftConflict {
+				t.Errorf("Reconcile(%v): unexpected drift %+v", dryRun, drift)
+			}
+		}
+
+		want := map[string]string{
+			"admin-confirmed@example.com": DriftEmailVerified,
+			"orphan@example.com":          DriftOrphan,
+			"replaced@example.com":        DriftConflict,
+			"missing@example.com":         DriftMissingRow,
+		}
+		if report.PoolUsers != 5 || report.LocalUsers != 4 || len(got) != len(want) {
+			t.Fatalf("Reconcile(%v) = %+v, want %d drifts", dryRun, report, len(want))
+		}
+
+		for email, kind := range want {
+			if got[email] == nil || got[email].Kind != kind {
+				t.Errorf("Reconcile(%v): drift of %s = %+v, want %s", dryRun, email, got[email], kind)
+			}
+		}
+
+		verified, _ := repo.FindByID(confirmedByAdmin.ID)
+		anonymised, _ := repo.FindByID(orphan.ID)
+		added, _ := repo.FindBySub("sub-5")
+		if dryRun {
+			if verified.EmailVerified || anonymised.IsDeleted || added != nil || len(outbox.msgs) != 0 {
+				t.Errorf("Reconcile(true) changed something")
+			}
+			continue
+		}
+
+		if !verified.EmailVerified || len(outbox.msgs) != 1 || outbox.msgs[0].Kind != OutboxWebhookEvent {
+			t.Errorf("unexpected verified user %+v (outbox %v)", verified, outbox.kinds())
+		}
+
+		if !anonymised.IsDeleted || anonymised.Email != "" {
+			t.Errorf("unexpected orphan %+v, want it anonymised", anonymised)
+		}
+
+		if added == nil || added.Username != "missing" || added.Email != "missing@example.com" || !added.EmailVerified {
+			t.Errorf("unexpected added user %+v", added)
+		}
+
+		// Nothing is left to fix, except the conflict
+		again, _ := svc.Reconcile(false)
+		if len(again.Drifts) != 1 || again.Drifts[0].Kind != DriftConflict {
+			t.Errorf("Reconcile() = %+v on the next run, want the conflict only", again.Drifts)
+		}
+	}
+}
+
+func TestReconcileLeavesPoolUsersAlone(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     *cognitotest.User
+		deleting bool
+	}{
+		{name: "deletion pending", user: &cognitotest.User{Sub: "sub-1", Confirmed: true}, deleting: true},
+		{name: "unconfirmed", user: &cognitotest.User{Sub: "sub-2"}},
+		{name: "disabled", user: &cognitotest.User{Sub: "sub-3", Confirmed: true, Disabled: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com", EmailVerified: true}
+			svc, repo, cognito, outbox := newTestReconciler(user)
+			cognito.AddUser(user.Email, tt.user)
+
+			// The account is deleted, but its pool user is not yet
+			if err := closeAccount(svc.AppointmentRepo, svc.Tx, nil, user, true); err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.deleting {
+				outbox.msgs = nil
+			}
+
+			report, err := svc.Reconcile(false)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			if added, _ := repo.FindBySub(tt.user.Sub); len(report.Drifts) != 0 || added != nil {
+				t.Errorf("Reconcile() = %+v, added %+v, want the pool user left alone", report.Drifts, added)
+			}
+		})
+	}
+}
+
+func TestReconcileListingFails(t *testing.T) {
+	svc, repo, cognito, _ := newTestReconciler(&entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"})
+	cognito.FailWith("AdminListUsers", "TooManyRequestsException")
+
+	if _, err := svc.Reconcile(false); err == nil {
+		t.Fatal("Reconcile() error = nil, want the listing failure")
+	}
+
+	if repo.users[0].IsDeleted {
+		t.Error("expected nothing to be fixed from a failed listing")
+	}
+}
+
+// unlisted hides every user from the listing, as if they signed up after it.
+type unlisted struct {
+	*cognitotest.Fake
+}
+
+func (u *unlisted) AdminListUsers(string) ([]*cognitoclient.PoolUser, string, error) {
+	return nil, "", nil
+}
+
+func TestReconcileUnlistedUser(t *testing.T) {
+	tests := []struct {
+		name string
+		sub  string
+		want string
+	}{
+		{name: "signed up meanwhile", sub: "sub-1"},
+		{name: "replaced meanwhile", sub: "sub-2", want: DriftConflict},
+		{name: "not in pool", want: DriftOrphan},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"}
+			svc, _, cognito, _ := newTestReconciler(user)
+			svc.Cognito = &unlisted{Fake: cognito}
+			if tt.sub != "" {
+				cognito.AddUser(user.Email, &cognitotest.User{Sub: tt.sub, Confirmed: true})
+			}
+
+			report, err := svc.Reconcile(false)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			var got string
+			if len(report.Drifts) == 1 {
+				got = report.Drifts[0].Kind
+			}
+
+			if len(report.Drifts) > 1 || got != tt.want {
+				t.Fatalf("Reconcile() = %+v, want %q", report.Drifts, tt.want)
+			}
+
+			if deleted := tt.want == DriftOrphan; user.IsDeleted != deleted {
+				t.Errorf("user deleted = %v, want %v", user.IsDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestReconcilePublishesFreedSlotsThroughOutbox(t *testing.T) {
+	user := &entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"}
+	svc, _, _, outbox := newTestReconciler(user)
+	apptRepo := svc.AppointmentRepo.(*fakeAppointmentRepo)
+	apptRepo.appts = append(apptRepo.appts, existing(1, user, tomorrow(0), false))
+
+	if report, err := svc.Reconcile(false); err != nil || len(report.Drifts) != 1 || report.Drifts[0].Kind != DriftOrphan {
+		t.Fatalf("Reconcile() = %+v, %v, want the orphan closed", report, err)
+	}
+
+	// The API process publishes the slots freed by the command
+	calendar := NewCalendarBroker()
+	sub, _ := calendar.Subscribe(CalendarFilter{ResourceID: 1, From: 0, To: tomorrow(24).UnixMilli()}, 0)
+	dispatcher := NewOutboxDispatcher(outbox, &OutboxConfig{MaxAttempts: 1})
+	dispatcher.Handle(OutboxWebhookEvent, WebhookHandler(&fakePublisher{}))
+	dispatcher.Handle(OutboxCalendarEvent, CalendarHandler(calendar))
+	dispatcher.DispatchDue(time.Now().UnixMilli())
+
+	if streamed := receive(sub); !slices.Equal(streamed, []string{SlotFreed}) {
+		t.Errorf("streamed %v, want the slot freed", streamed)
+	}
+
+	if len(outbox.msgs) != 0 {
+		t.Errorf("outbox messages %v were not handled", outbox.kinds())
+	}
+}
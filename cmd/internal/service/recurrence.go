@@ -0,0 +1,167 @@
+package service
+
+import (
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Scopes used when editing or cancelling an occurrence of a recurring series.
+const (
+	// ScopeThis only affects the selected occurrence. This is the default.
+	ScopeThis = "this"
+
+	// ScopeFollowing affects the selected occurrence and every one after it.
+	ScopeFollowing = "following"
+
+	// ScopeAll affects the selected occurrence and every one that has not begun yet.
+	ScopeAll = "all"
+)
+
+// maxSeriesOccurrences caps how many appointments a single series can create.
+const maxSeriesOccurrences = 100
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RecurrenceRequest is a (small) subset of iCalendar's RRULE.
+// All dates are evaluated in the business time zone (see AppointmentConfig.Location), so that
+// occurrences keep their wall-clock time across daylight saving time changes.
+type RecurrenceRequest struct {
+	Frequency string `json:"frequency" validate:"required,oneof=daily weekly monthly"`
+
+	// Interval is the number of days, weeks or months between occurrences. Defaults to 1.
+	Interval int `json:"interval" validate:"omitempty,min=1,max=52"`
+
+	// Count and Until are mutually exclusive, but one of them is required.
+	Count int    `json:"count" validate:"omitempty,min=1,max=100"`
+	Until string `json:"until" validate:"omitempty,iso8601"`
+
+	// Weekdays restricts daily and weekly series to the given days, e.g., ["MO", "WE"].
+	Weekdays []string `json:"weekdays" validate:"omitempty,nodupes,dive,oneof=MO TU WE TH FR SA SU"`
+
+	// SkipConflicts books every available occurrence instead of rejecting the whole
+	// series when any of them conflicts with an existing appointment.
+	SkipConflicts bool `json:"skip_conflicts"`
+}
+
+// expandOccurrences returns the begin date (epoch millis) of every occurrence of the
+// rule, starting at the given begin date, which is included if it matches the rule.
+// Days, weeks and months are counted in the given location.
+func expandOccurrences(begin int64, rule *RecurrenceRequest, loc *time.Location) ([]int64, apierror.ErrorResponse) {
+	if (rule.Count == 0) == (rule.Until == "") {
+		return nil, apierror.RecurrenceEndError
+	}
+
+	if len(rule.Weekdays) > 0 && rule.Frequency == FrequencyMonthly {
+		return nil, apierror.RecurrenceWeekdaysError
+	}
+
+	until := int64(math.MaxInt64)
+	if rule.Until != "" {
+		var err error
+		until, err = utils.FromEpoch(rule.Until)
+		if err != nil {
+			return nil, apierror.MalformedBodyError
+		}
+	}
+
+	limit := maxSeriesOccurrences
+	if rule.Count > 0 {
+		limit = rule.Count
+	}
+
+	interval := max(rule.Interval, 1)
+	days := make(map[time.Weekday]bool, len(rule.Weekdays))
+	for _, code := range rule.Weekdays {
+		days[weekdayCodes[code]] = true
+	}
+
+	start := time.UnixMilli(begin).In(loc)
+	var occurrences []int64
+
+	// Every iteration covers one period (a day, a week or a month). The upper bound
+	// only guards against rules that would never match anything.
+	for period := 0; period < 10*maxSeriesOccurrences*7; period++ {
+		var candidates []time.Time
+		switch rule.Frequency {
+		case FrequencyDaily:
+			candidates = []time.Time{start.AddDate(0, 0, period*interval)}
+
+		case FrequencyWeekly:
+			if len(days) == 0 {
+				candidates = []time.Time{start.AddDate(0, 0, 7*period*interval)}
+				break
+			}
+
+			// Walk through the week (Monday to Sunday) the period falls in
+			monday := start.AddDate(0, 0, 7*period*interval-(int(start.Weekday())+6)%7)
+			for d := 0; d < 7; d++ {
+				candidates = append(candidates, monday.AddDate(0, 0, d))
+			}
+
+		case FrequencyMonthly:
+			candidates = []time.Time{start.AddDate(0, period*interval, 0)}
+		}
+
+		for _, candidate := range candidates {
+			millis := candidate.UnixMilli()
+			if millis > until {
+				return checkOccurrenceLimit(occurrences)
+			}
+
+			if millis < begin || (len(days) > 0 && !days[candidate.Weekday()]) {
+				continue
+			}
+
+			// Months without the given day (e.g., the 31st) are skipped, just like RRULE does
+			if rule.Frequency == FrequencyMonthly && candidate.Day() != start.Day() {
+				continue
+			}
+
+			occurrences = append(occurrences, millis)
+			if len(occurrences) > limit || (rule.Count > 0 && len(occurrences) == limit) {
+				return checkOccurrenceLimit(occurrences)
+			}
+		}
+	}
+	return checkOccurrenceLimit(occurrences)
+}
+
+func checkOccurrenceLimit(occurrences []int64) ([]int64, apierror.ErrorResponse) {
+	if len(occurrences) > maxSeriesOccurrences {
+		return nil, apierror.NewTooManyOccurrencesError(maxSeriesOccurrences)
+	}
+	return occurrences, nil
+}
+
+// parseScope validates the given scope, defaulting to ScopeThis when empty.
+func parseScope(scope string) (string, apierror.ErrorResponse) {
+	switch scope {
+	case "":
+		return ScopeThis, nil
+	case ScopeThis, ScopeFollowing, ScopeAll:
+		return scope, nil
+	default:
+		return "", apierror.InvalidScopeError
+	}
+}
+
+func joinWeekdays(weekdays []string) string {
+	return strings.Join(weekdays, ",")
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/notification"
+	"4shure/cmd/internal/utils"
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+type ReminderRepository interface {
+	FindDue(lead time.Duration, now int64) ([]*entity.Appointment, error)
+	MarkReminded(appt *entity.Appointment, lead time.Duration) error
+}
+
+// ReminderConfig tells when appointment reminders are sent.
+type ReminderConfig struct {
+	// Leads are how long before an appointment begins its reminders are sent, e.g. 24h and 1h.
+	// No reminder is sent when empty.
+	Leads []time.Duration
+
+	// Interval is how often the scheduler looks for due reminders.
+	Interval time.Duration
+}
+
+// ReminderConfigFromEnv reads REMINDER_LEAD_TIMES, a comma-separated list of durations
+// (e.g. "24h,1h", or "none" to disable reminders) and REMINDER_INTERVAL. Invalid lead
+// times are skipped, and the defaults are one reminder 24 hours before, checked every minute.
+func ReminderConfigFromEnv() *ReminderConfig {
+	cfg := &ReminderConfig{
+		Leads:    []time.Duration{24 * time.Hour},
+		Interval: durationFromEnv("REMINDER_INTERVAL", time.Minute),
+	}
+
+	raw := os.Getenv("REMINDER_LEAD_TIMES")
+	if raw == "" {
+		return cfg
+	}
+
+	cfg.Leads = nil
+	if raw == "none" {
+		return cfg
+	}
+
+	for _, part := range strings.Split(raw, ",") {
+		lead, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || lead < time.Minute || lead%time.Minute != 0 {
+			log.Warnf("invalid reminder lead time %q, skipping it", part)
+			continue
+		}
+
+		if !slices.Contains(cfg.Leads, lead) {
+			cfg.Leads = append(cfg.Leads, lead)
+		}
+	}
+	return cfg
+}
+
+// ReminderScheduler sends a reminder for every appointment about to begin, once per lead time.
+// Reminders go through the outbox, see NotificationHandler.
+type ReminderScheduler struct {
+	ReminderRepo ReminderRepository
+	Tx           Transactor
+	Config       *ReminderConfig
+}
+
+func NewReminderScheduler(reminderRepo ReminderRepository, tx Transactor, cfg *ReminderConfig) *ReminderScheduler {
+	return &ReminderScheduler{
+		ReminderRepo: reminderRepo,
+		Tx:           tx,
+		Config:       cfg,
+	}
+}
+
+// Run sends the due reminders every interval, until the context is done.
+func (s *ReminderScheduler) Run(ctx context.Context) {
+	if len(s.Config.Leads) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.SendDue(utils.NowUTC())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue queues the reminders due at the given time, and returns how many were queued.
+//
+// Shorter lead times are handled first. An appointment reminded for one of them is not reminded
+// for the longer ones as well (e.g. after the scheduler was down), but still marked as such.
+// Reminders are marked along with their outbox message, so they are queued exactly once.
+func (s *ReminderScheduler) SendDue(now int64) int {
+	leads := slices.Clone(s.Config.Leads)
+	slices.Sort(leads)
+
+	sent := 0
+	reminded := make(map[int]bool)
+	for _, lead := range leads {
+		appts, err := s.ReminderRepo.FindDue(lead, now)
+		if err != nil {
+			log.Errorf("failed to find appointments to remind %s before: %v", lead, err)
+			continue
+		}
+
+		for _, appt := range appts {
+			send := !reminded[appt.ID]
+			err = s.remind(appt, lead, send)
+			if err != nil {
+				log.Errorf("failed to queue reminder for appointment %d: %v", appt.ID, err)
+				continue
+			}
+
+			if send {
+				reminded[appt.ID] = true
+				sent++
+			}
+		}
+	}
+	return sent
+}
+
+// remind marks the appointment as reminded for the given lead time, queueing its reminder if asked to.
+func (s *ReminderScheduler) remind(appt *entity.Appointment, lead time.Duration, send bool) error {
+	return s.Tx.Transaction(func(tx *TxRepositories) error {
+		err := tx.Reminders.MarkReminded(appt, lead)
+		if err != nil || !send {
+			return err
+		}
+
+		msg, err := notificationMessage(notification.Reminder, []*entity.Appointment{appt}, lead)
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Enqueue(msg)
+	})
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/notification"
+	"testing"
+	"time"
+)
+
+func newTestReminderScheduler(appts ...*entity.Appointment) (*ReminderScheduler, *fakeReminderRepo, *fakeOutboxRepo) {
+	reminderRepo := &fakeReminderRepo{appts: appts}
+	outbox := &fakeOutboxRepo{}
+	tx := &fakeTransactor{repos: &TxRepositories{Reminders: reminderRepo, Outbox: outbox}}
+
+	cfg := &ReminderConfig{Leads: []time.Duration{24 * time.Hour, time.Hour}, Interval: time.Minute}
+	return NewReminderScheduler(reminderRepo, tx, cfg), reminderRepo, outbox
+}
+
+// sendReminders hands the reminders queued in the outbox to the notification handler,
+// and returns the events it sent.
+func sendReminders(t *testing.T, outbox *fakeOutboxRepo, appts []*entity.Appointment) []*notification.Event {
+	t.Helper()
+	userRepo := &fakeUserRepo{users: []*entity.User{member, other, {ID: 4, IsDeleted: true}}}
+	resourceRepo := &fakeResourceRepo{resources: []*entity.Resource{{ID: 1, Name: "Room"}}}
+	notifier := &fakeNotifier{}
+
+	handle := NotificationHandler(&fakeAppointmentRepo{appts: appts}, userRepo, resourceRepo, notifier)
+	for _, msg := range outbox.msgs {
+		if err := handle([]byte(msg.Payload)); err != nil {
+			t.Fatalf("failed to handle %s: %v", msg.Payload, err)
+		}
+	}
+	outbox.msgs = nil
+	return notifier.events
+}
+
+func TestReminderSchedulerSendDue(t *testing.T) {
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	dayAhead := existing(1, member, now.Add(20*time.Hour), false)
+	hourAhead := existing(2, other, now.Add(30*time.Minute), false)
+	cancelled := existing(3, member, now.Add(2*time.Hour), true)
+	later := existing(4, member, now.Add(48*time.Hour), false)
+	justBooked := existing(5, other, now.Add(5*time.Hour), false)
+	justBooked.CreatedAt = now.Add(-time.Hour).UnixMilli()
+	deletedUser := existing(6, &entity.User{ID: 4}, now.Add(3*time.Hour), false)
+
+	appts := []*entity.Appointment{dayAhead, hourAhead, cancelled, later, justBooked, deletedUser}
+	svc, repo, outbox := newTestReminderScheduler(appts...)
+
+	sent := svc.SendDue(now.UnixMilli())
+	if sent != 3 {
+		t.Errorf("SendDue() = %d, want 3", sent)
+	}
+
+	got := make(map[int]time.Duration)
+	for _, event := range sendReminders(t, outbox, appts) {
+		if event.Kind != notification.Reminder || event.Resource == nil || len(event.Appointments) != 1 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		got[event.Appointments[0].ID] = event.Lead
+	}
+
+	// The appointment beginning in 30 minutes only gets the one hour reminder
+	want := map[int]time.Duration{1: 24 * time.Hour, 2: time.Hour}
+	if len(got) != len(want) || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("reminded %v, want %v", got, want)
+	}
+
+	// Both lead times are marked for the appointment beginning in 30 minutes, and the
+	// appointment of the deleted user is marked though nothing was sent
+	if len(repo.reminded[2]) != 2 || len(repo.reminded[6]) != 1 {
+		t.Errorf("unexpected reminded lead times %v", repo.reminded)
+	}
+
+	// Nothing is sent twice
+	if sent := svc.SendDue(now.Add(time.Minute).UnixMilli()); sent != 0 || len(outbox.msgs) != 0 {
+		t.Errorf("SendDue() = %d (%d messages) on the next run, want 0", sent, len(outbox.msgs))
+	}
+}
+
+func TestReminderSchedulerRetriesFailures(t *testing.T) {
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	svc, repo, outbox := newTestReminderScheduler(existing(1, member, now.Add(20*time.Hour), false))
+
+	tx := svc.Tx.(*fakeTransactor)
+	tx.err = errFake
+	if sent := svc.SendDue(now.UnixMilli()); sent != 0 || len(repo.reminded) != 0 {
+		t.Fatalf("SendDue() = %d, reminded %v, want nothing marked", sent, repo.reminded)
+	}
+
+	tx.err = nil
+	if sent := svc.SendDue(now.Add(time.Minute).UnixMilli()); sent != 1 || len(outbox.msgs) != 1 {
+		t.Errorf("SendDue() = %d (%d messages) on the next run, want 1", sent, len(outbox.msgs))
+	}
+}
+
+func TestNotificationHandlerSkipsCancelledReminders(t *testing.T) {
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	appt := existing(1, member, now.Add(20*time.Hour), false)
+	svc, _, outbox := newTestReminderScheduler(appt)
+	svc.SendDue(now.UnixMilli())
+
+	// Cancelled before the reminder is sent
+	appt.IsDeleted = true
+	if events := sendReminders(t, outbox, []*entity.Appointment{appt}); len(events) != 0 {
+		t.Errorf("unexpected reminders %+v for a cancelled appointment", events)
+	}
+}
+
+func TestReminderConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []time.Duration
+	}{
+		{raw: "", want: []time.Duration{24 * time.Hour}},
+		{raw: "none"},
+		{raw: "24h, 1h,24h", want: []time.Duration{24 * time.Hour, time.Hour}},
+		{raw: "2h,soon,30s", want: []time.Duration{2 * time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Setenv("REMINDER_LEAD_TIMES", tt.raw)
+			got := ReminderConfigFromEnv().Leads
+			if len(got) != len(tt.want) {
+				t.Fatalf("Leads = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Leads = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
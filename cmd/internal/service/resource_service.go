@@ -0,0 +1,175 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/gommon/log"
+)
+
+type ResourceRepository interface {
+	FindByID(id int) (*entity.Resource, error)
+	FindAll() ([]*entity.Resource, error)
+	Save(resource *entity.Resource) error
+}
+
+type ResourceRequest struct {
+	Name        string `json:"name" validate:"required,min=1,max=80"`
+	Description string `json:"description" validate:"max=512"`
+}
+
+// UpdateResourceRequest holds the fields that can be changed on an existing
+// resource. Fields left empty are kept unchanged.
+type UpdateResourceRequest struct {
+	Name        string `json:"name" validate:"max=80"`
+	Description string `json:"description" validate:"max=512"`
+}
+
+type ResourceResponse struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type DefaultResourceService struct {
+	ResourceRepo ResourceRepository
+	Validate     *validator.Validate
+}
+
+func NewResourceService(resourceRepo ResourceRepository, validate *validator.Validate) *DefaultResourceService {
+	return &DefaultResourceService{ResourceRepo: resourceRepo, Validate: validate}
+}
+
+func (r *DefaultResourceService) GetResources() ([]*ResourceResponse, apierror.ErrorResponse) {
+	resources, err := r.ResourceRepo.FindAll()
+	if err != nil {
+		log.Errorf("failed to fetch all resources: %v", err)
+		return nil, apierror.InternalServerError
+	}
+
+	resp := make([]*ResourceResponse, len(resources))
+	for i, resource := range resources {
+		resp[i] = toResourceResponse(resource)
+	}
+	return resp, nil
+}
+
+func (r *DefaultResourceService) GetResource(id int) (*ResourceResponse, apierror.ErrorResponse) {
+	resource, apierr := r.fetchResource(id)
+	if apierr != nil {
+		return nil, apierr
+	}
+	return toResourceResponse(resource), nil
+}
+
+func (r *DefaultResourceService) CreateResource(req *ResourceRequest, caller *entity.User) (*ResourceResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.ResourcesManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := r.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	now := utils.NowUTC()
+	resource := &entity.Resource{
+		Name:        req.Name,
+		Description: req.Description,
+		IsDeleted:   false,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err := r.ResourceRepo.Save(resource)
+	if err != nil {
+		log.Errorf("failed to save resource: %v", err)
+		return nil, apierror.InternalServerError
+	}
+	return toResourceResponse(resource), nil
+}
+
+func (r *DefaultResourceService) UpdateResource(id int, req *UpdateResourceRequest, caller *entity.User) (*ResourceResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.ResourcesManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := r.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	if req.Name == "" && req.Description == "" {
+		return nil, apierror.NothingToUpdateError
+	}
+
+	resource, apierr := r.fetchResource(id)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if req.Name != "" {
+		resource.Name = req.Name
+	}
+
+	if req.Description != "" {
+		resource.Description = req.Description
+	}
+
+	resource.UpdatedAt = utils.NowUTC()
+	err := r.ResourceRepo.Save(resource)
+	if err != nil {
+		log.Errorf("failed to update resource by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+	return toResourceResponse(resource), nil
+}
+
+// DeleteResource marks the resource as deleted, so it can no longer be booked.
+// Its existing appointments are kept untouched.
+func (r *DefaultResourceService) DeleteResource(id int, caller *entity.User) apierror.ErrorResponse {
+	if apierr := authorize(caller, authz.ResourcesManage); apierr != nil {
+		return apierr
+	}
+
+	resource, apierr := r.fetchResource(id)
+	if apierr != nil {
+		return apierr
+	}
+
+	resource.IsDeleted = true
+	resource.UpdatedAt = utils.NowUTC()
+	err := r.ResourceRepo.Save(resource)
+	if err != nil {
+		log.Errorf("failed to delete resource by id %d: %v", id, err)
+		return apierror.InternalServerError
+	}
+	return nil
+}
+
+func (r *DefaultResourceService) fetchResource(id int) (*entity.Resource, apierror.ErrorResponse) {
+	resource, err := r.ResourceRepo.FindByID(id)
+	if err != nil {
+		log.Errorf("failed to fetch resource by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if resource == nil || resource.IsDeleted {
+		return nil, apierror.NotFoundError
+	}
+	return resource, nil
+}
+
+func toResourceResponse(resource *entity.Resource) *ResourceResponse {
+	return &ResourceResponse{
+		ID:          resource.ID,
+		Name:        resource.Name,
+		Description: resource.Description,
+		CreatedAt:   utils.FormatEpoch(resource.CreatedAt),
+		UpdatedAt:   utils.FormatEpoch(resource.UpdatedAt),
+	}
+}
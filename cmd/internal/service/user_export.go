@@ -0,0 +1,156 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"sort"
+	"strconv"
+
+	"github.com/labstack/gommon/log"
+)
+
+// UserExport holds everything we keep about a user, to answer data access requests.
+type UserExport struct {
+	ExportedAt   string                 `json:"exported_at"`
+	User         *UserRecord            `json:"user"`
+	Appointments []*AppointmentResponse `json:"appointments"` // Including cancelled ones
+	Series       []*SeriesRecord        `json:"series"`
+}
+
+// UserRecord is the full user row, unlike UserResponse.
+type UserRecord struct {
+	ID                 int                 `json:"id"`
+	Sub                string              `json:"sub"`
+	Username           string              `json:"username"`
+	Email              string              `json:"email"`
+	EmailVerified      bool                `json:"email_verified"`
+	Role               string              `json:"role"`
+	Permissions        []string            `json:"permissions"`
+	GrantedPermissions []*PermissionRecord `json:"granted_permissions"`
+	CreatedAt          string              `json:"created_at"`
+	UpdatedAt          string              `json:"updated_at"`
+	SignedOutAt        string              `json:"signed_out_at,omitempty"`
+}
+
+type PermissionRecord struct {
+	Permission string `json:"permission"`
+	GrantedBy  int    `json:"granted_by"`
+	GrantedAt  string `json:"granted_at"`
+}
+
+// SeriesRecord is the recurrence rule of a series the user's appointments belong to.
+type SeriesRecord struct {
+	ID         int    `json:"id"`
+	ResourceID int    `json:"resource_id"`
+	Frequency  string `json:"frequency"`
+	Interval   int    `json:"interval"`
+	Count      int    `json:"count,omitempty"`
+	Until      string `json:"until,omitempty"`
+	Weekdays   string `json:"weekdays,omitempty"`
+	IsDeleted  bool   `json:"is_deleted"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// ExportUser gathers the record of a user and all their appointments. Users can export
+// their own data, while exporting anyone else's requires authz.UsersManage.
+func (u *DefaultUserService) ExportUser(rawId string, caller *entity.User) (*UserExport, apierror.ErrorResponse) {
+	if rawId != "@me" && rawId != strconv.Itoa(caller.ID) {
+		if apierr := authorize(caller, authz.UsersManage); apierr != nil {
+			return nil, apierr
+		}
+	}
+
+	user, apierr := u.fetchUser(rawId, caller)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user == nil {
+		return nil, apierror.NotFoundError
+	}
+
+	appts, err := u.AppointmentRepo.FindByUserID(user.ID, true)
+	if err != nil {
+		log.Errorf("failed to find appointments of user (%d): %v", user.ID, err)
+		return nil, apierror.InternalServerError
+	}
+
+	export := &UserExport{
+		ExportedAt:   utils.FormatEpoch(utils.NowUTC()),
+		User:         toUserRecord(user),
+		Appointments: make([]*AppointmentResponse, len(appts)),
+		Series:       []*SeriesRecord{},
+	}
+
+	seen := make(map[int]bool)
+	for i, appt := range appts {
+		export.Appointments[i] = toAppointmentResponse(appt)
+		if appt.SeriesID == 0 || seen[appt.SeriesID] {
+			continue
+		}
+		seen[appt.SeriesID] = true
+
+		series, err := u.AppointmentRepo.FindSeriesByID(appt.SeriesID)
+		if err != nil {
+			log.Errorf("failed to fetch series by id %d: %v", appt.SeriesID, err)
+			return nil, apierror.InternalServerError
+		}
+
+		if series != nil {
+			export.Series = append(export.Series, toSeriesRecord(series))
+		}
+	}
+
+	sort.Slice(export.Series, func(i, j int) bool { return export.Series[i].ID < export.Series[j].ID })
+	return export, nil
+}
+
+func toUserRecord(user *entity.User) *UserRecord {
+	record := &UserRecord{
+		ID:                 user.ID,
+		Sub:                user.SubUUID,
+		Username:           user.Username,
+		Email:              user.Email,
+		EmailVerified:      user.EmailVerified,
+		Role:               user.Role,
+		Permissions:        authz.Effective(user),
+		GrantedPermissions: make([]*PermissionRecord, len(user.Permissions)),
+		CreatedAt:          utils.FormatEpoch(user.CreatedAt),
+		UpdatedAt:          utils.FormatEpoch(user.UpdatedAt),
+	}
+
+	if user.SignedOutAt != 0 {
+		record.SignedOutAt = utils.FormatEpoch(user.SignedOutAt)
+	}
+
+	for i, granted := range user.Permissions {
+		record.GrantedPermissions[i] = &PermissionRecord{
+			Permission: granted.Permission,
+			GrantedBy:  granted.GrantedBy,
+			GrantedAt:  utils.FormatEpoch(granted.CreatedAt),
+		}
+	}
+	return record
+}
+
+func toSeriesRecord(series *entity.AppointmentSeries) *SeriesRecord {
+	record := &SeriesRecord{
+		ID:         series.ID,
+		ResourceID: series.ResourceID,
+		Frequency:  series.Frequency,
+		Interval:   series.Interval,
+		Count:      series.Count,
+		Weekdays:   series.Weekdays,
+		IsDeleted:  series.IsDeleted,
+		CreatedAt:  utils.FormatEpoch(series.CreatedAt),
+		UpdatedAt:  utils.FormatEpoch(series.UpdatedAt),
+	}
+
+	if series.Until != 0 {
+		record.Until = utils.FormatEpoch(series.Until)
+	}
+	return record
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils/apierror"
+	"testing"
+)
+
+func TestExportUser(t *testing.T) {
+	admin := &entity.User{ID: 9, SubUUID: "sub-9", Role: authz.RoleAdmin}
+
+	tests := []struct {
+		name   string
+		rawId  string
+		caller *entity.User
+		want   apierror.ErrorResponse
+	}{
+		{name: "own data", rawId: "@me", caller: member},
+		{name: "own data by ID", rawId: "1", caller: member},
+		{name: "someone else's data", rawId: "2", caller: member, want: apierror.ForbiddenError},
+		{name: "staff", rawId: "1", caller: staff, want: apierror.ForbiddenError},
+		{name: "admin", rawId: "1", caller: admin},
+		{name: "unknown user", rawId: "42", caller: admin, want: apierror.NotFoundError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, _ := newTestUserService(member, other, staff, admin)
+
+			cancelled := existing(2, member, tomorrow(1), true)
+			cancelled.SeriesID = 1
+			svc.AppointmentRepo = &fakeAppointmentRepo{
+				appts: []*entity.Appointment{
+					existing(1, member, tomorrow(0), false),
+					cancelled,
+					existing(3, other, tomorrow(2), false),
+				},
+				series: []*entity.AppointmentSeries{{ID: 1, UserID: member.ID, Frequency: "weekly", Interval: 1, Count: 2}},
+			}
+
+			export, got := svc.ExportUser(tt.rawId, tt.caller)
+			if got != tt.want {
+				t.Fatalf("ExportUser() = %v, want %v", got, tt.want)
+			}
+
+			if tt.want != nil {
+				return
+			}
+
+			if export.User.ID != member.ID || len(export.Appointments) != 2 || len(export.Series) != 1 {
+				t.Errorf("unexpected export: user %d, %d appointments, %d series", export.User.ID, len(export.Appointments), len(export.Series))
+			}
+
+			if !export.Appointments[1].IsDeleted {
+				t.Error("expected cancelled appointments to be exported")
+			}
+		})
+	}
+}
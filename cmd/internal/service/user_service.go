@@ -1,18 +1,31 @@
 package service
 
 import (
+	"4shure/cmd/internal/authz"
 	"4shure/cmd/internal/domain/entity"
 	cognitoclient "4shure/cmd/internal/integration/aws/cognito"
 	"4shure/cmd/internal/utils"
 	"4shure/cmd/internal/utils/apierror"
 	"errors"
+	"fmt"
 	"github.com/aws/smithy-go"
 	"github.com/go-playground/validator/v10"
 	"strconv"
+	"time"
 
 	"github.com/labstack/gommon/log"
 )
 
+// accountDeletedReason is the cancel reason of appointments cancelled by DeleteAccount.
+const accountDeletedReason = "Account deleted"
+
+// signupCleanupDelay is how long CreateUser has to save a new user in our database
+// before their Cognito user is deleted.
+const signupCleanupDelay = 5 * time.Minute
+
+// resendCodeInterval is how long users wait before asking for another confirmation code.
+const resendCodeInterval = time.Minute
+
 type UserRepository interface {
 	FindByID(id int) (*entity.User, error)
 	FindBySub(sub string) (*entity.User, error)
@@ -20,6 +33,9 @@ type UserRepository interface {
 	FindByEmail(email string) (*entity.User, error)
 	ExistsByEmail(email string) (bool, error)
 	Save(user *entity.User) error
+	GrantPermission(permission *entity.UserPermission) error
+	RevokePermission(userID int, permission string) (bool, error)
+	Anonymise(user *entity.User) error
 }
 
 type CreateUserRequest struct {
@@ -38,30 +54,117 @@ type ConfirmSignupRequest struct {
 	Code  string `json:"code" validate:"required,min=1,max=6"`
 }
 
+type ResendCodeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Code     string `json:"code" validate:"required,min=1,max=6"`
+	Password string `json:"password" validate:"required,min=8,max=64,hasspecial,hasdigit,hasupper,haslower"`
+}
+
+// ChangePasswordRequest carries the access token of the caller, like LogoutRequest.
+type ChangePasswordRequest struct {
+	AccessToken      string `json:"access_token"`
+	PreviousPassword string `json:"previous_password" validate:"required,min=8,max=64"`
+	ProposedPassword string `json:"proposed_password" validate:"required,min=8,max=64,hasspecial,hasdigit,hasupper,haslower,nefield=PreviousPassword"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest carries the access token to revoke. It defaults to the request's own token,
+// which has to be an access token then (ID tokens cannot be used to sign out).
+type LogoutRequest struct {
+	AccessToken string `json:"access_token"`
+
+	// RefreshToken is revoked before signing out, see DefaultUserService.Logout.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// UpdateProfileRequest changes the given fields only. Changing the e-mail requires
+// the access token of the caller (like LogoutRequest), and verifying the new address.
+type UpdateProfileRequest struct {
+	Username    string `json:"username" validate:"omitempty,min=2,max=80"`
+	Email       string `json:"email" validate:"omitempty,email"`
+	AccessToken string `json:"access_token"`
+}
+
+type VerifyEmailRequest struct {
+	Code        string `json:"code" validate:"required,min=1,max=6"`
+	AccessToken string `json:"access_token"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=member staff admin"`
+}
+
+type GrantPermissionRequest struct {
+	Permission string `json:"permission" validate:"required"`
+}
+
 type UserResponse struct {
-	ID        int    `json:"id"`
-	Username  string `json:"username"`
-	IsAdmin   bool   `json:"is_admin"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID          int      `json:"id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+
+	// Contact details are only shown to the user themselves, and to those who can read users.
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
 }
 
 type UserLoginResponse struct {
-	AccessToken string `json:"access_token"`
-	IDToken     string `json:"id_token"`
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 type DefaultUserService struct {
-	UserRepo UserRepository
-	Validate *validator.Validate
-	Cognito  cognitoclient.CognitoInterface
+	UserRepo        UserRepository
+	AppointmentRepo AppointmentRepository
+	Validate        *validator.Validate
+	Cognito         cognitoclient.CognitoInterface
+
+	// ResendThrottle limits how often confirmation codes are sent to each e-mail.
+	ResendThrottle *utils.Throttle
+
+	// ParseToken verifies the access tokens given to Logout and ChangePassword.
+	ParseToken func(token string) (*utils.TokenData, error)
+
+	// Tx saves changes along with their side effects (e.g. Cognito calls), see Transactor.
+	Tx Transactor
+
+	// Calendar is told about the slots freed by deleted accounts.
+	Calendar CalendarPublisher
 }
 
-func NewUserService(userRepo UserRepository, validate *validator.Validate, cogClient cognitoclient.CognitoInterface) *DefaultUserService {
-	return &DefaultUserService{UserRepo: userRepo, Validate: validate, Cognito: cogClient}
+func NewUserService(userRepo UserRepository, apptRepo AppointmentRepository, validate *validator.Validate, cogClient cognitoclient.CognitoInterface, tx Transactor, calendar CalendarPublisher) *DefaultUserService {
+	return &DefaultUserService{
+		UserRepo:        userRepo,
+		AppointmentRepo: apptRepo,
+		Validate:        validate,
+		Cognito:         cogClient,
+		Tx:              tx,
+		Calendar:        calendar,
+		ResendThrottle:  utils.NewThrottle(resendCodeInterval),
+		ParseToken:      utils.ParseTokenData,
+	}
 }
 
-func (u *DefaultUserService) GetUsers() ([]*UserResponse, apierror.ErrorResponse) {
+func (u *DefaultUserService) GetUsers(caller *entity.User) ([]*UserResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.UsersRead); apierr != nil {
+		return nil, apierr
+	}
+
 	users, err := u.UserRepo.FindAll()
 	if err != nil {
 		log.Errorf("failed to fetch all users: %v", err)
@@ -70,13 +173,13 @@ func (u *DefaultUserService) GetUsers() ([]*UserResponse, apierror.ErrorResponse
 
 	resp := make([]*UserResponse, len(users))
 	for i, user := range users {
-		resp[i] = toUserResponse(user)
+		resp[i] = toUserResponse(user, caller)
 	}
 	return resp, nil
 }
 
-func (u *DefaultUserService) GetUser(rawId, subId string) (*UserResponse, apierror.ErrorResponse) {
-	user, apierr := u.fetchUser(rawId, subId)
+func (u *DefaultUserService) GetUser(rawId string, caller *entity.User) (*UserResponse, apierror.ErrorResponse) {
+	user, apierr := u.fetchUser(rawId, caller)
 	if apierr != nil {
 		return nil, apierr
 	}
@@ -85,12 +188,15 @@ func (u *DefaultUserService) GetUser(rawId, subId string) (*UserResponse, apierr
 		return nil, apierror.NotFoundError
 	}
 
-	resp := toUserResponse(user)
+	resp := toUserResponse(user, caller)
 	return resp, nil
 }
 
 // CreateUser creates a new user on Cognito (as well as in our database),
 // and sends a verification code to the user's email address.
+//
+// The Cognito user is deleted later on (see SignupCleanupHandler) unless it is saved in our
+// database, so that failures (or crashes) in between do not leave users behind on Cognito.
 func (u *DefaultUserService) CreateUser(req *CreateUserRequest) apierror.ErrorResponse {
 	utils.Sanitize(req)
 	if err := u.Validate.Struct(req); err != nil {
@@ -107,8 +213,25 @@ func (u *DefaultUserService) CreateUser(req *CreateUserRequest) apierror.ErrorRe
 		return apierror.UserAlreadyExistsError
 	}
 
+	cleanup, err := newOutboxMessage(OutboxSignupCleanup, &identityPayload{Email: req.Email}, utils.NowUTC()+signupCleanupDelay.Milliseconds())
+	if err == nil {
+		err = u.Tx.Transaction(func(tx *TxRepositories) error {
+			return tx.Outbox.Enqueue(cleanup)
+		})
+	}
+
+	if err != nil {
+		log.Errorf("failed to schedule signup cleanup: %v", err)
+		return apierror.InternalServerError
+	}
+
 	cogUser := &cognitoclient.User{Email: req.Email, Password: req.Password}
-	uuid, apierr, revert := handleUserSignup(u.Cognito, cogUser)
+	uuid, apierr := handleUserSignup(u.Cognito, cogUser)
+	if apierr == apierror.IDPInvalidPasswordError || apierr == apierror.IDPExistingEmailError {
+		// Nothing was created on Cognito, there is nothing to clean up
+		u.cancelCleanup(cleanup)
+	}
+
 	if apierr != nil {
 		return apierr
 	}
@@ -120,22 +243,39 @@ func (u *DefaultUserService) CreateUser(req *CreateUserRequest) apierror.ErrorRe
 		Username:      req.Username,
 		Email:         req.Email,
 		EmailVerified: false,
-		IsAdmin:       false,
+		Role:          authz.RoleMember,
 		CreatedAt:     now,
 		UpdatedAt:     now,
 	}
 
-	err = u.UserRepo.Save(user)
+	err = u.Tx.Transaction(func(tx *TxRepositories) error {
+		err := tx.Users.Save(user)
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Delete(cleanup.ID)
+	})
+
 	if err != nil {
-		// Well... for our case, I have no idea how can SQLite fail here,
-		// but better safe than sorry?
-		revert()
+		// The Cognito user is cleaned up later on
 		log.Errorf("failed to create user: %v", err)
 		return apierror.InternalServerError
 	}
 	return nil
 }
 
+// cancelCleanup drops a signup cleanup that turned out to be unneeded. Should that fail,
+// the cleanup still finds nothing to delete (or a user saved in our database) later on.
+func (u *DefaultUserService) cancelCleanup(cleanup *entity.OutboxMessage) {
+	err := u.Tx.Transaction(func(tx *TxRepositories) error {
+		return tx.Outbox.Delete(cleanup.ID)
+	})
+
+	if err != nil {
+		log.Errorf("failed to cancel signup cleanup %d: %v", cleanup.ID, err)
+	}
+}
+
 func (u *DefaultUserService) Login(req *UserLoginRequest) (*UserLoginResponse, apierror.ErrorResponse) {
 	if err := u.Validate.Struct(req); err != nil {
 		return nil, apierror.FromValidationError(err)
@@ -160,7 +300,26 @@ func (u *DefaultUserService) Login(req *UserLoginRequest) (*UserLoginResponse, a
 	if apierr != nil {
 		return nil, apierr
 	}
-	return &UserLoginResponse{AccessToken: auth.AccessToken, IDToken: auth.IDToken}, nil
+	return &UserLoginResponse{AccessToken: auth.AccessToken, IDToken: auth.IDToken, RefreshToken: auth.RefreshToken}, nil
+}
+
+// RefreshTokens issues new access and ID tokens, so that users do not have to sign in again
+// once they expire. The refresh token is returned as well, rotated or not.
+func (u *DefaultUserService) RefreshTokens(req *RefreshTokenRequest) (*UserLoginResponse, apierror.ErrorResponse) {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	auth, apierr := handleTokenRefresh(u.Cognito, req.RefreshToken)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if auth.RefreshToken == "" {
+		auth.RefreshToken = req.RefreshToken
+	}
+	return &UserLoginResponse{AccessToken: auth.AccessToken, IDToken: auth.IDToken, RefreshToken: auth.RefreshToken}, nil
 }
 
 func (u *DefaultUserService) ConfirmSignup(req *ConfirmSignupRequest) apierror.ErrorResponse {
@@ -195,29 +354,467 @@ func (u *DefaultUserService) ConfirmSignup(req *ConfirmSignupRequest) apierror.E
 	now := utils.NowUTC()
 	user.EmailVerified = true
 	user.UpdatedAt = now
-	err = u.UserRepo.Save(user)
+	err = u.Tx.Transaction(func(tx *TxRepositories) error {
+		err := tx.Users.Save(user)
+		if err != nil {
+			return err
+		}
+
+		msg, err := webhookMessage(EventUserVerified, toUserResponse(user, user))
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Enqueue(msg)
+	})
+
 	if err != nil {
 		log.Errorf("failed to update user (%d) verified status: %v", user.ID, err)
 	}
 	return nil
 }
 
-func (u *DefaultUserService) fetchUser(rawId, sub string) (*entity.User, apierror.ErrorResponse) {
-	if rawId == "@me" {
-		return u.fetchBySub(sub)
+// ResendConfirmationCode sends a new confirmation code, e.g. when the previous one expired.
+// Each e-mail can only get one code per resendCodeInterval.
+func (u *DefaultUserService) ResendConfirmationCode(req *ResendCodeRequest) apierror.ErrorResponse {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return apierror.FromValidationError(err)
 	}
-	return u.fetchByID(rawId)
+
+	user, err := u.UserRepo.FindByEmail(req.Email)
+	if err != nil {
+		log.Errorf("failed to fetch user from database: %v", err)
+		return apierror.InternalServerError
+	}
+
+	if user == nil {
+		return apierror.IDPUserNotFoundError
+	}
+
+	if user.EmailVerified {
+		return apierror.UserAlreadyConfirmedError
+	}
+
+	if ok, wait := u.ResendThrottle.Allow(user.Email); !ok {
+		return apierror.NewThrottledError(wait)
+	}
+	return handleResendConfirmation(u.Cognito, user.Email)
+}
+
+// Logout signs the caller out of every session, on every device. Cognito revokes the access and
+// refresh tokens, and since tokens are verified locally, the ones issued before now are also
+// rejected by routes.Authenticate from now on.
+//
+// The given refresh token is revoked first, so that the current device is signed out
+// even if signing out of the other ones fails.
+func (u *DefaultUserService) Logout(req *LogoutRequest, caller *entity.User) apierror.ErrorResponse {
+	if apierr := u.checkAccessToken(req.AccessToken, caller); apierr != nil {
+		return apierr
+	}
+
+	if req.RefreshToken != "" {
+		if apierr := handleTokenRevocation(u.Cognito, req.RefreshToken, caller); apierr != nil {
+			return apierr
+		}
+	}
+
+	apierr := handleGlobalSignOut(u.Cognito, req.AccessToken, caller)
+	if apierr != nil {
+		return apierr
+	}
+
+	caller.SignedOutAt = utils.NowUTC()
+	caller.UpdatedAt = caller.SignedOutAt
+	err := u.UserRepo.Save(caller)
+	if err != nil {
+		log.Errorf("failed to save sign out of user (%d): %v", caller.ID, err)
+		return apierror.InternalServerError
+	}
+	return nil
 }
 
-func (u *DefaultUserService) fetchBySub(sub string) (*entity.User, apierror.ErrorResponse) {
-	user, err := u.UserRepo.FindBySub(sub)
+// ForgotPassword sends a code to reset the password of the user, see ResetPassword.
+func (u *DefaultUserService) ForgotPassword(req *ForgotPasswordRequest) apierror.ErrorResponse {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return apierror.FromValidationError(err)
+	}
+
+	user, err := u.UserRepo.FindByEmail(req.Email)
 	if err != nil {
-		log.Errorf("failed to find user (%s) by sub: %v", sub, err)
+		log.Errorf("failed to fetch user from database: %v", err)
+		return apierror.InternalServerError
+	}
+
+	if user == nil {
+		return apierror.IDPUserNotFoundError
+	}
+	return handleForgotPassword(u.Cognito, user.Email)
+}
+
+// ResetPassword sets a new password using the code sent by ForgotPassword.
+func (u *DefaultUserService) ResetPassword(req *ResetPasswordRequest) apierror.ErrorResponse {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return apierror.FromValidationError(err)
+	}
+
+	reset := &cognitoclient.PasswordReset{
+		Email:    req.Email,
+		Code:     req.Code,
+		Password: req.Password,
+	}
+	return handlePasswordReset(u.Cognito, reset)
+}
+
+// ChangePassword changes the password of the caller, who has to give their current one.
+func (u *DefaultUserService) ChangePassword(req *ChangePasswordRequest, caller *entity.User) apierror.ErrorResponse {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return apierror.FromValidationError(err)
+	}
+
+	if apierr := u.checkAccessToken(req.AccessToken, caller); apierr != nil {
+		return apierr
+	}
+
+	change := &cognitoclient.PasswordChange{
+		AccessToken:      req.AccessToken,
+		PreviousPassword: req.PreviousPassword,
+		ProposedPassword: req.ProposedPassword,
+	}
+	return handlePasswordChange(u.Cognito, change, caller)
+}
+
+// UpdateProfile changes the username and/or e-mail of the caller. A new e-mail has to be
+// verified again (see VerifyEmail), so EmailVerified is reset until then.
+func (u *DefaultUserService) UpdateProfile(req *UpdateProfileRequest, caller *entity.User) (*UserResponse, apierror.ErrorResponse) {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	if req.Username == "" && req.Email == "" {
+		return nil, apierror.NothingToUpdateError
+	}
+
+	emailChanged := req.Email != "" && req.Email != caller.Email
+	if emailChanged {
+		if apierr := u.checkAccessToken(req.AccessToken, caller); apierr != nil {
+			return nil, apierr
+		}
+
+		found, err := u.UserRepo.ExistsByEmail(req.Email)
+		if err != nil {
+			log.Errorf("failed to check if user already exists: %v", err)
+			return nil, apierror.InternalServerError
+		}
+
+		if found {
+			return nil, apierror.IDPExistingEmailError
+		}
+	}
+
+	// Cognito goes first: our row only points at an e-mail Cognito accepted, or users
+	// could no longer log in with the e-mail Cognito still has.
+	if emailChanged {
+		apierr := handleEmailUpdate(u.Cognito, req.AccessToken, req.Email, caller)
+		if apierr != nil {
+			return nil, apierr
+		}
+	}
+
+	updated := *caller
+	if req.Username != "" {
+		updated.Username = req.Username
+	}
+
+	if emailChanged {
+		updated.Email = req.Email
+		updated.EmailVerified = false
+	}
+
+	updated.UpdatedAt = utils.NowUTC()
+	err := u.UserRepo.Save(&updated)
+	if err != nil {
+		log.Errorf("failed to update profile of user (%d): %v", caller.ID, err)
 		return nil, apierror.InternalServerError
 	}
+
+	*caller = updated
+	return toUserResponse(caller, caller), nil
+}
+
+// VerifyEmail verifies the new e-mail of the caller with the code sent by UpdateProfile,
+// letting webhooks know about it.
+func (u *DefaultUserService) VerifyEmail(req *VerifyEmailRequest, caller *entity.User) apierror.ErrorResponse {
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return apierror.FromValidationError(err)
+	}
+
+	if caller.EmailVerified {
+		return apierror.UserAlreadyConfirmedError
+	}
+
+	if apierr := u.checkAccessToken(req.AccessToken, caller); apierr != nil {
+		return apierr
+	}
+
+	apierr := handleEmailVerification(u.Cognito, req.AccessToken, req.Code, caller)
+	if apierr != nil {
+		return apierr
+	}
+
+	caller.EmailVerified = true
+	caller.UpdatedAt = utils.NowUTC()
+	err := u.Tx.Transaction(func(tx *TxRepositories) error {
+		err := tx.Users.Save(caller)
+		if err != nil {
+			return err
+		}
+
+		msg, err := webhookMessage(EventUserVerified, toUserResponse(caller, caller))
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Enqueue(msg)
+	})
+
+	if err != nil {
+		log.Errorf("failed to update user (%d) verified status: %v", caller.ID, err)
+		return apierror.InternalServerError
+	}
+	return nil
+}
+
+// DeleteAccount deletes the account of the caller. Their upcoming appointments are cancelled,
+// their Cognito user is deleted (in the background), and their row is anonymised rather than
+// deleted, so that the history of past appointments stays consistent.
+func (u *DefaultUserService) DeleteAccount(caller *entity.User) apierror.ErrorResponse {
+	err := closeAccount(u.AppointmentRepo, u.Tx, u.Calendar, caller, true)
+	if err != nil {
+		log.Errorf("failed to delete account of user (%d): %v", caller.ID, err)
+		return apierror.InternalServerError
+	}
+	return nil
+}
+
+// closeAccount cancels the upcoming appointments of the user and anonymises them, all at once.
+// Their Cognito user is deleted as well (in the background) when deleteIdentity is set. The
+// calendar is told about the slots freed once done. Without a calendar, e.g. outside of the
+// API, the freed slots go through the outbox instead, for the API to publish them.
+func closeAccount(apptRepo AppointmentRepository, transactor Transactor, calendar CalendarPublisher, user *entity.User, deleteIdentity bool) error {
+	appts, err := apptRepo.FindByUserID(user.ID, false)
+	if err != nil {
+		return fmt.Errorf("failed to find appointments: %w", err)
+	}
+
+	now := utils.NowUTC()
+	var upcoming []*entity.Appointment
+	for _, appt := range appts {
+		if !isFuture(appt.BeginsAt) {
+			continue
+		}
+
+		appt.IsDeleted = true
+		appt.CancelledBy = user.ID
+		appt.CancelledAt = now
+		appt.CancelReason = accountDeletedReason
+		appt.UpdatedAt = now
+		upcoming = append(upcoming, appt)
+	}
+
+	var msgs []*entity.OutboxMessage
+	if deleteIdentity {
+		deletion, err := newOutboxMessage(OutboxDeleteIdentity, &identityPayload{Email: user.Email}, now)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, deletion)
+	}
+
+	for _, appt := range upcoming {
+		msg, err := webhookMessage(EventAppointmentCancelled, toAppointmentResponse(appt))
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if calendar == nil && len(upcoming) > 0 {
+		msg, err := calendarMessage(SlotFreed, upcoming)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	user.SubUUID = ""
+	user.Username = "Deleted user"
+	user.Email = ""
+	user.EmailVerified = false
+	user.Role = authz.RoleMember
+	user.SignedOutAt = now
+	user.IsDeleted = true
+	user.UpdatedAt = now
+	err = transactor.Transaction(func(tx *TxRepositories) error {
+		if len(upcoming) > 0 {
+			err := tx.Appointments.Cancel(upcoming)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Users.Anonymise(user)
+		if err != nil {
+			return err
+		}
+		return tx.Outbox.Enqueue(msgs...)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if calendar != nil {
+		calendar.Publish(slotEvents(SlotFreed, upcoming...)...)
+	}
+	return nil
+}
+
+// SetRole changes the role of a user. Users cannot change their own role,
+// so that nobody locks themselves out by mistake.
+func (u *DefaultUserService) SetRole(rawId string, req *SetRoleRequest, caller *entity.User) (*UserResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.UsersManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	user, apierr := u.requireUser(rawId)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user.ID == caller.ID {
+		return nil, apierror.OwnRoleError
+	}
+
+	user.Role = req.Role
+	user.UpdatedAt = utils.NowUTC()
+	err := u.UserRepo.Save(user)
+	if err != nil {
+		log.Errorf("failed to update user (%d) role: %v", user.ID, err)
+		return nil, apierror.InternalServerError
+	}
+	return toUserResponse(user, caller), nil
+}
+
+// GrantPermission grants a permission to a user, on top of the ones that come with their role.
+// Granting a permission twice has no effect.
+func (u *DefaultUserService) GrantPermission(rawId string, req *GrantPermissionRequest, caller *entity.User) (*UserResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.UsersManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := u.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	if !authz.IsPermission(req.Permission) {
+		return nil, apierror.UnknownPermissionError
+	}
+
+	user, apierr := u.requireUser(rawId)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	for _, granted := range user.Permissions {
+		if granted.Permission == req.Permission {
+			return toUserResponse(user, caller), nil
+		}
+	}
+
+	permission := entity.UserPermission{
+		UserID:     user.ID,
+		Permission: req.Permission,
+		GrantedBy:  caller.ID,
+		CreatedAt:  utils.NowUTC(),
+	}
+
+	err := u.UserRepo.GrantPermission(&permission)
+	if err != nil {
+		log.Errorf("failed to grant %s to user (%d): %v", req.Permission, user.ID, err)
+		return nil, apierror.InternalServerError
+	}
+
+	user.Permissions = append(user.Permissions, permission)
+	return toUserResponse(user, caller), nil
+}
+
+// RevokePermission revokes a permission granted to a user. Permissions that come
+// with the user's role can only be taken away by changing their role.
+func (u *DefaultUserService) RevokePermission(rawId, permission string, caller *entity.User) apierror.ErrorResponse {
+	if apierr := authorize(caller, authz.UsersManage); apierr != nil {
+		return apierr
+	}
+
+	user, apierr := u.requireUser(rawId)
+	if apierr != nil {
+		return apierr
+	}
+
+	revoked, err := u.UserRepo.RevokePermission(user.ID, permission)
+	if err != nil {
+		log.Errorf("failed to revoke %s from user (%d): %v", permission, user.ID, err)
+		return apierror.InternalServerError
+	}
+
+	if !revoked {
+		return apierror.PermissionNotGrantedError
+	}
+	return nil
+}
+
+// checkAccessToken makes sure the token is a valid access token of the caller.
+// Unlike ID tokens, access tokens can be used to act on the user's Cognito account.
+func (u *DefaultUserService) checkAccessToken(token string, caller *entity.User) apierror.ErrorResponse {
+	data, err := u.ParseToken(token)
+	if err != nil || data.TokenUse != "access" {
+		return apierror.AccessTokenRequiredError
+	}
+
+	if data.Sub != caller.SubUUID {
+		return apierror.ForbiddenError
+	}
+	return nil
+}
+
+func (u *DefaultUserService) requireUser(rawId string) (*entity.User, apierror.ErrorResponse) {
+	user, apierr := u.fetchByID(rawId)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if user == nil {
+		return nil, apierror.NotFoundError
+	}
 	return user, nil
 }
 
+func (u *DefaultUserService) fetchUser(rawId string, caller *entity.User) (*entity.User, apierror.ErrorResponse) {
+	if rawId == "@me" {
+		return caller, nil
+	}
+	return u.fetchByID(rawId)
+}
+
 func (u *DefaultUserService) fetchByID(rawId string) (*entity.User, apierror.ErrorResponse) {
 	userId, err := strconv.Atoi(rawId)
 	if err != nil {
@@ -228,34 +825,43 @@ func (u *DefaultUserService) fetchByID(rawId string) (*entity.User, apierror.Err
 		log.Errorf("failed to find user (%s) by id: %v", rawId, err)
 		return nil, apierror.InternalServerError
 	}
+
+	// Deleted users are only kept, anonymised, for the history of their appointments
+	if user != nil && user.IsDeleted {
+		return nil, nil
+	}
 	return user, nil
 }
 
-func handleUserSignup(cogClient cognitoclient.CognitoInterface, req *cognitoclient.User) (string, apierror.ErrorResponse, func()) {
-	revert := func() {
-		_ = cogClient.AdminDeleteUser(req.Email)
+// authorize makes sure the caller has the given permission.
+func authorize(caller *entity.User, permission authz.Permission) apierror.ErrorResponse {
+	if !authz.Can(caller, permission) {
+		return apierror.ForbiddenError
 	}
+	return nil
+}
 
+func handleUserSignup(cogClient cognitoclient.CognitoInterface, req *cognitoclient.User) (string, apierror.ErrorResponse) {
 	uuid, err := cogClient.SignUp(req)
 	if err == nil {
-		return uuid, nil, revert
+		return uuid, nil
 	}
 
 	var apiErr smithy.APIError
 	if errors.As(err, &apiErr) {
 		switch apiErr.ErrorCode() {
 		case "InvalidPasswordException":
-			return "", apierror.IDPInvalidPasswordError, revert
+			return "", apierror.IDPInvalidPasswordError
 		case "UsernameExistsException":
-			return "", apierror.IDPExistingEmailError, revert
+			return "", apierror.IDPExistingEmailError
 		default:
 			log.Errorf("signup failed for user (%s): %s - %s", req.Email, apiErr.ErrorCode(), apiErr.ErrorMessage())
-			return "", apierror.InternalServerError, revert
+			return "", apierror.InternalServerError
 		}
 	}
 
 	log.Errorf("failed to signup user (%s): %v", req.Email, err)
-	return "", apierror.InternalServerError, revert
+	return "", apierror.InternalServerError
 }
 
 func handleUserSignin(cogClient cognitoclient.CognitoInterface, req *cognitoclient.UserLogin) (*cognitoclient.AuthCreate, apierror.ErrorResponse) {
@@ -283,6 +889,193 @@ func handleUserSignin(cogClient cognitoclient.CognitoInterface, req *cognitoclie
 	return nil, apierror.InternalServerError
 }
 
+func handleForgotPassword(cogClient cognitoclient.CognitoInterface, email string) apierror.ErrorResponse {
+	err := cogClient.ForgotPassword(email)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "UserNotFoundException":
+			return apierror.IDPUserNotFoundError
+		case "InvalidParameterException":
+			return apierror.IDPUserNotConfirmedError
+		case "LimitExceededException":
+			return apierror.IDPCodeLimitExceededError
+		case "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		case "CodeDeliveryFailureException":
+			return apierror.IDPCodeDeliveryError
+		default:
+			log.Errorf("forgot password failed for user (%s): %s - %s", email, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to send password reset code to user (%s): %v", email, err)
+	return apierror.InternalServerError
+}
+
+func handlePasswordReset(cogClient cognitoclient.CognitoInterface, req *cognitoclient.PasswordReset) apierror.ErrorResponse {
+	err := cogClient.ConfirmForgotPassword(req)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "CodeMismatchException":
+			return apierror.IDPConfirmCodeMismatchError
+		case "ExpiredCodeException":
+			return apierror.IDPConfirmCodeExpiredError
+		case "InvalidPasswordException":
+			return apierror.IDPInvalidPasswordError
+		case "UserNotFoundException":
+			return apierror.IDPUserNotFoundError
+		case "LimitExceededException", "TooManyFailedAttemptsException", "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("password reset failed for user (%s): %s - %s", req.Email, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to reset password of user (%s): %v", req.Email, err)
+	return apierror.InternalServerError
+}
+
+func handlePasswordChange(cogClient cognitoclient.CognitoInterface, req *cognitoclient.PasswordChange, user *entity.User) apierror.ErrorResponse {
+	err := cogClient.ChangePassword(req)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotAuthorizedException":
+			return apierror.IDPCredentialsMismatchError
+		case "InvalidPasswordException":
+			return apierror.IDPInvalidPasswordError
+		case "LimitExceededException", "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("password change failed for user (%d): %s - %s", user.ID, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to change password of user (%d): %v", user.ID, err)
+	return apierror.InternalServerError
+}
+
+func handleEmailUpdate(cogClient cognitoclient.CognitoInterface, accessToken, email string, user *entity.User) apierror.ErrorResponse {
+	err := cogClient.UpdateEmail(accessToken, email)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "AliasExistsException":
+			return apierror.IDPExistingEmailError
+		case "NotAuthorizedException":
+			return apierror.InvalidAuthTokenError
+		case "CodeDeliveryFailureException":
+			return apierror.IDPCodeDeliveryError
+		case "LimitExceededException", "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("email update failed for user (%d): %s - %s", user.ID, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to update email of user (%d): %v", user.ID, err)
+	return apierror.InternalServerError
+}
+
+func handleEmailVerification(cogClient cognitoclient.CognitoInterface, accessToken, code string, user *entity.User) apierror.ErrorResponse {
+	err := cogClient.VerifyEmail(accessToken, code)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "CodeMismatchException":
+			return apierror.IDPConfirmCodeMismatchError
+		case "ExpiredCodeException":
+			return apierror.IDPConfirmCodeExpiredError
+		case "NotAuthorizedException":
+			return apierror.InvalidAuthTokenError
+		case "LimitExceededException", "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("email verification failed for user (%d): %s - %s", user.ID, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to verify email of user (%d): %v", user.ID, err)
+	return apierror.InternalServerError
+}
+
+func handleTokenRefresh(cogClient cognitoclient.CognitoInterface, refreshToken string) (*cognitoclient.AuthCreate, apierror.ErrorResponse) {
+	auth, err := cogClient.RefreshTokens(refreshToken)
+	if err == nil {
+		return auth, nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotAuthorizedException":
+			return nil, apierror.InvalidRefreshTokenError
+		case "UserNotFoundException":
+			return nil, apierror.IDPUserNotFoundError
+		case "UserNotConfirmedException":
+			return nil, apierror.IDPUserNotConfirmedError
+		case "TooManyRequestsException":
+			return nil, apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("token refresh failed: %s - %s", apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return nil, apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to refresh tokens: %v", err)
+	return nil, apierror.InternalServerError
+}
+
+func handleTokenRevocation(cogClient cognitoclient.CognitoInterface, refreshToken string, user *entity.User) apierror.ErrorResponse {
+	err := cogClient.RevokeToken(refreshToken)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "UnauthorizedException", "UnsupportedTokenTypeException", "InvalidParameterException":
+			return apierror.InvalidRefreshTokenError
+		case "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("token revocation failed for user (%d): %s - %s", user.ID, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to revoke token of user (%d): %v", user.ID, err)
+	return apierror.InternalServerError
+}
+
 func handleSignupConfirmation(cogClient cognitoclient.CognitoInterface, req *cognitoclient.UserConfirmation) apierror.ErrorResponse {
 	err := cogClient.ConfirmAccount(req)
 	if err == nil {
@@ -308,12 +1101,76 @@ func handleSignupConfirmation(cogClient cognitoclient.CognitoInterface, req *cog
 	return apierror.InternalServerError
 }
 
-func toUserResponse(user *entity.User) *UserResponse {
-	return &UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		IsAdmin:   user.IsAdmin,
-		CreatedAt: utils.FormatEpoch(user.CreatedAt),
-		UpdatedAt: utils.FormatEpoch(user.UpdatedAt),
+func handleResendConfirmation(cogClient cognitoclient.CognitoInterface, email string) apierror.ErrorResponse {
+	err := cogClient.ResendConfirmation(email)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "UserNotFoundException":
+			return apierror.IDPUserNotFoundError
+		case "InvalidParameterException":
+			return apierror.UserAlreadyConfirmedError
+		case "LimitExceededException":
+			return apierror.IDPCodeLimitExceededError
+		case "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		case "CodeDeliveryFailureException":
+			return apierror.IDPCodeDeliveryError
+		default:
+			log.Errorf("resending code failed for user (%s): %s - %s", email, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to resend code to user (%s): %v", email, err)
+	return apierror.InternalServerError
+}
+
+// handleGlobalSignOut revokes the user's tokens on Cognito. A token Cognito already
+// revoked means the user is signed out there, so it is not reported as an error.
+func handleGlobalSignOut(cogClient cognitoclient.CognitoInterface, accessToken string, user *entity.User) apierror.ErrorResponse {
+	err := cogClient.GlobalSignOut(accessToken)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotAuthorizedException":
+			return nil
+		case "UserNotFoundException":
+			return apierror.IDPUserNotFoundError
+		case "TooManyRequestsException":
+			return apierror.IDPTooManyRequestsError
+		default:
+			log.Errorf("sign out failed for user (%d): %s - %s", user.ID, apiErr.ErrorCode(), apiErr.ErrorMessage())
+			return apierror.InternalServerError
+		}
+	}
+
+	log.Errorf("failed to sign out user (%d): %v", user.ID, err)
+	return apierror.InternalServerError
+}
+
+func toUserResponse(user, caller *entity.User) *UserResponse {
+	resp := &UserResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Role:        user.Role,
+		Permissions: authz.Effective(user),
+		CreatedAt:   utils.FormatEpoch(user.CreatedAt),
+		UpdatedAt:   utils.FormatEpoch(user.UpdatedAt),
+	}
+
+	if user.ID == caller.ID || authz.Can(caller, authz.UsersRead) {
+		verified := user.EmailVerified
+		resp.Email = user.Email
+		resp.EmailVerified = &verified
 	}
+	return resp
 }
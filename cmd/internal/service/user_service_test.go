@@ -0,0 +1,605 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/integration/aws/cognito/cognitotest"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "Passw0rd!"
+
+func newTestUserService(users ...*entity.User) (*DefaultUserService, *fakeUserRepo, *cognitotest.Fake) {
+	repo := &fakeUserRepo{users: users}
+	apptRepo := &fakeAppointmentRepo{}
+	cognito := cognitotest.New()
+	tx := &fakeTransactor{repos: &TxRepositories{Users: repo, Appointments: apptRepo, Outbox: &fakeOutboxRepo{}}}
+	return NewUserService(repo, apptRepo, newTestValidator(), cognito, tx, NewCalendarBroker()), repo, cognito
+}
+
+// flushUserOutbox hands the messages queued by the service and due at the given time to their
+// handlers, and returns the webhook events published as well as the messages left.
+func flushUserOutbox(t *testing.T, svc *DefaultUserService, at time.Time) (*fakePublisher, *fakeOutboxRepo) {
+	t.Helper()
+	publisher := &fakePublisher{}
+	outbox := svc.Tx.(*fakeTransactor).repos.Outbox.(*fakeOutboxRepo)
+
+	dispatcher := NewOutboxDispatcher(outbox, &OutboxConfig{MaxAttempts: 3, RetryDelay: time.Minute, MaxRetryDelay: time.Hour})
+	dispatcher.Handle(OutboxWebhookEvent, WebhookHandler(publisher))
+	dispatcher.Handle(OutboxDeleteIdentity, DeleteIdentityHandler(svc.Cognito))
+	dispatcher.Handle(OutboxSignupCleanup, SignupCleanupHandler(svc.Cognito, svc.UserRepo))
+	dispatcher.DispatchDue(at.UnixMilli())
+	return publisher, outbox
+}
+
+// parseFakeToken stands in for the token verifier, for the tokens issued by cognitotest.Fake.
+func parseFakeToken(token string) (*utils.TokenData, error) {
+	for _, use := range []string{"access", "id"} {
+		if sub, ok := strings.CutPrefix(token, use+"-"); ok {
+			return &utils.TokenData{Sub: sub, TokenUse: use}, nil
+		}
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestCreateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		existing bool
+		failWith string // Error code returned by Cognito's SignUp
+		saveErr  error
+		want     apierror.ErrorResponse
+		cleanup  bool // Whether the Cognito user is cleaned up later on
+	}{
+		{name: "created", email: "new@example.com"},
+		{name: "already in database", email: "taken@example.com", existing: true, want: apierror.UserAlreadyExistsError},
+		{name: "invalid password", email: "new@example.com", failWith: "InvalidPasswordException", want: apierror.IDPInvalidPasswordError},
+		{name: "already in pool", email: "new@example.com", failWith: "UsernameExistsException", want: apierror.IDPExistingEmailError},
+		{name: "unknown Cognito error", email: "new@example.com", failWith: "TooManyRequestsException", want: apierror.InternalServerError, cleanup: true},
+		{name: "save fails", email: "new@example.com", saveErr: errFake, want: apierror.InternalServerError, cleanup: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var users []*entity.User
+			if tt.existing {
+				users = append(users, &entity.User{ID: 1, Email: tt.email})
+			}
+
+			svc, repo, cognito := newTestUserService(users...)
+			repo.saveErr = tt.saveErr
+			if tt.failWith != "" {
+				cognito.FailWith("SignUp", tt.failWith)
+			}
+
+			req := &CreateUserRequest{Username: "someone", Email: tt.email, Password: testPassword}
+			if got := svc.CreateUser(req); got != tt.want {
+				t.Fatalf("CreateUser() = %v, want %v", got, tt.want)
+			}
+
+			// Nothing is cleaned up before the delay
+			_, outbox := flushUserOutbox(t, svc, time.Now())
+			if got := len(outbox.msgs) > 0; got != tt.cleanup {
+				t.Fatalf("cleanup pending = %v, want %v", got, tt.cleanup)
+			}
+
+			// The Cognito user must not outlive a failed save
+			flushUserOutbox(t, svc, time.Now().Add(signupCleanupDelay))
+			if len(outbox.msgs) != 0 {
+				t.Errorf("unexpected outbox messages left %v", outbox.kinds())
+			}
+
+			if tt.cleanup && cognito.User(tt.email) != nil {
+				t.Error("expected the Cognito user to be deleted")
+			}
+
+			if tt.want == nil {
+				user, _ := repo.FindByEmail(tt.email)
+				if user == nil || user.SubUUID == "" || user.EmailVerified || user.Role != authz.RoleMember {
+					t.Errorf("unexpected saved user %+v", user)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateUserInvalidRequest(t *testing.T) {
+	svc, _, cognito := newTestUserService()
+
+	got := svc.CreateUser(&CreateUserRequest{Username: "someone", Email: "new@example.com", Password: "weak"})
+	if got == nil || got.Code() != 400 {
+		t.Fatalf("CreateUser() = %v, want a validation error", got)
+	}
+
+	if cognito.Calls("SignUp") != 0 {
+		t.Error("expected invalid requests not to reach Cognito")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		failWith string
+		want     apierror.ErrorResponse
+	}{
+		{name: "signed in", email: "user@example.com", password: testPassword},
+		{name: "not in database", email: "ghost@example.com", password: testPassword, want: apierror.IDPUserNotFoundError},
+		{name: "wrong password", email: "user@example.com", password: "Wr0ngPass!", want: apierror.IDPCredentialsMismatchError},
+		{name: "not in pool", email: "user@example.com", password: testPassword, failWith: "UserNotFoundException", want: apierror.IDPUserNotFoundError},
+		{name: "not confirmed", email: "user@example.com", password: testPassword, failWith: "UserNotConfirmedException", want: apierror.IDPUserNotConfirmedError},
+		{name: "not authorized", email: "user@example.com", password: testPassword, failWith: "NotAuthorizedException", want: apierror.IDPCredentialsMismatchError},
+		{name: "unknown Cognito error", email: "user@example.com", password: testPassword, failWith: "InternalErrorException", want: apierror.InternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, cognito := newTestUserService(&entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"})
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+			if tt.failWith != "" {
+				cognito.FailWith("SignIn", tt.failWith)
+			}
+
+			resp, got := svc.Login(&UserLoginRequest{Email: tt.email, Password: tt.password})
+			if got != tt.want {
+				t.Fatalf("Login() = %v, want %v", got, tt.want)
+			}
+
+			if tt.want == nil && (resp.AccessToken == "" || resp.IDToken == "" || resp.RefreshToken == "") {
+				t.Errorf("expected tokens, got %+v", resp)
+			}
+		})
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		revoke   bool
+		failWith string
+		want     apierror.ErrorResponse
+	}{
+		{name: "refreshed"},
+		{name: "revoked", revoke: true, want: apierror.InvalidRefreshTokenError},
+		{name: "throttled", failWith: "TooManyRequestsException", want: apierror.IDPTooManyRequestsError},
+		{name: "unknown Cognito error", failWith: "InternalErrorException", want: apierror.InternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, cognito := newTestUserService(&entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"})
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+
+			login, apierr := svc.Login(&UserLoginRequest{Email: "user@example.com", Password: testPassword})
+			if apierr != nil {
+				t.Fatalf("Login() = %v", apierr)
+			}
+
+			if tt.revoke {
+				_ = cognito.RevokeToken(login.RefreshToken)
+			}
+			if tt.failWith != "" {
+				cognito.FailWith("RefreshTokens", tt.failWith)
+			}
+
+			resp, got := svc.RefreshTokens(&RefreshTokenRequest{RefreshToken: login.RefreshToken})
+			if got != tt.want {
+				t.Fatalf("RefreshTokens() = %v, want %v", got, tt.want)
+			}
+
+			// The pool does not rotate refresh tokens, so the same one must be returned
+			if tt.want == nil && (resp.AccessToken == "" || resp.RefreshToken != login.RefreshToken) {
+				t.Errorf("unexpected tokens %+v", resp)
+			}
+		})
+	}
+}
+
+func TestConfirmSignup(t *testing.T) {
+	tests := []struct {
+		name      string
+		verified  bool
+		code      string
+		failWith  string
+		want      apierror.ErrorResponse
+		confirmed bool
+	}{
+		{name: "confirmed", code: "123456", confirmed: true},
+		{name: "already confirmed", verified: true, code: "123456", want: apierror.UserAlreadyConfirmedError, confirmed: true},
+		{name: "wrong code", code: "654321", want: apierror.IDPConfirmCodeMismatchError},
+		{name: "expired code", code: "123456", failWith: "ExpiredCodeException", want: apierror.IDPConfirmCodeExpiredError},
+		{name: "not in pool", code: "123456", failWith: "UserNotFoundException", want: apierror.IDPUserNotFoundError},
+		{name: "unknown Cognito error", code: "123456", failWith: "LimitExceededException", want: apierror.InternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com", EmailVerified: tt.verified}
+			svc, _, cognito := newTestUserService(user)
+			cognito.AddUser(user.Email, &cognitotest.User{Sub: "sub-1", Password: testPassword, Code: "123456"})
+			if tt.failWith != "" {
+				cognito.FailWith("ConfirmAccount", tt.failWith)
+			}
+
+			got := svc.ConfirmSignup(&ConfirmSignupRequest{Email: user.Email, Code: tt.code})
+			if got != tt.want {
+				t.Fatalf("ConfirmSignup() = %v, want %v", got, tt.want)
+			}
+
+			if user.EmailVerified != tt.confirmed {
+				t.Errorf("EmailVerified = %v, want %v", user.EmailVerified, tt.confirmed)
+			}
+
+			publisher, _ := flushUserOutbox(t, svc, time.Now())
+			published := publisher.types()
+			if verified := tt.want == nil; verified != slices.Equal(published, []string{EventUserVerified}) {
+				t.Errorf("published %v, want a user.verified event: %v", published, verified)
+			}
+		})
+	}
+}
+
+func TestGetUsersRequiresPermission(t *testing.T) {
+	member := &entity.User{ID: 1, Role: authz.RoleMember}
+	staff := &entity.User{ID: 2, Role: authz.RoleStaff}
+	svc, _, _ := newTestUserService(member, staff)
+
+	if _, got := svc.GetUsers(member); got != apierror.ForbiddenError {
+		t.Errorf("GetUsers(member) = %v, want %v", got, apierror.ForbiddenError)
+	}
+
+	users, got := svc.GetUsers(staff)
+	if got != nil || len(users) != 2 {
+		t.Errorf("GetUsers(staff) = %v, %v, want both users", users, got)
+	}
+}
+
+func TestResendConfirmationCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		verified bool
+		failWith string
+		want     apierror.ErrorResponse
+	}{
+		{name: "sent", email: "user@example.com"},
+		{name: "not in database", email: "ghost@example.com", want: apierror.IDPUserNotFoundError},
+		{name: "already confirmed", email: "user@example.com", verified: true, want: apierror.UserAlreadyConfirmedError},
+		{name: "limit exceeded", email: "user@example.com", failWith: "LimitExceededException", want: apierror.IDPCodeLimitExceededError},
+		{name: "delivery failure", email: "user@example.com", failWith: "CodeDeliveryFailureException", want: apierror.IDPCodeDeliveryError},
+		{name: "confirmed in pool only", email: "user@example.com", failWith: "InvalidParameterException", want: apierror.UserAlreadyConfirmedError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, cognito := newTestUserService(&entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com", EmailVerified: tt.verified})
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Code: "123456"})
+			if tt.failWith != "" {
+				cognito.FailWith("ResendConfirmation", tt.failWith)
+			}
+
+			if got := svc.ResendConfirmationCode(&ResendCodeRequest{Email: tt.email}); got != tt.want {
+				t.Fatalf("ResendConfirmationCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResendConfirmationCodeThrottled(t *testing.T) {
+	svc, _, cognito := newTestUserService(&entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"})
+	cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Code: "123456"})
+
+	req := &ResendCodeRequest{Email: "user@example.com"}
+	if got := svc.ResendConfirmationCode(req); got != nil {
+		t.Fatalf("ResendConfirmationCode() = %v, want nil", got)
+	}
+
+	if got := svc.ResendConfirmationCode(req); got == nil || got.Code() != 429 {
+		t.Fatalf("ResendConfirmationCode() = %v, want a 429 error", got)
+	}
+
+	if calls := cognito.Calls("ResendConfirmation"); calls != 1 {
+		t.Errorf("Cognito was called %d times, want 1", calls)
+	}
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		confirmed bool
+		code      string
+		password  string
+		failWith  string // Error code returned by Cognito's ConfirmForgotPassword
+		wantSend  apierror.ErrorResponse
+		wantReset apierror.ErrorResponse
+	}{
+		{name: "reset", confirmed: true, code: "654321", password: "N3wPassw0rd!"},
+		{name: "not confirmed", code: "654321", password: "N3wPassw0rd!", wantSend: apierror.IDPUserNotConfirmedError},
+		{name: "wrong code", confirmed: true, code: "000000", password: "N3wPassw0rd!", wantReset: apierror.IDPConfirmCodeMismatchError},
+		{name: "expired code", confirmed: true, code: "654321", password: "N3wPassw0rd!", failWith: "ExpiredCodeException", wantReset: apierror.IDPConfirmCodeExpiredError},
+		{name: "too many attempts", confirmed: true, code: "654321", password: "N3wPassw0rd!", failWith: "TooManyFailedAttemptsException", wantReset: apierror.IDPTooManyRequestsError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _, cognito := newTestUserService(&entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"})
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: tt.confirmed})
+			if tt.failWith != "" {
+				cognito.FailWith("ConfirmForgotPassword", tt.failWith)
+			}
+
+			if got := svc.ForgotPassword(&ForgotPasswordRequest{Email: "user@example.com"}); got != tt.wantSend {
+				t.Fatalf("ForgotPassword() = %v, want %v", got, tt.wantSend)
+			}
+
+			if tt.wantSend != nil {
+				return
+			}
+
+			req := &ResetPasswordRequest{Email: "user@example.com", Code: tt.code, Password: tt.password}
+			if got := svc.ResetPassword(req); got != tt.wantReset {
+				t.Fatalf("ResetPassword() = %v, want %v", got, tt.wantReset)
+			}
+
+			want := testPassword
+			if tt.wantReset == nil {
+				want = tt.password
+			}
+
+			if got := cognito.User("user@example.com").Password; got != want {
+				t.Errorf("password = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestResetPasswordRules(t *testing.T) {
+	svc, _, cognito := newTestUserService()
+
+	got := svc.ResetPassword(&ResetPasswordRequest{Email: "user@example.com", Code: "654321", Password: "alllowercase"})
+	if got == nil || got.Code() != 400 {
+		t.Fatalf("ResetPassword() = %v, want a validation error", got)
+	}
+
+	if cognito.Calls("ConfirmForgotPassword") != 0 {
+		t.Error("expected invalid passwords not to reach Cognito")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		previous string
+		proposed string
+		failWith string
+		want     apierror.ErrorResponse
+	}{
+		{name: "changed", token: "access-sub-1", previous: testPassword, proposed: "N3wPassw0rd!"},
+		{name: "wrong password", token: "access-sub-1", previous: "Wr0ngPass!", proposed: "N3wPassw0rd!", want: apierror.IDPCredentialsMismatchError},
+		{name: "ID token", token: "id-sub-1", previous: testPassword, proposed: "N3wPassw0rd!", want: apierror.AccessTokenRequiredError},
+		{name: "someone else's token", token: "access-sub-2", previous: testPassword, proposed: "N3wPassw0rd!", want: apierror.ForbiddenError},
+		{name: "invalid password", token: "access-sub-1", previous: testPassword, proposed: "N3wPassw0rd!", failWith: "InvalidPasswordException", want: apierror.IDPInvalidPasswordError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"}
+			svc, _, cognito := newTestUserService(caller)
+			svc.ParseToken = parseFakeToken
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+			if tt.failWith != "" {
+				cognito.FailWith("ChangePassword", tt.failWith)
+			}
+
+			req := &ChangePasswordRequest{AccessToken: tt.token, PreviousPassword: tt.previous, ProposedPassword: tt.proposed}
+			if got := svc.ChangePassword(req, caller); got != tt.want {
+				t.Fatalf("ChangePassword() = %v, want %v", got, tt.want)
+			}
+
+			want := testPassword
+			if tt.want == nil {
+				want = tt.proposed
+			}
+
+			if got := cognito.User("user@example.com").Password; got != want {
+				t.Errorf("password = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		failWith string
+		want     apierror.ErrorResponse
+	}{
+		{name: "signed out", token: "access-sub-1"},
+		{name: "already revoked on Cognito", token: "access-sub-1", failWith: "NotAuthorizedException"},
+		{name: "ID token", token: "id-sub-1", want: apierror.AccessTokenRequiredError},
+		{name: "someone else's token", token: "access-sub-2", want: apierror.ForbiddenError},
+		{name: "throttled", token: "access-sub-1", failWith: "TooManyRequestsException", want: apierror.IDPTooManyRequestsError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &entity.User{ID: 1, SubUUID: "sub-1", Email: "user@example.com"}
+			svc, _, cognito := newTestUserService(caller)
+			svc.ParseToken = parseFakeToken
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+			if tt.failWith != "" {
+				cognito.FailWith("GlobalSignOut", tt.failWith)
+			}
+
+			if got := svc.Logout(&LogoutRequest{AccessToken: tt.token}, caller); got != tt.want {
+				t.Fatalf("Logout() = %v, want %v", got, tt.want)
+			}
+
+			// Tokens must only be rejected locally once signed out
+			if signedOut := caller.SignedOutAt != 0; signedOut != (tt.want == nil) {
+				t.Errorf("SignedOutAt = %d, want it set: %v", caller.SignedOutAt, tt.want == nil)
+			}
+		})
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          UpdateProfileRequest
+		failWith     string // Error code returned by Cognito's UpdateEmail
+		saveErr      error
+		want         apierror.ErrorResponse
+		wantUsername string
+		wantEmail    string
+		wantVerified bool
+	}{
+		{name: "username", req: UpdateProfileRequest{Username: "renamed"}, wantUsername: "renamed", wantEmail: "user@example.com", wantVerified: true},
+		{name: "same email", req: UpdateProfileRequest{Email: "user@example.com"}, wantUsername: "someone", wantEmail: "user@example.com", wantVerified: true},
+		{name: "email", req: UpdateProfileRequest{Email: "new@example.com", AccessToken: "access-sub-1"}, wantUsername: "someone", wantEmail: "new@example.com"},
+		{name: "nothing", req: UpdateProfileRequest{}, want: apierror.NothingToUpdateError},
+		{name: "email without access token", req: UpdateProfileRequest{Email: "new@example.com", AccessToken: "id-sub-1"}, want: apierror.AccessTokenRequiredError},
+		{name: "email taken", req: UpdateProfileRequest{Email: "other@example.com", AccessToken: "access-sub-1"}, want: apierror.IDPExistingEmailError},
+		{name: "email rejected by Cognito", req: UpdateProfileRequest{Username: "renamed", Email: "new@example.com", AccessToken: "access-sub-1"}, failWith: "CodeDeliveryFailureException", want: apierror.IDPCodeDeliveryError},
+		{name: "save failure", req: UpdateProfileRequest{Username: "renamed"}, saveErr: errors.New("disk full"), want: apierror.InternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &entity.User{ID: 1, SubUUID: "sub-1", Username: "someone", Email: "user@example.com", EmailVerified: true}
+			svc, repo, cognito := newTestUserService(caller, &entity.User{ID: 2, SubUUID: "sub-2", Email: "other@example.com"})
+			svc.ParseToken = parseFakeToken
+			cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+			if tt.failWith != "" {
+				cognito.FailWith("UpdateEmail", tt.failWith)
+			}
+			repo.saveErr = tt.saveErr
+
+			_, got := svc.UpdateProfile(&tt.req, caller)
+			if got != tt.want {
+				t.Fatalf("UpdateProfile() = %v, want %v", got, tt.want)
+			}
+
+			// Failed updates must leave the profile untouched
+			if tt.want != nil {
+				tt.wantUsername, tt.wantEmail, tt.wantVerified = "someone", "user@example.com", true
+			}
+
+			if caller.Username != tt.wantUsername || caller.Email != tt.wantEmail || caller.EmailVerified != tt.wantVerified {
+				t.Errorf("profile = %q %q %v, want %q %q %v", caller.Username, caller.Email, caller.EmailVerified, tt.wantUsername, tt.wantEmail, tt.wantVerified)
+			}
+
+			saved, _ := repo.FindByID(caller.ID)
+			if saved.Username != tt.wantUsername || saved.Email != tt.wantEmail || saved.EmailVerified != tt.wantVerified {
+				t.Errorf("saved profile = %q %q %v, want %q %q %v", saved.Username, saved.Email, saved.EmailVerified, tt.wantUsername, tt.wantEmail, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	caller := &entity.User{ID: 1, SubUUID: "sub-1", Username: "someone", Email: "user@example.com", EmailVerified: true}
+	svc, _, cognito := newTestUserService(caller)
+	svc.ParseToken = parseFakeToken
+	cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+
+	if _, apierr := svc.UpdateProfile(&UpdateProfileRequest{Email: "new@example.com", AccessToken: "access-sub-1"}, caller); apierr != nil {
+		t.Fatalf("UpdateProfile() = %v", apierr)
+	}
+
+	if got := svc.VerifyEmail(&VerifyEmailRequest{Code: "000000", AccessToken: "access-sub-1"}, caller); got != apierror.IDPConfirmCodeMismatchError {
+		t.Fatalf("VerifyEmail() = %v, want %v", got, apierror.IDPConfirmCodeMismatchError)
+	}
+
+	if got := svc.VerifyEmail(&VerifyEmailRequest{Code: "123456", AccessToken: "access-sub-1"}, caller); got != nil {
+		t.Fatalf("VerifyEmail() = %v, want nil", got)
+	}
+
+	if !caller.EmailVerified {
+		t.Error("expected the new email to be verified")
+	}
+
+	publisher, _ := flushUserOutbox(t, svc, time.Now())
+	if published := publisher.types(); !slices.Equal(published, []string{EventUserVerified}) {
+		t.Errorf("published %v, want a user.verified event", published)
+	}
+
+	if got := svc.VerifyEmail(&VerifyEmailRequest{Code: "123456", AccessToken: "access-sub-1"}, caller); got != apierror.UserAlreadyConfirmedError {
+		t.Errorf("VerifyEmail() = %v, want %v", got, apierror.UserAlreadyConfirmedError)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		inPool   bool
+		failWith string
+		want     apierror.ErrorResponse
+	}{
+		{name: "deleted", inPool: true},
+		{name: "already deleted from pool"},
+		{name: "Cognito failure", inPool: true, failWith: "InternalErrorException"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &entity.User{ID: 1, SubUUID: "sub-1", Username: "someone", Email: "user@example.com", Role: authz.RoleStaff}
+			svc, _, cognito := newTestUserService(caller)
+			if tt.inPool {
+				cognito.AddUser("user@example.com", &cognitotest.User{Sub: "sub-1", Password: testPassword, Confirmed: true})
+			}
+			if tt.failWith != "" {
+				cognito.FailWith("AdminDeleteUser", tt.failWith)
+			}
+
+			past := existing(1, caller, tomorrow(-48), false)
+			upcoming := existing(2, caller, tomorrow(0), false)
+			svc.AppointmentRepo.(*fakeAppointmentRepo).appts = []*entity.Appointment{past, upcoming}
+			sub, _ := svc.Calendar.(*CalendarBroker).Subscribe(CalendarFilter{ResourceID: upcoming.ResourceID, From: 0, To: tomorrow(24).UnixMilli()}, 0)
+
+			if got := svc.DeleteAccount(caller); got != tt.want {
+				t.Fatalf("DeleteAccount() = %v, want %v", got, tt.want)
+			}
+
+			if past.IsDeleted || !upcoming.IsDeleted || upcoming.CancelReason != accountDeletedReason {
+				t.Errorf("expected only the upcoming appointment to be cancelled, got %+v and %+v", past, upcoming)
+			}
+
+			if !caller.IsDeleted || caller.Email != "" || caller.SubUUID != "" || caller.Role != authz.RoleMember {
+				t.Errorf("expected the user to be anonymised, got %+v", caller)
+			}
+
+			if streamed := receive(sub); !slices.Equal(streamed, []string{SlotFreed}) {
+				t.Errorf("streamed %v, want the slot of the upcoming appointment freed", streamed)
+			}
+
+			// The Cognito user is deleted in the background, failures are retried
+			publisher, outbox := flushUserOutbox(t, svc, time.Now())
+			if !slices.Equal(publisher.types(), []string{EventAppointmentCancelled}) {
+				t.Errorf("published %v, want one appointment.cancelled event", publisher.types())
+			}
+
+			if tt.failWith != "" {
+				if len(outbox.msgs) != 1 || outbox.msgs[0].Attempts != 1 || cognito.User("user@example.com") == nil {
+					t.Fatalf("unexpected outbox messages %+v, want the deletion to be retried", outbox.msgs)
+				}
+				cognito.Fail("AdminDeleteUser", nil)
+				flushUserOutbox(t, svc, time.Now().Add(time.Minute))
+			}
+
+			if len(outbox.msgs) != 0 || cognito.User("user@example.com") != nil {
+				t.Error("expected the Cognito user to be deleted")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/integration/webhook"
+	"4shure/cmd/internal/utils"
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// deliveryBatchSize caps the deliveries attempted in a single run of the dispatcher.
+const deliveryBatchSize = 50
+
+type WebhookSender interface {
+	Send(req *webhook.Request) (int, error)
+}
+
+// WebhookConfig tells how webhook deliveries are attempted.
+type WebhookConfig struct {
+	// MaxAttempts is how many times a delivery is attempted before it is marked as failed.
+	MaxAttempts int
+
+	// RetryDelay is the wait after the first failed attempt. It doubles after every
+	// other failure, up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// Timeout bounds every attempt.
+	Timeout time.Duration
+
+	// PollInterval is how often the dispatcher looks for retries that are due.
+	PollInterval time.Duration
+}
+
+// WebhookConfigFromEnv reads the WEBHOOK_* variables, falling back to defaults that retry
+// for about a day: 30s, 1m, 2m... up to 6h between attempts, 10 attempts in total.
+func WebhookConfigFromEnv() *WebhookConfig {
+	cfg := &WebhookConfig{
+		MaxAttempts:   10,
+		RetryDelay:    durationFromEnv("WEBHOOK_RETRY_DELAY", 30*time.Second),
+		MaxRetryDelay: durationFromEnv("WEBHOOK_MAX_RETRY_DELAY", 6*time.Hour),
+		Timeout:       durationFromEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		PollInterval:  durationFromEnv("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+	}
+
+	if raw := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			log.Warnf("invalid WEBHOOK_MAX_ATTEMPTS (%q), using default: %d", raw, cfg.MaxAttempts)
+		} else {
+			cfg.MaxAttempts = attempts
+		}
+	}
+	return cfg
+}
+
+// Wake tells the dispatcher new deliveries are waiting, instead of waiting for the next poll.
+func (w *DefaultWebhookService) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers the pending events until the context is done, as soon as they are published
+// and every poll interval for retries. Deliveries are kept in the database, so the ones
+// interrupted by a restart are resumed.
+func (w *DefaultWebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back, there may be more due
+		for w.DeliverDue(utils.NowUTC()) == deliveryBatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// DeliverDue attempts the deliveries that are due at the given time, and returns how many were attempted.
+func (w *DefaultWebhookService) DeliverDue(now int64) int {
+	deliveries, err := w.WebhookRepo.FindDueDeliveries(now, deliveryBatchSize)
+	if err != nil {
+		log.Errorf("failed to fetch due webhook deliveries: %v", err)
+		return 0
+	}
+
+	webhooks := make(map[int]*entity.Webhook)
+	for _, delivery := range deliveries {
+		hook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			hook, err = w.WebhookRepo.FindByID(delivery.WebhookID)
+			if err != nil {
+				log.Errorf("failed to fetch webhook by id %d: %v", delivery.WebhookID, err)
+				continue
+			}
+			webhooks[delivery.WebhookID] = hook
+		}
+
+		w.attempt(hook, delivery, now)
+		err = w.WebhookRepo.SaveDelivery(delivery)
+		if err != nil {
+			log.Errorf("failed to save webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return len(deliveries)
+}
+
+// attempt sends the delivery once, and schedules the next attempt if it failed.
+// Deliveries of deleted or disabled webhooks fail right away.
+func (w *DefaultWebhookService) attempt(hook *entity.Webhook, delivery *entity.WebhookDelivery, now int64) {
+	delivery.UpdatedAt = now
+	if hook == nil || hook.IsDeleted || !hook.IsActive {
+		delivery.Status = entity.DeliveryFailed
+		delivery.LastError = "Webhook was disabled or deleted"
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = now
+	status, err := w.Sender.Send(&webhook.Request{
+		URL:        hook.URL,
+		Secret:     hook.Secret,
+		EventType:  delivery.EventType,
+		EventID:    delivery.EventID,
+		DeliveryID: delivery.ID,
+		Body:       []byte(delivery.Payload),
+	})
+
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = entity.DeliverySucceeded
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= w.Config.MaxAttempts {
+		delivery.Status = entity.DeliveryFailed
+		log.Warnf("giving up webhook delivery %d to %s after %d attempts: %v", delivery.ID, hook.URL, delivery.Attempts, err)
+		return
+	}
+	delivery.NextAttemptAt = now + backoff(w.Config.RetryDelay, w.Config.MaxRetryDelay, delivery.Attempts).Milliseconds()
+}
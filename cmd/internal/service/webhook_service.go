@@ -0,0 +1,430 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils"
+	"4shure/cmd/internal/utils/apierror"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/gommon/log"
+)
+
+// Events sent to webhooks
+const (
+	EventAppointmentCreated     = "appointment.created"
+	EventAppointmentCancelled   = "appointment.cancelled"
+	EventAppointmentRescheduled = "appointment.rescheduled"
+	EventUserVerified           = "user.verified"
+)
+
+// WebhookEvents lists every event webhooks can subscribe to.
+var WebhookEvents = []string{
+	EventAppointmentCreated,
+	EventAppointmentCancelled,
+	EventAppointmentRescheduled,
+	EventUserVerified,
+}
+
+// maxDeliveriesListed caps the delivery log returned by GetDeliveries.
+const maxDeliveriesListed = 100
+
+// EventPublisher lets other parties know about changes, see DefaultWebhookService.Publish.
+type EventPublisher interface {
+	Publish(eventID, eventType string, data any) error
+}
+
+type WebhookRepository interface {
+	FindByID(id int) (*entity.Webhook, error)
+	FindAll() ([]*entity.Webhook, error)
+	FindActive() ([]*entity.Webhook, error)
+	Save(webhook *entity.Webhook) error
+	FindDelivery(id int) (*entity.WebhookDelivery, error)
+	FindDeliveries(webhookID, limit int) ([]*entity.WebhookDelivery, error)
+	FindDueDeliveries(now int64, limit int) ([]*entity.WebhookDelivery, error)
+	CreateDeliveries(deliveries []*entity.WebhookDelivery) error
+	SaveDelivery(delivery *entity.WebhookDelivery) error
+}
+
+type WebhookRequest struct {
+	URL         string   `json:"url" validate:"required,http_url,max=2048"`
+	Description string   `json:"description" validate:"max=256"`
+	Events      []string `json:"events" validate:"required,min=1,nodupes,dive,oneof=appointment.created appointment.cancelled appointment.rescheduled user.verified"`
+}
+
+// UpdateWebhookRequest holds the fields that can be changed on an existing
+// webhook. Fields left empty are kept unchanged.
+type UpdateWebhookRequest struct {
+	URL         string   `json:"url" validate:"omitempty,http_url,max=2048"`
+	Description string   `json:"description" validate:"max=256"`
+	Events      []string `json:"events" validate:"omitempty,min=1,nodupes,dive,oneof=appointment.created appointment.cancelled appointment.rescheduled user.verified"`
+	IsActive    *bool    `json:"is_active"`
+}
+
+type WebhookResponse struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	IsActive    bool     `json:"is_active"`
+	CreatedBy   int      `json:"created_by"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+
+	// Secret signs the events, it is only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+}
+
+type DeliveryResponse struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  string          `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	ReplayOf       int             `json:"replay_of,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// WebhookEvent is the body posted to webhooks.
+type WebhookEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+// RescheduledEventData is the data of EventAppointmentRescheduled events.
+type RescheduledEventData struct {
+	*AppointmentResponse
+	PreviousBeginsAt   string `json:"previous_begins_at"`
+	PreviousEndsAt     string `json:"previous_ends_at"`
+	PreviousResourceID int    `json:"previous_resource_id"`
+}
+
+type DefaultWebhookService struct {
+	WebhookRepo WebhookRepository
+	Validate    *validator.Validate
+	Sender      WebhookSender
+	Config      *WebhookConfig
+
+	// wake tells the dispatcher new deliveries are waiting
+	wake chan struct{}
+}
+
+func NewWebhookService(webhookRepo WebhookRepository, validate *validator.Validate, sender WebhookSender, cfg *WebhookConfig) *DefaultWebhookService {
+	return &DefaultWebhookService{
+		WebhookRepo: webhookRepo,
+		Validate:    validate,
+		Sender:      sender,
+		Config:      cfg,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+func (w *DefaultWebhookService) GetWebhooks(caller *entity.User) ([]*WebhookResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.WebhooksManage); apierr != nil {
+		return nil, apierr
+	}
+
+	webhooks, err := w.WebhookRepo.FindAll()
+	if err != nil {
+		log.Errorf("failed to fetch all webhooks: %v", err)
+		return nil, apierror.InternalServerError
+	}
+
+	resp := make([]*WebhookResponse, len(webhooks))
+	for i, webhook := range webhooks {
+		resp[i] = toWebhookResponse(webhook)
+	}
+	return resp, nil
+}
+
+// CreateWebhook registers a new webhook, along with the secret signing its events.
+// The secret is only part of this response, it cannot be read afterwards.
+func (w *DefaultWebhookService) CreateWebhook(req *WebhookRequest, caller *entity.User) (*WebhookResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.WebhooksManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := w.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	now := utils.NowUTC()
+	webhook := &entity.Webhook{
+		URL:         req.URL,
+		Description: req.Description,
+		Secret:      "whsec_" + rand.Text(),
+		Events:      strings.Join(req.Events, ","),
+		IsActive:    true,
+		IsDeleted:   false,
+		CreatedBy:   caller.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err := w.WebhookRepo.Save(webhook)
+	if err != nil {
+		log.Errorf("failed to save webhook: %v", err)
+		return nil, apierror.InternalServerError
+	}
+
+	resp := toWebhookResponse(webhook)
+	resp.Secret = webhook.Secret
+	return resp, nil
+}
+
+func (w *DefaultWebhookService) UpdateWebhook(id int, req *UpdateWebhookRequest, caller *entity.User) (*WebhookResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.WebhooksManage); apierr != nil {
+		return nil, apierr
+	}
+
+	utils.Sanitize(req)
+	if err := w.Validate.Struct(req); err != nil {
+		return nil, apierror.FromValidationError(err)
+	}
+
+	if req.URL == "" && req.Description == "" && len(req.Events) == 0 && req.IsActive == nil {
+		return nil, apierror.NothingToUpdateError
+	}
+
+	webhook, apierr := w.fetchWebhook(id)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if req.URL != "" {
+		webhook.URL = req.URL
+	}
+
+	if req.Description != "" {
+		webhook.Description = req.Description
+	}
+
+	if len(req.Events) > 0 {
+		webhook.Events = strings.Join(req.Events, ",")
+	}
+
+	if req.IsActive != nil {
+		webhook.IsActive = *req.IsActive
+	}
+
+	webhook.UpdatedAt = utils.NowUTC()
+	err := w.WebhookRepo.Save(webhook)
+	if err != nil {
+		log.Errorf("failed to update webhook by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+	return toWebhookResponse(webhook), nil
+}
+
+// DeleteWebhook marks the webhook as deleted, so it no longer receives events.
+// Its pending deliveries are dropped by the dispatcher.
+func (w *DefaultWebhookService) DeleteWebhook(id int, caller *entity.User) apierror.ErrorResponse {
+	if apierr := authorize(caller, authz.WebhooksManage); apierr != nil {
+		return apierr
+	}
+
+	webhook, apierr := w.fetchWebhook(id)
+	if apierr != nil {
+		return apierr
+	}
+
+	webhook.IsDeleted = true
+	webhook.IsActive = false
+	webhook.UpdatedAt = utils.NowUTC()
+	err := w.WebhookRepo.Save(webhook)
+	if err != nil {
+		log.Errorf("failed to delete webhook by id %d: %v", id, err)
+		return apierror.InternalServerError
+	}
+	return nil
+}
+
+// GetDeliveries lists the latest deliveries of the webhook, latest first.
+func (w *DefaultWebhookService) GetDeliveries(id int, caller *entity.User) ([]*DeliveryResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.WebhooksManage); apierr != nil {
+		return nil, apierr
+	}
+
+	if _, apierr := w.fetchWebhook(id); apierr != nil {
+		return nil, apierr
+	}
+
+	deliveries, err := w.WebhookRepo.FindDeliveries(id, maxDeliveriesListed)
+	if err != nil {
+		log.Errorf("failed to fetch deliveries of webhook %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	resp := make([]*DeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		resp[i] = toDeliveryResponse(delivery)
+	}
+	return resp, nil
+}
+
+// ReplayDelivery sends the event of a past delivery again, whatever its outcome was. The replay
+// is a new delivery with the same event ID, so receivers can tell they already processed it.
+func (w *DefaultWebhookService) ReplayDelivery(id, deliveryID int, caller *entity.User) (*DeliveryResponse, apierror.ErrorResponse) {
+	if apierr := authorize(caller, authz.WebhooksManage); apierr != nil {
+		return nil, apierr
+	}
+
+	webhook, apierr := w.fetchWebhook(id)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	original, err := w.WebhookRepo.FindDelivery(deliveryID)
+	if err != nil {
+		log.Errorf("failed to fetch delivery by id %d: %v", deliveryID, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if original == nil || original.WebhookID != webhook.ID {
+		return nil, apierror.NotFoundError
+	}
+
+	now := utils.NowUTC()
+	replay := &entity.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        entity.DeliveryPending,
+		NextAttemptAt: now,
+		ReplayOf:      original.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	err = w.WebhookRepo.CreateDeliveries([]*entity.WebhookDelivery{replay})
+	if err != nil {
+		log.Errorf("failed to replay delivery %d: %v", original.ID, err)
+		return nil, apierror.InternalServerError
+	}
+
+	w.Wake()
+	return toDeliveryResponse(replay), nil
+}
+
+// Publish queues the event for every active webhook subscribed to it, all at once.
+// Deliveries happen in the background, see Run. Services publish their events through
+// the outbox (see OutboxWebhookEvent), rather than calling Publish themselves. Publishing
+// the same event ID again, e.g. when the outbox retries a message, queues nothing new.
+func (w *DefaultWebhookService) Publish(eventID, eventType string, data any) error {
+	webhooks, err := w.WebhookRepo.FindActive()
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+
+	var subscribed []*entity.Webhook
+	for _, webhook := range webhooks {
+		if slices.Contains(strings.Split(webhook.Events, ","), eventType) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	now := utils.NowUTC()
+	event := &WebhookEvent{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: utils.FormatEpoch(now),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	deliveries := make([]*entity.WebhookDelivery, len(subscribed))
+	for i, webhook := range subscribed {
+		deliveries[i] = &entity.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        entity.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+	}
+
+	err = w.WebhookRepo.CreateDeliveries(deliveries)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s event: %w", eventType, err)
+	}
+
+	w.Wake()
+	return nil
+}
+
+func (w *DefaultWebhookService) fetchWebhook(id int) (*entity.Webhook, apierror.ErrorResponse) {
+	webhook, err := w.WebhookRepo.FindByID(id)
+	if err != nil {
+		log.Errorf("failed to fetch webhook by id %d: %v", id, err)
+		return nil, apierror.InternalServerError
+	}
+
+	if webhook == nil || webhook.IsDeleted {
+		return nil, apierror.NotFoundError
+	}
+	return webhook, nil
+}
+
+func toWebhookResponse(webhook *entity.Webhook) *WebhookResponse {
+	return &WebhookResponse{
+		ID:          webhook.ID,
+		URL:         webhook.URL,
+		Description: webhook.Description,
+		Events:      strings.Split(webhook.Events, ","),
+		IsActive:    webhook.IsActive,
+		CreatedBy:   webhook.CreatedBy,
+		CreatedAt:   utils.FormatEpoch(webhook.CreatedAt),
+		UpdatedAt:   utils.FormatEpoch(webhook.UpdatedAt),
+	}
+}
+
+func toDeliveryResponse(delivery *entity.WebhookDelivery) *DeliveryResponse {
+	resp := &DeliveryResponse{
+		ID:             delivery.ID,
+		WebhookID:      delivery.WebhookID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		ReplayOf:       delivery.ReplayOf,
+		CreatedAt:      utils.FormatEpoch(delivery.CreatedAt),
+		Payload:        json.RawMessage(delivery.Payload),
+	}
+
+	if delivery.Status == entity.DeliveryPending {
+		resp.NextAttemptAt = utils.FormatEpoch(delivery.NextAttemptAt)
+	}
+
+	if delivery.LastAttemptAt != 0 {
+		resp.LastAttemptAt = utils.FormatEpoch(delivery.LastAttemptAt)
+	}
+	return resp
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"4shure/cmd/internal/authz"
+	"4shure/cmd/internal/domain/entity"
+	"4shure/cmd/internal/utils/apierror"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var admin = &entity.User{ID: 9, Role: authz.RoleAdmin}
+
+func newTestWebhookService(webhooks ...*entity.Webhook) (*DefaultWebhookService, *fakeWebhookRepo, *fakeSender) {
+	repo := &fakeWebhookRepo{webhooks: webhooks}
+	sender := &fakeSender{status: http.StatusOK}
+	cfg := &WebhookConfig{
+		MaxAttempts:   3,
+		RetryDelay:    time.Minute,
+		MaxRetryDelay: time.Hour,
+		PollInterval:  time.Second,
+	}
+	return NewWebhookService(repo, newTestValidator(), sender, cfg), repo, sender
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller *entity.User
+		req    *WebhookRequest
+		want   int // Expected status, zero for success
+	}{
+		{name: "created", caller: admin, req: &WebhookRequest{URL: "https://crm.example.com/hooks", Events: []string{EventAppointmentCreated}}},
+		{name: "not an admin", caller: staff, req: &WebhookRequest{URL: "https://crm.example.com/hooks", Events: []string{EventAppointmentCreated}}, want: http.StatusForbidden},
+		{name: "not an HTTP URL", caller: admin, req: &WebhookRequest{URL: "ftp://crm.example.com", Events: []string{EventAppointmentCreated}}, want: http.StatusBadRequest},
+		{name: "no events", caller: admin, req: &WebhookRequest{URL: "https://crm.example.com/hooks"}, want: http.StatusBadRequest},
+		{name: "unknown event", caller: admin, req: &WebhookRequest{URL: "https://crm.example.com/hooks", Events: []string{"user.created"}}, want: http.StatusBadRequest},
+		{name: "duplicate events", caller: admin, req: &WebhookRequest{URL: "https://crm.example.com/hooks", Events: []string{EventUserVerified, EventUserVerified}}, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, repo, _ := newTestWebhookService()
+
+			resp, apierr := svc.CreateWebhook(tt.req, tt.caller)
+			if tt.want != 0 {
+				if apierr == nil || apierr.Code() != tt.want {
+					t.Fatalf("CreateWebhook() = %v, want status %d", apierr, tt.want)
+				}
+				return
+			}
+
+			if apierr != nil {
+				t.Fatalf("CreateWebhook() = %v", apierr)
+			}
+
+			if !strings.HasPrefix(resp.Secret, "whsec_") || resp.Secret != repo.webhooks[0].Secret || !resp.IsActive {
+				t.Errorf("unexpected webhook %+v", resp)
+			}
+
+			listed, _ := svc.GetWebhooks(admin)
+			if len(listed) != 1 || listed[0].Secret != "" {
+				t.Errorf("GetWebhooks() = %+v, want the webhook without its secret", listed)
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	svc, repo, _ := newTestWebhookService(
+		&entity.Webhook{ID: 1, URL: "https://a.example.com", Events: "appointment.created,appointment.cancelled", IsActive: true},
+		&entity.Webhook{ID: 2, URL: "https://b.example.com", Events: "user.verified", IsActive: true},
+		&entity.Webhook{ID: 3, URL: "https://c.example.com", Events: "appointment.created", IsActive: false},
+		&entity.Webhook{ID: 4, URL: "https://d.example.com", Events: "appointment.created", IsActive: true, IsDeleted: true},
+	)
+
+	svc.Publish("evt_1", EventAppointmentCreated, &AppointmentResponse{ID: 7})
+	if len(repo.deliveries) != 1 || repo.deliveries[0].WebhookID != 1 || repo.deliveries[0].Status != entity.DeliveryPending {
+		t.Fatalf("unexpected deliveries %+v, want one pending delivery to webhook 1", repo.deliveries)
+	}
+
+	var event struct {
+		ID   string
+		Type string
+		Data struct{ ID int }
+	}
+	err := json.Unmarshal([]byte(repo.deliveries[0].Payload), &event)
+	if err != nil || event.Type != EventAppointmentCreated || event.Data.ID != 7 || event.ID != "evt_1" || repo.deliveries[0].EventID != "evt_1" {
+		t.Errorf("unexpected payload %s (%v)", repo.deliveries[0].Payload, err)
+	}
+
+	// Publishing the same event again, e.g. after a retry, queues nothing new
+	svc.Publish("evt_1", EventAppointmentCreated, &AppointmentResponse{ID: 7})
+	if len(repo.deliveries) != 1 {
+		t.Errorf("unexpected deliveries %+v after publishing the event again", repo.deliveries)
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	now := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC).UnixMilli()
+	hook := &entity.Webhook{ID: 1, URL: "https://a.example.com", Secret: "whsec_1", Events: "appointment.created", IsActive: true}
+	svc, repo, sender := newTestWebhookService(hook)
+	svc.Publish("evt_1", EventAppointmentCreated, &AppointmentResponse{ID: 7})
+	delivery := repo.deliveries[0]
+	delivery.NextAttemptAt = now
+
+	// Failed attempts are tried again later on, twice as late every time
+	sender.status, sender.err = http.StatusBadGateway, errFake
+	for attempt, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if n := svc.DeliverDue(now); n != 1 {
+			t.Fatalf("DeliverDue() = %d on attempt %d, want 1", n, attempt+1)
+		}
+
+		if delivery.Status != entity.DeliveryPending || delivery.ResponseStatus != http.StatusBadGateway || delivery.NextAttemptAt != now+wait.Milliseconds() {
+			t.Fatalf("unexpected delivery after attempt %d: %+v", attempt+1, delivery)
+		}
+
+		if n := svc.DeliverDue(now); n != 0 {
+			t.Fatalf("DeliverDue() = %d before the retry is due, want 0", n)
+		}
+		now = delivery.NextAttemptAt
+	}
+
+	// Until they run out of attempts
+	svc.DeliverDue(now)
+	if delivery.Status != entity.DeliveryFailed || delivery.Attempts != 3 {
+		t.Fatalf("unexpected delivery after the last attempt: %+v", delivery)
+	}
+
+	request := sender.requests[0]
+	if request.URL != hook.URL || request.Secret != hook.Secret || request.EventID != delivery.EventID || string(request.Body) != delivery.Payload {
+		t.Errorf("unexpected request %+v", request)
+	}
+
+	// Failed deliveries can be replayed
+	replay, apierr := svc.ReplayDelivery(1, delivery.ID, admin)
+	if apierr != nil || replay.ReplayOf != delivery.ID || replay.EventID != delivery.EventID {
+		t.Fatalf("ReplayDelivery() = %+v, %v", replay, apierr)
+	}
+
+	sender.status, sender.err = http.StatusOK, nil
+	if n := svc.DeliverDue(now + time.Minute.Milliseconds()); n != 1 || repo.deliveries[1].Status != entity.DeliverySucceeded {
+		t.Errorf("DeliverDue() = %d, replay %+v, want it delivered", n, repo.deliveries[1])
+	}
+
+	deliveries, _ := svc.GetDeliveries(1, admin)
+	if len(deliveries) != 2 || deliveries[0].ID != repo.deliveries[1].ID {
+		t.Errorf("GetDeliveries() = %+v, want both deliveries, latest first", deliveries)
+	}
+}
+
+func TestDeliverDueDisabledWebhook(t *testing.T) {
+	svc, repo, sender := newTestWebhookService(&entity.Webhook{ID: 1, URL: "https://a.example.com", Events: "user.verified", IsActive: true})
+	svc.Publish("evt_1", EventUserVerified, &UserResponse{ID: 1})
+
+	if _, apierr := svc.UpdateWebhook(1, &UpdateWebhookRequest{IsActive: new(bool)}, admin); apierr != nil {
+		t.Fatalf("UpdateWebhook() = %v", apierr)
+	}
+
+	svc.DeliverDue(repo.deliveries[0].NextAttemptAt)
+	if repo.deliveries[0].Status != entity.DeliveryFailed || len(sender.requests) != 0 {
+		t.Errorf("unexpected delivery %+v, want it failed without being sent", repo.deliveries[0])
+	}
+}
+
+func TestReplayDeliveryOfAnotherWebhook(t *testing.T) {
+	svc, repo, _ := newTestWebhookService(
+		&entity.Webhook{ID: 1, Events: "user.verified", IsActive: true},
+		&entity.Webhook{ID: 2, Events: "appointment.created", IsActive: true},
+	)
+	svc.Publish("evt_1", EventUserVerified, &UserResponse{ID: 1})
+
+	if _, apierr := svc.ReplayDelivery(2, repo.deliveries[0].ID, admin); apierr != apierror.NotFoundError {
+		t.Errorf("ReplayDelivery() = %v, want %v", apierr, apierror.NotFoundError)
+	}
+}
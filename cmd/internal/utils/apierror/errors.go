@@ -6,6 +6,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // ErrorResponse abstracts all API error responses to the user.
@@ -41,19 +42,61 @@ func (s *StructuredError) Add(field, problem string) {
 	s.Errors[field] = append(s.Errors[field], problem)
 }
 
+// ConflictsError lists the periods that could not be booked, e.g.,
+// the conflicting occurrences of a recurring appointment.
+type ConflictsError struct {
+	Message   string   `json:"message"`
+	Conflicts []string `json:"conflicts"`
+	Status    int      `json:"-"`
+}
+
+func (c *ConflictsError) Code() int {
+	return c.Status
+}
+
 var (
 	MalformedBodyError  = NewSimple(400, "Malformed form body")
 	InternalServerError = NewSimple(500, "Internal server error")
 
 	NotFoundError          = NewSimple(404, "Resource not found")
+	ForbiddenError         = NewSimple(403, "You are not allowed to perform this action")
+	InvalidResourceError   = NewSimple(400, "The selected resource does not exist")
+	InvalidUserError       = NewSimple(400, "The selected user does not exist")
+	NothingToUpdateError   = NewSimple(400, "No fields to update were provided")
 	AppointmentInPastError = NewSimple(400, "Appointments cannot have a begin date in the past")
 	MomentNotAvailable     = NewSimple(400, "This period in time is not available for new appointments")
+	NotCancelledError      = NewSimple(400, "Only cancelled appointments can be restored")
+	NotRestorableError     = NewSimple(400, "This appointment can no longer be restored, its owner or series is gone")
+	AppointmentEndedError  = NewSimple(400, "Appointments that already ended cannot be cancelled")
 	HourNotExactError      = NewSimple(400, "Appointment times must be exact. OK: (14:00:00), NOT OK: (14:00:01)")
+	AmbiguousEndError      = NewSimple(400, "Provide either 'ends_at' or 'duration', not both")
+	EndBeforeBeginError    = NewSimple(400, "Appointments must end after they begin")
+
+	RecurrenceEndError          = NewSimple(400, "Recurring appointments need either 'count' or 'until', not both")
+	RecurrenceWeekdaysError     = NewSimple(400, "Weekdays can only be used with daily or weekly recurrences")
+	NoOccurrencesError          = NewSimple(400, "The recurrence rule does not produce any appointment")
+	OverlappingOccurrencesError = NewSimple(400, "The occurrences of the recurrence rule would overlap each other")
+	InvalidScopeError           = NewSimple(400, "Parameter 'scope' must be one of the following: this, following, all")
+
+	OutsideOpeningHoursError  = NewSimple(400, "This period is outside of the opening hours")
+	InvalidOpeningWindowError = NewSimple(400, "Opening windows must close after they open")
+	OverrideHoursMissingError = NewSimple(400, "Provide both 'opens_at' and 'closes_at', or set 'is_closed'")
+
+	InvalidRangeError    = NewSimple(400, "The end of the range must be after its beginning")
+	NoSlotAvailableError = NewSimple(404, "No available slot was found")
+
+	OwnRoleError              = NewSimple(400, "You cannot change your own role")
+	UnknownPermissionError    = NewSimple(400, "Unknown permission")
+	PermissionNotGrantedError = NewSimple(404, "This permission was not granted to the user")
 
 	/*
 	 * Used for authentications
 	 */
 	InvalidAuthTokenError       = NewSimple(401, "Invalid token")
+	UnregisteredUserError       = NewSimple(401, "The user behind this token is not registered")
+	RevokedAuthTokenError       = NewSimple(401, "This token was revoked, please sign in again")
+	AccessTokenRequiredError    = NewSimple(400, "This action requires an access token")
+	InvalidRefreshTokenError    = NewSimple(401, "Invalid refresh token, please sign in again")
 	UserAlreadyExistsError      = NewSimple(400, "User already exists")
 	UserAlreadyConfirmedError   = NewSimple(400, "User is already confirmed")
 	IDPInvalidPasswordError     = NewSimple(400, "Provided password does not meet requirements")
@@ -64,6 +107,9 @@ var (
 	IDPConfirmCodeMismatchError = NewSimple(400, "Confirmation code mismatch")
 	IDPConfirmCodeExpiredError  = NewSimple(400, "Confirmation code has expired")
 	IDPInvalidParameterError    = NewSimple(400, "Invalid parameters provided, the user is likely already verified")
+	IDPTooManyRequestsError     = NewSimple(429, "Too many requests, please try again later")
+	IDPCodeLimitExceededError   = NewSimple(429, "Too many codes were requested for this account, please try again later")
+	IDPCodeDeliveryError        = NewSimple(502, "The code could not be delivered, please check the email address or try again later")
 )
 
 func FromValidationError(err error) *StructuredError {
@@ -98,10 +144,18 @@ func FromValidationError(err error) *StructuredError {
 			problems[field] = append(problems[field], "Value cannot contain duplicate entries")
 		case "email":
 			problems[field] = append(problems[field], "Value must be a valid email address")
+		case "http_url":
+			problems[field] = append(problems[field], "Value must be a valid HTTP(S) URL")
 		case "oneof":
 			problems[field] = append(problems[field], "Value must be one of the following: "+fe.Param())
 		case "iso8601":
 			problems[field] = append(problems[field], "Value must be a valid ISO8601 date/time format")
+		case "clock":
+			problems[field] = append(problems[field], "Value must be a time of day (HH:MM)")
+		case "datetime":
+			problems[field] = append(problems[field], "Value must follow the format: "+fe.Param())
+		case "nefield":
+			problems[field] = append(problems[field], "Value must be different from: "+strings.ToLower(fe.Param()))
 
 		default:
 			problems[field] = append(problems[field], "Invalid value provided")
@@ -136,6 +190,34 @@ func NewInvalidParamTypeError(name, dataType string) *APIError {
 	return NewSimple(http.StatusBadRequest, "Parameter '%s' has invalid type, expected: %s", name, dataType)
 }
 
+func NewTimeNotAlignedError(step time.Duration) *APIError {
+	return NewSimple(http.StatusBadRequest, "Appointment times must be aligned to steps of %s", step)
+}
+
+func NewInvalidDurationError(min, max time.Duration) *APIError {
+	return NewSimple(http.StatusBadRequest, "Appointment length must be between %s and %s", min, max)
+}
+
+func NewTooManyOccurrencesError(max int) *APIError {
+	return NewSimple(http.StatusBadRequest, "Recurring appointments cannot have more than %d occurrences", max)
+}
+
+func NewRangeTooLargeError(max time.Duration) *APIError {
+	return NewSimple(http.StatusBadRequest, "The range cannot be longer than %d days", int(max.Hours()/24))
+}
+
+func NewThrottledError(wait time.Duration) *APIError {
+	return NewSimple(http.StatusTooManyRequests, "Please wait %d seconds before trying again", int(wait.Seconds()+0.999))
+}
+
+func NewConflictsError(conflicts []string) *ConflictsError {
+	return &ConflictsError{
+		Message:   "Some of the requested periods are not available for new appointments",
+		Conflicts: conflicts,
+		Status:    http.StatusConflict,
+	}
+}
+
 func NewNoteContentTooLargeError(max int64) *APIError {
 	return NewSimple(http.StatusBadRequest, "Note content is too large, max: %d", max)
 }
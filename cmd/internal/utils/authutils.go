@@ -2,13 +2,13 @@ package utils
 
 import (
 	"errors"
-	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"strings"
 )
 
-var parser = new(jwt.Parser)
+// verifier checks every token before its claims are trusted, see SetTokenVerifier.
+var verifier *TokenVerifier
 
 type TokenData struct {
 	// Sub describes the user's ID on Cognito.
@@ -18,43 +18,54 @@ type TokenData struct {
 	// Email the user's Email.
 	// This value will be empty if the provided token is an Access Token, for instance.
 	Email string
+
+	// TokenUse tells whether the token is an ID ("id") or an Access Token ("access").
+	TokenUse string
+
+	// IssuedAt is when the token was issued, in epoch seconds.
+	IssuedAt int64
+}
+
+// SetTokenVerifier sets the verifier used by ParseTokenData and ParseTokenDataCtx.
+func SetTokenVerifier(v *TokenVerifier) {
+	verifier = v
 }
 
+// ParseTokenData verifies the token and extracts its data.
 func ParseTokenData(token string) (*TokenData, error) {
 	if token == "" {
 		return nil, errors.New("token is empty")
 	}
 
+	if verifier == nil {
+		return nil, errors.New("no token verifier configured")
+	}
+
 	clean := sanitizeToken(token)
-	claims, err := GetUnsafeClaims(clean)
+	claims, err := verifier.Verify(clean)
 	if err != nil {
 		return nil, err
 	}
 
-	return &TokenData{
-		Sub:   getValue(claims, "sub"),
-		Email: getValue(claims, "email"),
-	}, nil
+	data := &TokenData{
+		Sub:      getValue(claims, "sub"),
+		Email:    getValue(claims, "email"),
+		TokenUse: getValue(claims, "token_use"),
+	}
+
+	if iat, _ := claims.GetIssuedAt(); iat != nil {
+		data.IssuedAt = iat.Unix()
+	}
+	return data, nil
 }
 
 func ParseTokenDataCtx(ctx echo.Context) (*TokenData, error) {
-	token := ctx.Request().Header.Get("Authorization")
-	clean := sanitizeToken(token)
-	return ParseTokenData(clean)
+	return ParseTokenData(RequestToken(ctx))
 }
 
-// GetUnsafeClaims DOES NOT check if the claims are valid.
-// However, we are safe to use it, as all requests go through API Gateway first.
-func GetUnsafeClaims(tokenString string) (jwt.MapClaims, error) {
-	token, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		return claims, nil
-	}
-	return nil, fmt.Errorf("invalid claims format")
+// RequestToken returns the token sent in the Authorization header, without its "Bearer" prefix.
+func RequestToken(ctx echo.Context) string {
+	return sanitizeToken(ctx.Request().Header.Get("Authorization"))
 }
 
 func sanitizeToken(token string) string {
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// maxThrottleKeys is how many keys a Throttle holds before forgetting the expired ones.
+const maxThrottleKeys = 1024
+
+// Throttle allows an action once per interval for each key, e.g. sending
+// one e-mail per address and minute. It only lives in memory.
+type Throttle struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func NewThrottle(interval time.Duration) *Throttle {
+	return &Throttle{
+		interval: interval,
+		now:      time.Now,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// Allow tells whether the action can be done now for the given key, and records it if so.
+// Otherwise, it returns how long to wait before trying again.
+func (t *Throttle) Allow(key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if last, ok := t.last[key]; ok {
+		if wait := t.interval - now.Sub(last); wait > 0 {
+			return false, wait
+		}
+	}
+
+	if len(t.last) >= maxThrottleKeys {
+		t.forgetExpired(now)
+	}
+
+	t.last[key] = now
+	return true, 0
+}
+
+// forgetExpired removes the keys whose interval is over. The caller must hold the lock.
+func (t *Throttle) forgetExpired(now time.Time) {
+	for key, last := range t.last {
+		if now.Sub(last) >= t.interval {
+			delete(t.last, key)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	throttle := NewThrottle(time.Minute)
+	throttle.now = func() time.Time { return now }
+
+	if ok, _ := throttle.Allow("a@example.com"); !ok {
+		t.Fatal("expected the first action to be allowed")
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, wait := throttle.Allow("a@example.com"); ok || wait != 40*time.Second {
+		t.Errorf("Allow() = %v, %s, want false, 40s", ok, wait)
+	}
+
+	if ok, _ := throttle.Allow("b@example.com"); !ok {
+		t.Error("expected other keys not to be throttled")
+	}
+
+	now = now.Add(40 * time.Second)
+	if ok, _ := throttle.Allow("a@example.com"); !ok {
+		t.Error("expected the action to be allowed once the interval is over")
+	}
+}
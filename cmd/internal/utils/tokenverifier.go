@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRefreshInterval limits how often unknown key IDs can trigger a JWKS refresh,
+// so tokens signed with made-up keys cannot be used to hammer the JWKS endpoint.
+const minRefreshInterval = time.Minute
+
+// VerifierConfig describes which tokens are accepted by a TokenVerifier.
+type VerifierConfig struct {
+	// JWKS is either an http(s) URL or a path to a local file holding the JSON Web Key Set.
+	JWKS string
+
+	// StaticJWKS holds the key set itself, e.g. for tokens issued by the local identity
+	// provider. It is used instead of JWKS when set.
+	StaticJWKS []byte
+
+	// Issuer is the expected "iss" claim.
+	Issuer string
+
+	// ClientID is the expected "aud" (ID tokens) or "client_id" (access tokens) claim.
+	ClientID string
+
+	// TokenUses lists the accepted "token_use" claims, e.g. "id" and "access".
+	TokenUses []string
+
+	// CacheTTL tells how long fetched keys are used before fetching them again.
+	CacheTTL time.Duration
+}
+
+// VerifierConfigFromEnv builds the verifier configuration for the Cognito user pool. The JWKS,
+// issuer and cache TTL can be overridden through AWS_COGNITO_JWKS, AWS_COGNITO_ISSUER and
+// AWS_COGNITO_JWKS_TTL, e.g. to point to a local key set when running offline. AWS_COGNITO_CLIENT_ID
+// is required, as only the tokens issued to our app client are accepted.
+func VerifierConfigFromEnv() (*VerifierConfig, error) {
+	region := os.Getenv("AWS_COGNITO_REGION")
+	poolId := os.Getenv("AWS_COGNITO_USER_POOL_ID")
+
+	issuer := os.Getenv("AWS_COGNITO_ISSUER")
+	if issuer == "" {
+		issuer = fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, poolId)
+	}
+
+	jwks := os.Getenv("AWS_COGNITO_JWKS")
+	if jwks == "" {
+		jwks = issuer + "/.well-known/jwks.json"
+	}
+
+	ttl := time.Hour
+	if raw := os.Getenv("AWS_COGNITO_JWKS_TTL"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid AWS_COGNITO_JWKS_TTL %q", raw)
+		}
+		ttl = parsed
+	}
+
+	clientID := os.Getenv("AWS_COGNITO_CLIENT_ID")
+	if clientID == "" {
+		return nil, errors.New("AWS_COGNITO_CLIENT_ID is not set")
+	}
+
+	return &VerifierConfig{
+		JWKS:      jwks,
+		Issuer:    issuer,
+		ClientID:  clientID,
+		TokenUses: []string{"id", "access"},
+		CacheTTL:  ttl,
+	}, nil
+}
+
+// TokenVerifier checks the signature and claims of JWTs issued by Cognito (or the local identity provider).
+// Keys are cached, and fetched again once expired or when a token is signed
+// with a key that is not known yet (i.e. keys were rotated).
+type TokenVerifier struct {
+	config *VerifierConfig
+	parser *jwt.Parser
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func NewTokenVerifier(config *VerifierConfig) *TokenVerifier {
+	return &TokenVerifier{
+		config: config,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods([]string{"RS256"}),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithExpirationRequired(),
+		),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify parses the token and returns its claims, only if its signature and claims are valid.
+func (v *TokenVerifier) Verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, v.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenUse := getValue(claims, "token_use")
+	if !slices.Contains(v.config.TokenUses, tokenUse) {
+		return nil, fmt.Errorf("token_use %q is not accepted", tokenUse)
+	}
+
+	// ID tokens carry the app client in "aud", while access tokens carry it in "client_id"
+	var clientID string
+	if tokenUse == "access" {
+		clientID = getValue(claims, "client_id")
+	} else {
+		aud, _ := claims.GetAudience()
+		if slices.Contains(aud, v.config.ClientID) {
+			clientID = v.config.ClientID
+		}
+	}
+
+	if v.config.ClientID == "" || clientID != v.config.ClientID {
+		return nil, errors.New("token was issued for another client")
+	}
+
+	if getValue(claims, "sub") == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+func (v *TokenVerifier) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no key ID")
+	}
+
+	key, fresh := v.cachedKey(kid)
+	if key != nil && fresh {
+		return key, nil
+	}
+
+	if err := v.refresh(key == nil); err != nil {
+		// Keep using known keys if the JWKS is (temporarily) unreachable
+		if key != nil {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	key, _ = v.cachedKey(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
+
+func (v *TokenVerifier) cachedKey(kid string) (*rsa.PublicKey, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.keys[kid], time.Since(v.fetchedAt) < v.config.CacheTTL
+}
+
+// refresh fetches the key set again. Refreshes caused by unknown key IDs are
+// rate limited, while refreshes of an expired cache always go through.
+func (v *TokenVerifier) refresh(unknownKey bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := time.Since(v.fetchedAt)
+	if unknownKey && age < minRefreshInterval {
+		return nil
+	}
+	if !unknownKey && age < v.config.CacheTTL {
+		return nil // Someone else refreshed it meanwhile
+	}
+
+	keys, err := v.loadKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (v *TokenVerifier) loadKeys() (map[string]*rsa.PublicKey, error) {
+	raw, err := v.readJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		key, err := toPublicKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA signing keys found")
+	}
+	return keys, nil
+}
+
+func (v *TokenVerifier) readJWKS() ([]byte, error) {
+	if v.config.StaticJWKS != nil {
+		return v.config.StaticJWKS, nil
+	}
+
+	source := v.config.JWKS
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(source, "file://"))
+	}
+
+	resp, err := v.client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func toPublicKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
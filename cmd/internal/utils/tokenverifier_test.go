@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://cognito-idp.us-east-1.amazonaws.com/us-east-1_test"
+	testClientID = "test-client"
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return key
+}
+
+// writeJWKS writes the public part of the given keys as a key set.
+func writeJWKS(t *testing.T, path string, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, jsonWebKey{
+			Kid: kid,
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+
+	raw, _ := json.Marshal(set)
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func idClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":       "user-sub",
+		"email":     "user@example.com",
+		"iss":       testIssuer,
+		"aud":       testClientID,
+		"token_use": "id",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func newTestVerifier(t *testing.T, keys map[string]*rsa.PrivateKey) (*TokenVerifier, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, keys)
+	return NewTokenVerifier(&VerifierConfig{
+		JWKS:      path,
+		Issuer:    testIssuer,
+		ClientID:  testClientID,
+		TokenUses: []string{"id", "access"},
+		CacheTTL:  time.Hour,
+	}), path
+}
+
+func TestVerify(t *testing.T) {
+	key, other := newTestKey(t), newTestKey(t)
+	v, _ := newTestVerifier(t, map[string]*rsa.PrivateKey{"k1": key})
+
+	with := func(key string, value any) jwt.MapClaims {
+		claims := idClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	access := with("aud", nil)
+	access["token_use"] = "access"
+	access["client_id"] = testClientID
+
+	otherClient := with("aud", nil)
+	otherClient["token_use"] = "access"
+	otherClient["client_id"] = "other-client"
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid id token", sign(t, key, "k1", idClaims()), true},
+		{"valid access token", sign(t, key, "k1", access), true},
+		{"signed by another key", sign(t, other, "k1", idClaims()), false},
+		{"unknown key ID", sign(t, other, "k2", idClaims()), false},
+		{"expired", sign(t, key, "k1", with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"no expiration", sign(t, key, "k1", with("exp", nil)), false},
+		{"other issuer", sign(t, key, "k1", with("iss", "https://example.com")), false},
+		{"other audience", sign(t, key, "k1", with("aud", "other-client")), false},
+		{"no audience", sign(t, key, "k1", with("aud", nil)), false},
+		{"access token of another client", sign(t, key, "k1", otherClient), false},
+		{"no subject", sign(t, key, "k1", with("sub", nil)), false},
+		{"unknown token use", sign(t, key, "k1", with("token_use", "refresh")), false},
+		{"unsigned", unsigned(t, idClaims()), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token)
+			if tt.valid && err != nil {
+				t.Fatalf("expected token to be valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected token to be rejected, got claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyWithoutClientID(t *testing.T) {
+	key := newTestKey(t)
+	v, _ := newTestVerifier(t, map[string]*rsa.PrivateKey{"k1": key})
+	v.config.ClientID = ""
+
+	// Tokens of every app client would be accepted otherwise
+	claims := idClaims()
+	claims["aud"] = ""
+	if _, err := v.Verify(sign(t, key, "k1", claims)); err == nil {
+		t.Fatal("expected token to be rejected without a client ID to compare with")
+	}
+}
+
+func TestVerifierConfigFromEnvRequiresClientID(t *testing.T) {
+	t.Setenv("AWS_COGNITO_CLIENT_ID", "")
+	if _, err := VerifierConfigFromEnv(); err == nil {
+		t.Fatal("expected an error without AWS_COGNITO_CLIENT_ID")
+	}
+
+	t.Setenv("AWS_COGNITO_CLIENT_ID", testClientID)
+	config, err := VerifierConfigFromEnv()
+	if err != nil || config.ClientID != testClientID {
+		t.Fatalf("VerifierConfigFromEnv() = %+v, %v", config, err)
+	}
+}
+
+func TestVerifyRotatedKeys(t *testing.T) {
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	v, path := newTestVerifier(t, map[string]*rsa.PrivateKey{"old": oldKey})
+
+	if _, err := v.Verify(sign(t, oldKey, "old", idClaims())); err != nil {
+		t.Fatalf("expected token to be valid, got %v", err)
+	}
+
+	writeJWKS(t, path, map[string]*rsa.PrivateKey{"new": newKey})
+	token := sign(t, newKey, "new", idClaims())
+
+	// Unknown keys do not trigger a refresh right after the last one
+	if _, err := v.Verify(token); err == nil {
+		t.Fatal("expected the new key to be unknown until the next refresh")
+	}
+
+	v.fetchedAt = v.fetchedAt.Add(-minRefreshInterval)
+	if _, err := v.Verify(token); err != nil {
+		t.Fatalf("expected the rotated key to be fetched, got %v", err)
+	}
+}
+
+func unsigned(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	return signed
+}
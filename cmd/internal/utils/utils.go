@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"time"
@@ -35,6 +37,35 @@ func IsHourExact(millis int64) bool {
 	return millis%millisInHour == 0
 }
 
+// IsAligned checks if the given epoch milliseconds is a multiple of
+// the given step (e.g., 30 minutes: 14:00 and 14:30 are aligned, 14:15 is not).
+func IsAligned(millis int64, step time.Duration) bool {
+	stepMillis := step.Milliseconds()
+	if stepMillis <= 0 {
+		return true
+	}
+	return millis%stepMillis == 0
+}
+
+// ParseClock converts a time of day ("HH:MM") to minutes since midnight.
+// "24:00" is accepted as the end of the day.
+func ParseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, errors.New("invalid time of day, expected HH:MM")
+}
+
+// FormatClock converts minutes since midnight to a time of day ("HH:MM").
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
 func Sanitize(o any) {
 	v := reflect.ValueOf(o)
 	if v.Kind() != reflect.Ptr || v.IsNil() {
@@ -1,6 +1,7 @@
 package validators
 
 import (
+	"4shure/cmd/internal/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/gommon/log"
 	"reflect"
@@ -81,6 +82,12 @@ func IsIso8601(fl validator.FieldLevel) bool {
 	return err == nil
 }
 
+// IsClock checks if the string is a time of day ("HH:MM"), from "00:00" to "24:00".
+func IsClock(fl validator.FieldLevel) bool {
+	_, err := utils.ParseClock(fl.Field().String())
+	return err == nil
+}
+
 func NoDupes(fl validator.FieldLevel) bool {
 	slice := fl.Field()
 	if slice.Kind() != reflect.Slice {